@@ -0,0 +1,205 @@
+package admin
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/rtclib/transport"
+)
+
+const (
+	RoleProducer   = "producer"
+	RoleBackup     = "backup"
+	RoleSubscriber = "subscriber"
+)
+
+type NamespaceInfo struct {
+	Name    string       `json:"name"`
+	Domains []string     `json:"domains"`
+	Routers []RouterInfo `json:"routers"`
+}
+
+type RouterInfo struct {
+	ID            string        `json:"id"`
+	Namespace     string        `json:"namespace"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	UptimeSeconds int64         `json:"uptimeSeconds"`
+	Producer      *SessionInfo  `json:"producer"`
+	Backups       []SessionInfo `json:"backups"`
+	Subscribers   []SessionInfo `json:"subscribers"`
+}
+
+type PeerInfo struct {
+	PeerID     string            `json:"peerId"`
+	RemoteAddr string            `json:"remoteAddr"`
+	LocalAddr  string            `json:"localAddr"`
+	Domain     string            `json:"domain"`
+	URI        string            `json:"uri"`
+	Args       map[string]string `json:"args"`
+	HasAudio   bool              `json:"hasAudio"`
+	HasVideo   bool              `json:"hasVideo"`
+	HasData    bool              `json:"hasData"`
+}
+
+type SessionInfo struct {
+	ID            string    `json:"id"`
+	Role          string    `json:"role"`
+	RouterID      string    `json:"routerId"`
+	Namespace     string    `json:"namespace"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UptimeSeconds int64     `json:"uptimeSeconds"`
+	// RemainingSeconds is the lifetime left, absent without a limit
+	RemainingSeconds *int64            `json:"remainingSeconds,omitempty"`
+	Peer             PeerInfo          `json:"peer"`
+	Metadata         *deliver.Metadata `json:"metadata"`
+	// Attributes are attached by the authorization hook
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Transport is only known for WebRTC sessions and only filled for a
+	// single session
+	Transport *transport.State `json:"transport,omitempty"`
+}
+
+// transportStater is implemented by the frame sources and destinations
+// running on a WebRTC transport.
+type transportStater interface {
+	TransportState() transport.State
+}
+
+func uptime(since time.Time, now time.Time) int64 {
+	return int64(now.Sub(since) / time.Second)
+}
+
+// tokenArg is left out of the args shown, tokens are not for the admins
+const tokenArg = "token"
+
+// peerArgs returns the args of a peer without its token.
+func peerArgs(args map[string]string) map[string]string {
+	shown := make(map[string]string, len(args))
+	for k, v := range args {
+		if k != tokenArg {
+			shown[k] = v
+		}
+	}
+
+	return shown
+}
+
+func newSessionInfo(r router.Router, s router.Session, role string, withTransport bool, now time.Time) SessionInfo {
+	pm := s.PeerParams()
+	info := SessionInfo{
+		ID:            s.ID(),
+		Role:          role,
+		RouterID:      r.ID(),
+		CreatedAt:     s.CreatedAt(),
+		UptimeSeconds: uptime(s.CreatedAt(), now),
+		Peer: PeerInfo{
+			PeerID:     pm.PeerID,
+			RemoteAddr: pm.RemoteAddr,
+			LocalAddr:  pm.LocalAddr,
+			Domain:     pm.Domain,
+			URI:        pm.URI,
+			Args:       peerArgs(pm.Args),
+			HasAudio:   pm.HasAudio,
+			HasVideo:   pm.HasVideo,
+			HasData:    pm.HasDataChannel,
+		},
+		Attributes: router.GetSessionAttributes(s),
+	}
+
+	if ns := r.Namespace(); ns != nil {
+		info.Namespace = ns.Name()
+	}
+
+	if remaining, ok := r.Remaining(s.ID()); ok {
+		seconds := int64(remaining / time.Second)
+		info.RemainingSeconds = &seconds
+	}
+
+	var stater interface{}
+	if src := s.FrameSource(); src != nil {
+		md := *src.Metadata()
+		info.Metadata = &md
+		stater = src
+	} else if dest := s.FrameDestination(); dest != nil {
+		md := *dest.Metadata()
+		info.Metadata = &md
+		stater = dest
+	}
+
+	if withTransport {
+		if ts, ok := stater.(transportStater); ok {
+			state := ts.TransportState()
+			info.Transport = &state
+		}
+	}
+
+	return info
+}
+
+func sortSessions(sessions []router.Session) {
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt().Before(sessions[j].CreatedAt())
+	})
+}
+
+func newRouterInfo(r router.Router, now time.Time) RouterInfo {
+	info := RouterInfo{
+		ID:            r.ID(),
+		CreatedAt:     r.CreatedAt(),
+		UptimeSeconds: uptime(r.CreatedAt(), now),
+		Backups:       []SessionInfo{},
+		Subscribers:   []SessionInfo{},
+	}
+
+	if ns := r.Namespace(); ns != nil {
+		info.Namespace = ns.Name()
+	}
+
+	if p := r.Producer(); p != nil {
+		producer := newSessionInfo(r, p, RoleProducer, false, now)
+		info.Producer = &producer
+	}
+
+	backups := r.Backups()
+	sortSessions(backups)
+	for _, s := range backups {
+		info.Backups = append(info.Backups, newSessionInfo(r, s, RoleBackup, false, now))
+	}
+
+	subscribers := r.Subscribers()
+	sortSessions(subscribers)
+	for _, s := range subscribers {
+		info.Subscribers = append(info.Subscribers, newSessionInfo(r, s, RoleSubscriber, false, now))
+	}
+
+	return info
+}
+
+func newNamespaceInfo(ns *router.Namespace, now time.Time) NamespaceInfo {
+	info := NamespaceInfo{
+		Name:    ns.Name(),
+		Domains: ns.Domains(),
+		Routers: []RouterInfo{},
+	}
+
+	for _, r := range ns.Routers() {
+		info.Routers = append(info.Routers, newRouterInfo(r, now))
+	}
+
+	return info
+}
+
+// sessionRole tells how a session takes part in its router.
+func sessionRole(r router.Router, s router.Session) string {
+	if p := r.Producer(); p != nil && p.ID() == s.ID() {
+		return RoleProducer
+	}
+
+	if s.PeerParams().Producer {
+		return RoleBackup
+	}
+
+	return RoleSubscriber
+}
@@ -0,0 +1,84 @@
+package admin
+
+import (
+	"context"
+
+	"github.com/let-light/gomodule"
+	feature_admin "github.com/pingostack/neon/features/admin"
+	"github.com/pingostack/neon/internal/httpserv"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var adminModule *admin
+
+type AdminSettings struct {
+	httpserv.HttpParams `json:"http" mapstructure:"http"`
+	// Tokens are the bearer tokens accepted by the API, without any every
+	// request is refused.
+	Tokens []string `json:"tokens" mapstructure:"tokens"`
+}
+
+type admin struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings AdminSettings
+	settings    *AdminSettings
+	logger      *logrus.Entry
+	serv        *Server
+}
+
+func init() {
+	adminModule = &admin{
+		logger: logrus.WithField("module", "admin"),
+	}
+}
+
+func AdminModule() *admin {
+	return adminModule
+}
+
+func (admin *admin) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	admin.ctx = ctx
+	return &admin.preSettings, nil
+}
+
+func (admin *admin) InitCommand() ([]*cobra.Command, error) {
+
+	return nil, nil
+}
+
+func (admin *admin) ConfigChanged() {
+	if admin.settings == nil {
+		admin.settings = &admin.preSettings
+	}
+}
+
+func (admin *admin) ModuleRun() {
+	if admin.settings.HttpAddr == "" && admin.settings.HttpsAddr == "" {
+		admin.logger.Info("admin api disabled")
+		return
+	}
+
+	if len(admin.settings.Tokens) == 0 {
+		admin.logger.Warn("admin api has no token, every request will be refused")
+	}
+
+	admin.serv = NewServer(admin.ctx, *admin.settings, admin.logger)
+	if err := admin.serv.Start(); err != nil {
+		admin.logger.Errorf("admin start error: %v", err)
+		return
+	}
+
+	<-admin.ctx.Done()
+	admin.close()
+}
+
+func (admin *admin) Type() interface{} {
+	return feature_admin.Type()
+}
+
+func (admin *admin) close() {
+	admin.logger.Info("admin closing")
+	admin.serv.Close()
+}
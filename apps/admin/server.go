@@ -0,0 +1,300 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/internal/httpserv"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrUnauthorized   = errors.New("unauthorized")
+	ErrNotReady       = errors.New("core not running")
+	ErrNSNotFound     = errors.New("namespace not found")
+	ErrClosedByAdmin  = errors.New("closed by admin")
+	ErrKickedByAdmin  = errors.New("kicked by admin")
+	ErrRouterNotFound = errors.New("router not found")
+	ErrNoLifetime     = errors.New("session has no lifetime limit")
+	ErrBadExtension   = errors.New("seconds must be positive")
+)
+
+// ExtendRequest is the body of a session extension.
+type ExtendRequest struct {
+	// Seconds pushes the deadline of the session back
+	Seconds int64 `json:"seconds"`
+}
+
+// Server is the admin HTTP API, every endpoint answers JSON and needs a
+// bearer token.
+type Server struct {
+	ss       *httpserv.SignalServer
+	ctx      context.Context
+	logger   *logrus.Entry
+	settings AdminSettings
+}
+
+func NewServer(ctx context.Context, settings AdminSettings, logger *logrus.Entry) *Server {
+	return &Server{
+		ss:       httpserv.NewSignalServer(ctx, settings.HttpParams, logger),
+		ctx:      ctx,
+		logger:   logger,
+		settings: settings,
+	}
+}
+
+func (s *Server) Start() error {
+	api := s.ss.DefaultRouter().Group("/api/v1", s.authenticate)
+
+	api.GET("/namespaces", s.handleListNamespaces)
+	api.GET("/namespaces/:namespace", s.handleGetNamespace)
+	api.GET("/routers", s.handleListRouters)
+	api.GET("/routers/*id", s.handleGetRouter)
+	api.DELETE("/routers/*id", s.handleCloseRouter)
+	api.GET("/sessions/:id", s.handleGetSession)
+	api.DELETE("/sessions/:id", s.handleKickSession)
+	api.POST("/sessions/:id/extend", s.handleExtendSession)
+
+	return s.ss.Start(func(gc *gin.Context) {
+		s.writeError(gc, http.StatusNotFound, errors.New("not found"))
+	})
+}
+
+func (s *Server) Close() error {
+	return s.ss.Close()
+}
+
+func (s *Server) writeError(gc *gin.Context, status int, err error) {
+	gc.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
+
+// token returns the bearer token of the request, a query would leave it
+// in the access logs.
+func token(gc *gin.Context) string {
+	auth := gc.GetHeader("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+
+	return ""
+}
+
+func (s *Server) authenticate(gc *gin.Context) {
+	t := token(gc)
+	if t != "" {
+		for _, allowed := range s.settings.Tokens {
+			if subtle.ConstantTimeCompare([]byte(t), []byte(allowed)) == 1 {
+				gc.Next()
+				return
+			}
+		}
+	}
+
+	gc.Header("WWW-Authenticate", `Bearer realm="neon"`)
+	s.writeError(gc, http.StatusUnauthorized, ErrUnauthorized)
+}
+
+func (s *Server) nsManager(gc *gin.Context) *router.NSManager {
+	m := core.NSManager()
+	if m == nil {
+		s.writeError(gc, http.StatusServiceUnavailable, ErrNotReady)
+	}
+
+	return m
+}
+
+func (s *Server) handleListNamespaces(gc *gin.Context) {
+	m := s.nsManager(gc)
+	if m == nil {
+		return
+	}
+
+	now := time.Now()
+	namespaces := []NamespaceInfo{}
+	for _, ns := range m.Namespaces() {
+		namespaces = append(namespaces, newNamespaceInfo(ns, now))
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"namespaces": namespaces})
+}
+
+func (s *Server) lookupNamespace(m *router.NSManager, name string) *router.Namespace {
+	for _, ns := range m.Namespaces() {
+		if ns.Name() == name {
+			return ns
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) handleGetNamespace(gc *gin.Context) {
+	m := s.nsManager(gc)
+	if m == nil {
+		return
+	}
+
+	ns := s.lookupNamespace(m, gc.Param("namespace"))
+	if ns == nil {
+		s.writeError(gc, http.StatusNotFound, ErrNSNotFound)
+		return
+	}
+
+	gc.JSON(http.StatusOK, newNamespaceInfo(ns, time.Now()))
+}
+
+func (s *Server) handleListRouters(gc *gin.Context) {
+	m := s.nsManager(gc)
+	if m == nil {
+		return
+	}
+
+	namespaces := m.Namespaces()
+	if name := gc.Query("namespace"); name != "" {
+		ns := s.lookupNamespace(m, name)
+		if ns == nil {
+			s.writeError(gc, http.StatusNotFound, ErrNSNotFound)
+			return
+		}
+		namespaces = []*router.Namespace{ns}
+	}
+
+	now := time.Now()
+	routers := []RouterInfo{}
+	for _, ns := range namespaces {
+		for _, r := range ns.Routers() {
+			routers = append(routers, newRouterInfo(r, now))
+		}
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"routers": routers})
+}
+
+// lookupRouter finds the router of the path, router ids contain slashes
+// so the id is the rest of the path. The namespace query narrows the
+// search.
+func (s *Server) lookupRouter(gc *gin.Context) router.Router {
+	m := s.nsManager(gc)
+	if m == nil {
+		return nil
+	}
+
+	id := strings.Trim(gc.Param("id"), "/")
+
+	if name := gc.Query("namespace"); name != "" {
+		ns := s.lookupNamespace(m, name)
+		if ns == nil {
+			s.writeError(gc, http.StatusNotFound, ErrNSNotFound)
+			return nil
+		}
+
+		if r := ns.Router(id); r != nil {
+			return r
+		}
+	} else if r, ok := m.LookupRouter(id); ok {
+		return r
+	}
+
+	s.writeError(gc, http.StatusNotFound, ErrRouterNotFound)
+
+	return nil
+}
+
+func (s *Server) handleGetRouter(gc *gin.Context) {
+	r := s.lookupRouter(gc)
+	if r == nil {
+		return
+	}
+
+	gc.JSON(http.StatusOK, newRouterInfo(r, time.Now()))
+}
+
+func (s *Server) handleCloseRouter(gc *gin.Context) {
+	r := s.lookupRouter(gc)
+	if r == nil {
+		return
+	}
+
+	s.logger.Infof("closing router %s", r.ID())
+	r.Close(ErrClosedByAdmin)
+
+	gc.Status(http.StatusNoContent)
+}
+
+func (s *Server) lookupSession(gc *gin.Context) (router.Router, router.Session) {
+	m := s.nsManager(gc)
+	if m == nil {
+		return nil, nil
+	}
+
+	sess, ok := m.LookupSession(gc.Param("id"))
+	if !ok || sess.GetRouter() == nil {
+		s.writeError(gc, http.StatusNotFound, router.ErrSessionNotFound)
+		return nil, nil
+	}
+
+	return sess.GetRouter(), sess
+}
+
+func (s *Server) handleGetSession(gc *gin.Context) {
+	r, sess := s.lookupSession(gc)
+	if sess == nil {
+		return
+	}
+
+	gc.JSON(http.StatusOK, newSessionInfo(r, sess, sessionRole(r, sess), true, time.Now()))
+}
+
+func (s *Server) handleKickSession(gc *gin.Context) {
+	r, sess := s.lookupSession(gc)
+	if sess == nil {
+		return
+	}
+
+	if err := r.Kick(sess.ID(), ErrKickedByAdmin); err != nil {
+		s.writeError(gc, http.StatusNotFound, err)
+		return
+	}
+
+	gc.Status(http.StatusNoContent)
+}
+
+// handleExtendSession grants a session with a lifetime limit more time,
+// it answers the session with its new remaining time.
+func (s *Server) handleExtendSession(gc *gin.Context) {
+	req := ExtendRequest{}
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		s.writeError(gc, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Seconds <= 0 {
+		s.writeError(gc, http.StatusBadRequest, ErrBadExtension)
+		return
+	}
+
+	r, sess := s.lookupSession(gc)
+	if sess == nil {
+		return
+	}
+
+	if _, ok := r.Remaining(sess.ID()); !ok {
+		s.writeError(gc, http.StatusConflict, ErrNoLifetime)
+		return
+	}
+
+	if err := r.Extend(sess.ID(), time.Duration(req.Seconds)*time.Second); err != nil {
+		s.writeError(gc, http.StatusNotFound, err)
+		return
+	}
+
+	s.logger.Infof("session %s extended by %ds", sess.ID(), req.Seconds)
+	gc.JSON(http.StatusOK, newSessionInfo(r, sess, sessionRole(r, sess), true, time.Now()))
+}
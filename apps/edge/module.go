@@ -0,0 +1,113 @@
+package edge
+
+import (
+	"context"
+	"time"
+
+	"github.com/let-light/gomodule"
+	feature_edge "github.com/pingostack/neon/features/edge"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultPullTimeout = 10 * time.Second
+	defaultIdleTimeout = 30 * time.Second
+)
+
+var edgeModule *edge
+
+// OriginSettings are the origins of the streams of a namespace.
+type OriginSettings struct {
+	// Urls are the rtsp urls of the origins, the router id is appended to
+	// their path. Their query arguments are sent to the origin and are the
+	// arguments of the local producer, a token included.
+	Urls []string `json:"urls" mapstructure:"urls"`
+	// Policy is hash or failover. hash spreads the routers over the
+	// origins, failover tries them in order. Both try the next origins when
+	// a pull fails.
+	Policy string `json:"policy" mapstructure:"policy"`
+}
+
+type EdgeSettings struct {
+	// Origins maps namespaces to their origins, "*" matches any
+	// namespace. The edge is disabled without origins.
+	Origins            map[string]OriginSettings `json:"origins" mapstructure:"origins"`
+	PullTimeoutSeconds int                       `json:"pullTimeoutSeconds" mapstructure:"pullTimeoutSeconds"`
+	// IdleTimeoutSeconds is how long a pull is kept without subscribers
+	IdleTimeoutSeconds int `json:"idleTimeoutSeconds" mapstructure:"idleTimeoutSeconds"`
+}
+
+type edge struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings EdgeSettings
+	settings    *EdgeSettings
+	logger      *logrus.Entry
+}
+
+func init() {
+	edgeModule = &edge{
+		logger: logrus.WithField("module", "edge"),
+	}
+}
+
+func EdgeModule() *edge {
+	return edgeModule
+}
+
+func (e *edge) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	e.ctx = ctx
+	return &e.preSettings, nil
+}
+
+func (e *edge) InitCommand() ([]*cobra.Command, error) {
+
+	return nil, nil
+}
+
+func (e *edge) ConfigChanged() {
+	if e.settings == nil {
+		e.settings = &e.preSettings
+	}
+}
+
+func seconds(s int, def time.Duration) time.Duration {
+	if s <= 0 {
+		return def
+	}
+
+	return time.Duration(s) * time.Second
+}
+
+func (e *edge) ModuleRun() {
+	origins := make(map[string]*origins, len(e.settings.Origins))
+	for ns, os := range e.settings.Origins {
+		o, err := newOrigins(os)
+		if err != nil {
+			e.logger.WithError(err).Errorf("origins of namespace %s disabled", ns)
+			continue
+		}
+
+		origins[ns] = o
+	}
+
+	if len(origins) == 0 {
+		e.logger.Info("edge disabled")
+		return
+	}
+
+	p := newPuller(e.ctx, origins,
+		seconds(e.settings.PullTimeoutSeconds, defaultPullTimeout),
+		seconds(e.settings.IdleTimeoutSeconds, defaultIdleTimeout),
+		e.logger)
+	p.subscribe()
+
+	<-e.ctx.Done()
+	e.logger.Info("edge closing")
+	p.close()
+}
+
+func (e *edge) Type() interface{} {
+	return feature_edge.Type()
+}
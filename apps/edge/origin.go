@@ -0,0 +1,79 @@
+package edge
+
+import (
+	"hash/fnv"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Policies of OriginSettings.
+const (
+	PolicyHash     = "hash"
+	PolicyFailover = "failover"
+)
+
+var (
+	ErrNoOrigin      = errors.New("no origin")
+	ErrInvalidPolicy = errors.New("invalid origin policy")
+)
+
+// origins are the urls a namespace pulls its streams from.
+type origins struct {
+	urls []*url.URL
+	hash bool
+}
+
+func newOrigins(os OriginSettings) (*origins, error) {
+	o := &origins{}
+	switch os.Policy {
+	case "", PolicyFailover:
+	case PolicyHash:
+		o.hash = true
+	default:
+		return nil, errors.Wrap(ErrInvalidPolicy, os.Policy)
+	}
+
+	for _, s := range os.Urls {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid origin %s", s)
+		}
+
+		if !strings.EqualFold(u.Scheme, "rtsp") {
+			return nil, errors.Errorf("invalid origin scheme %s", u.Scheme)
+		}
+
+		o.urls = append(o.urls, u)
+	}
+
+	if len(o.urls) == 0 {
+		return nil, ErrNoOrigin
+	}
+
+	return o, nil
+}
+
+// pullUrls returns the urls of the stream of a router in the order they
+// are tried, the hash of the router id picks the first one with the hash
+// policy.
+func (o *origins) pullUrls(routerID string) []*url.URL {
+	start := 0
+	if o.hash {
+		h := fnv.New32a()
+		h.Write([]byte(routerID))
+		start = int(h.Sum32() % uint32(len(o.urls)))
+	}
+
+	urls := make([]*url.URL, 0, len(o.urls))
+	for i := range o.urls {
+		u := *o.urls[(start+i)%len(o.urls)]
+		u.Path = path.Join("/", u.Path, routerID)
+		u.RawPath = ""
+		urls = append(urls, &u)
+	}
+
+	return urls
+}
@@ -0,0 +1,311 @@
+package edge
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/util/guid"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/deliver/rtsp"
+	proto_rtsp "github.com/pingostack/neon/protocols/rtsp"
+	"github.com/sirupsen/logrus"
+)
+
+// repullDelay spaces the pulls of a router whose pull ended while it has
+// subscribers.
+const repullDelay = time.Second
+
+type pullKey struct {
+	namespace string
+	routerID  string
+}
+
+// pull is the producer of a router pulled from an origin, shared by the
+// subscribers of the router.
+type pull struct {
+	key    pullKey
+	domain string
+	lock   sync.Mutex
+	sess   *rtsp.PullSession
+	idle   *time.Timer
+	closed bool
+}
+
+func (pl *pull) setSession(sess *rtsp.PullSession) bool {
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+
+	if pl.closed {
+		return false
+	}
+
+	pl.sess = sess
+	return true
+}
+
+func (pl *pull) isClosed() bool {
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+
+	return pl.closed
+}
+
+func (pl *pull) startIdle(d time.Duration, f func()) {
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+
+	if pl.closed || pl.idle != nil {
+		return
+	}
+
+	pl.idle = time.AfterFunc(d, f)
+}
+
+func (pl *pull) stopIdle() {
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+
+	if pl.idle != nil {
+		pl.idle.Stop()
+		pl.idle = nil
+	}
+}
+
+func (pl *pull) close() {
+	pl.lock.Lock()
+	pl.closed = true
+	if pl.idle != nil {
+		pl.idle.Stop()
+		pl.idle = nil
+	}
+	sess := pl.sess
+	pl.lock.Unlock()
+
+	if sess != nil {
+		sess.Close()
+	}
+}
+
+// puller pulls the streams of the routers a subscriber joins without
+// producer. The pull joins the router as its producer, the subscribers
+// waiting for one get its frames.
+type puller struct {
+	ctx         context.Context
+	origins     map[string]*origins
+	pullTimeout time.Duration
+	idleTimeout time.Duration
+	logger      *logrus.Entry
+	lock        sync.Mutex
+	pulls       map[pullKey]*pull
+}
+
+func newPuller(ctx context.Context, origins map[string]*origins, pullTimeout, idleTimeout time.Duration, logger *logrus.Entry) *puller {
+	return &puller{
+		ctx:         ctx,
+		origins:     origins,
+		pullTimeout: pullTimeout,
+		idleTimeout: idleTimeout,
+		logger:      logger,
+		pulls:       make(map[pullKey]*pull),
+	}
+}
+
+func (p *puller) subscribe() {
+	core.Subscribe(func(ev router.SessionJoined) {
+		if ev.Role == router.SessionRoleSubscriber {
+			p.start(pullKey{ev.Namespace, ev.RouterID}, ev.PeerParams.Domain)
+		}
+	})
+	core.Subscribe(func(ev router.SessionLeft) {
+		if ev.Role == router.SessionRoleSubscriber {
+			p.left(pullKey{ev.Namespace, ev.RouterID})
+		}
+	})
+}
+
+func (p *puller) originsOf(namespace string) *origins {
+	if o, ok := p.origins[namespace]; ok {
+		return o
+	}
+
+	return p.origins["*"]
+}
+
+func (p *puller) router(key pullKey) router.Router {
+	m := core.NSManager()
+	if m == nil {
+		return nil
+	}
+
+	for _, ns := range m.Namespaces() {
+		if ns.Name() == key.namespace {
+			return ns.Router(key.routerID)
+		}
+	}
+
+	return nil
+}
+
+func (p *puller) subscribers(key pullKey) int {
+	r := p.router(key)
+	if r == nil {
+		return 0
+	}
+
+	return len(r.Subscribers())
+}
+
+// start pulls the stream of a router unless it has a producer or a pull.
+func (p *puller) start(key pullKey, domain string) {
+	o := p.originsOf(key.namespace)
+	if o == nil {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.ctx.Err() != nil {
+		return
+	}
+
+	if pl := p.pulls[key]; pl != nil {
+		pl.stopIdle()
+		return
+	}
+
+	r := p.router(key)
+	if r == nil || r.Closed() || r.Producer() != nil || len(r.Backups()) > 0 {
+		return
+	}
+
+	pl := &pull{
+		key:    key,
+		domain: domain,
+	}
+	p.pulls[key] = pl
+
+	go p.run(pl, o)
+}
+
+func (p *puller) run(pl *pull, o *origins) {
+	logger := p.logger.WithFields(logrus.Fields{
+		"namespace": pl.key.namespace,
+		"router":    pl.key.routerID,
+	})
+
+	var sess *rtsp.PullSession
+	for _, u := range o.pullUrls(pl.key.routerID) {
+		if pl.isClosed() {
+			break
+		}
+
+		s := rtsp.NewPullSession(p.ctx, proto_rtsp.CliSessionOptions{
+			Url: u.String(),
+			// the pull ends with the stream of the origin, the next pull
+			// fails over to another origin
+			MaxReconnects: -1,
+		}, router.PeerParams{
+			RemoteAddr: u.Host,
+			PeerID:     guid.S(),
+			RouterID:   pl.key.routerID,
+			Domain:     pl.domain,
+			URI:        u.Path,
+			Args:       router.QueryArgs(u.Query()),
+		}, logger)
+
+		// an origin is kept once its stream flows, one rejecting the PLAY
+		// or sending nothing is skipped
+		if err := s.Pull(p.pullTimeout); err != nil {
+			logger.WithError(err).Warnf("failed to pull from %s", u.Redacted())
+			continue
+		}
+
+		logger.Infof("pulling from %s", u.Redacted())
+		sess = s
+		break
+	}
+
+	if sess == nil || !pl.setSession(sess) {
+		if sess != nil {
+			sess.Close()
+		} else {
+			logger.Error("no origin to pull from")
+		}
+		p.remove(pl)
+		return
+	}
+
+	// the subscribers may have left during the pull
+	p.left(pl.key)
+
+	<-sess.Context().Done()
+	logger.WithError(sess.Err()).Info("pull ended")
+	p.remove(pl)
+
+	if pl.isClosed() || p.subscribers(pl.key) == 0 {
+		return
+	}
+
+	select {
+	case <-p.ctx.Done():
+	case <-time.After(repullDelay):
+		p.start(pl.key, pl.domain)
+	}
+}
+
+func (p *puller) remove(pl *pull) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.pulls[pl.key] == pl {
+		delete(p.pulls, pl.key)
+	}
+}
+
+// left closes the pull of a router left without subscribers once it has
+// been idle for idleTimeout.
+func (p *puller) left(key pullKey) {
+	p.lock.Lock()
+	pl := p.pulls[key]
+	p.lock.Unlock()
+
+	if pl == nil || p.subscribers(key) > 0 {
+		return
+	}
+
+	pl.startIdle(p.idleTimeout, func() {
+		p.idle(pl)
+	})
+}
+
+func (p *puller) idle(pl *pull) {
+	pl.stopIdle()
+
+	p.lock.Lock()
+	if p.pulls[pl.key] != pl || p.subscribers(pl.key) > 0 {
+		p.lock.Unlock()
+		return
+	}
+	delete(p.pulls, pl.key)
+	p.lock.Unlock()
+
+	p.logger.WithFields(logrus.Fields{
+		"namespace": pl.key.namespace,
+		"router":    pl.key.routerID,
+	}).Info("pull idle timeout")
+	pl.close()
+}
+
+func (p *puller) close() {
+	p.lock.Lock()
+	pulls := p.pulls
+	p.pulls = make(map[pullKey]*pull)
+	p.lock.Unlock()
+
+	for _, pl := range pulls {
+		pl.close()
+	}
+}
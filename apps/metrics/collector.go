@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	namespacesDesc = prometheus.NewDesc("neon_namespaces",
+		"Namespaces configured or created.", nil, nil)
+	routersDesc = prometheus.NewDesc("neon_routers",
+		"Routers alive.", []string{metrics.LabelNamespace}, nil)
+	publishersDesc = prometheus.NewDesc("neon_publishers",
+		"Publishers, producers and their backups.", []string{metrics.LabelNamespace}, nil)
+	subscribersDesc = prometheus.NewDesc("neon_subscribers",
+		"Subscribers, including the ones waiting for a producer.", []string{metrics.LabelNamespace}, nil)
+)
+
+// coreCollector reads the gauges from the routers at each scrape.
+type coreCollector struct{}
+
+func newCoreCollector() prometheus.Collector {
+	return coreCollector{}
+}
+
+func (coreCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- namespacesDesc
+	ch <- routersDesc
+	ch <- publishersDesc
+	ch <- subscribersDesc
+}
+
+type namespaceGauges struct {
+	routers     int
+	publishers  int
+	subscribers int
+}
+
+func (coreCollector) Collect(ch chan<- prometheus.Metric) {
+	m := core.NSManager()
+	if m == nil {
+		return
+	}
+
+	namespaces := m.Namespaces()
+	ch <- prometheus.MustNewConstMetric(namespacesDesc, prometheus.GaugeValue, float64(len(namespaces)))
+
+	// namespaces sharing a label value are summed up
+	gauges := make(map[string]*namespaceGauges)
+	for _, ns := range namespaces {
+		label := metrics.Label(metrics.LabelNamespace, ns.Name())
+		g, ok := gauges[label]
+		if !ok {
+			g = &namespaceGauges{}
+			gauges[label] = g
+		}
+
+		for _, r := range ns.Routers() {
+			g.routers++
+			if r.Producer() != nil {
+				g.publishers++
+			}
+			g.publishers += len(r.Backups())
+			g.subscribers += len(r.Subscribers())
+		}
+	}
+
+	for label, g := range gauges {
+		ch <- prometheus.MustNewConstMetric(routersDesc, prometheus.GaugeValue, float64(g.routers), label)
+		ch <- prometheus.MustNewConstMetric(publishersDesc, prometheus.GaugeValue, float64(g.publishers), label)
+		ch <- prometheus.MustNewConstMetric(subscribersDesc, prometheus.GaugeValue, float64(g.subscribers), label)
+	}
+}
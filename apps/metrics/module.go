@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/let-light/gomodule"
+	feature_metrics "github.com/pingostack/neon/features/metrics"
+	"github.com/pingostack/neon/internal/httpserv"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const defaultPath = "/metrics"
+
+var metricsModule *metricsServ
+
+type MetricsSettings struct {
+	httpserv.HttpParams `json:"http" mapstructure:"http"`
+	Path                string `json:"path" mapstructure:"path"`
+	// Labels are the labels filled in among namespace, router and codec,
+	// the others are left empty.
+	Labels []string `json:"labels" mapstructure:"labels"`
+	// MaxLabelValues bounds the values of each label, the values past it
+	// are reported as "other".
+	MaxLabelValues int `json:"maxLabelValues" mapstructure:"maxLabelValues"`
+}
+
+type metricsServ struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings MetricsSettings
+	settings    *MetricsSettings
+	logger      *logrus.Entry
+	ss          *httpserv.SignalServer
+}
+
+func init() {
+	metricsModule = &metricsServ{
+		logger: logrus.WithField("module", "metrics"),
+	}
+}
+
+func MetricsModule() *metricsServ {
+	return metricsModule
+}
+
+func (m *metricsServ) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	m.ctx = ctx
+	return &m.preSettings, nil
+}
+
+func (m *metricsServ) InitCommand() ([]*cobra.Command, error) {
+
+	return nil, nil
+}
+
+func (m *metricsServ) ConfigChanged() {
+	if m.settings == nil {
+		m.settings = &m.preSettings
+	}
+
+	if m.settings.Path == "" {
+		m.settings.Path = defaultPath
+	}
+
+	metrics.Configure(m.settings.Labels, m.settings.MaxLabelValues)
+}
+
+func (m *metricsServ) ModuleRun() {
+	if m.settings.HttpAddr == "" && m.settings.HttpsAddr == "" {
+		m.logger.Info("metrics endpoint disabled")
+		return
+	}
+
+	if err := metrics.Registry.Register(newCoreCollector()); err != nil {
+		m.logger.WithError(err).Error("failed to register core collector")
+	}
+
+	m.ss = httpserv.NewSignalServer(m.ctx, m.settings.HttpParams, m.logger)
+	m.ss.DefaultRouter().GET(m.settings.Path, gin.WrapH(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{
+		ErrorLog: m.logger,
+	})))
+
+	if err := m.ss.Start(); err != nil {
+		m.logger.Errorf("metrics start error: %v", err)
+		return
+	}
+
+	<-m.ctx.Done()
+	m.close()
+}
+
+func (m *metricsServ) Type() interface{} {
+	return feature_metrics.Type()
+}
+
+func (m *metricsServ) close() {
+	m.logger.Info("metrics closing")
+	m.ss.Close()
+}
@@ -0,0 +1,167 @@
+package notify
+
+import (
+	"time"
+
+	"github.com/gogf/gf/util/guid"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/eventemitter"
+)
+
+// Event types, a webhook filters them by name.
+const (
+	TypeNamespaceCreated  = "namespace.created"
+	TypeNamespaceClosed   = "namespace.closed"
+	TypeRouterCreated     = "router.created"
+	TypeRouterClosed      = "router.closed"
+	TypeRouterIdleTimeout = "router.idle_timeout"
+	TypePublishStarted    = "publish.started"
+	TypePublishStopped    = "publish.stopped"
+	TypePlayStarted       = "play.started"
+	TypePlayStopped       = "play.stopped"
+	TypeProducerReplaced  = "producer.replaced"
+)
+
+// tokenArg is left out of the args sent, tokens are not for the webhooks
+const tokenArg = "token"
+
+// Peer is the peer of a session event.
+type Peer struct {
+	PeerID     string            `json:"peerId"`
+	RemoteAddr string            `json:"remoteAddr"`
+	Domain     string            `json:"domain"`
+	URI        string            `json:"uri"`
+	Args       map[string]string `json:"args,omitempty"`
+	Backup     bool              `json:"backup,omitempty"`
+}
+
+// Event is the json body posted to the webhooks.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Namespace string    `json:"namespace"`
+	RouterID  string    `json:"routerId,omitempty"`
+	SessionID string    `json:"sessionId,omitempty"`
+	// Replaced is the producer finalized by a producer.replaced
+	Replaced string `json:"replaced,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Peer     *Peer  `json:"peer,omitempty"`
+}
+
+func newEvent(typ, namespace string) *Event {
+	return &Event{
+		ID:        guid.S(),
+		Type:      typ,
+		Timestamp: time.Now(),
+		Namespace: namespace,
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
+
+func newPeer(ev router.SessionEvent) *Peer {
+	pp := ev.PeerParams
+	var args map[string]string
+	for k, v := range pp.Args {
+		if k == tokenArg {
+			continue
+		}
+		if args == nil {
+			args = make(map[string]string, len(pp.Args))
+		}
+		args[k] = v
+	}
+
+	return &Peer{
+		PeerID:     pp.PeerID,
+		RemoteAddr: pp.RemoteAddr,
+		Domain:     pp.Domain,
+		URI:        pp.URI,
+		Args:       args,
+		Backup:     ev.Role == router.SessionRoleBackup,
+	}
+}
+
+func routerEvent(typ, namespace, routerID string, err error) *Event {
+	e := newEvent(typ, namespace)
+	e.RouterID = routerID
+	e.Error = errString(err)
+
+	return e
+}
+
+// sessionEvent returns the publish or play event of a session joining or
+// leaving its router.
+func sessionEvent(joined bool, ev router.SessionEvent) *Event {
+	var typ string
+	switch {
+	case ev.Role == router.SessionRoleSubscriber && joined:
+		typ = TypePlayStarted
+	case ev.Role == router.SessionRoleSubscriber:
+		typ = TypePlayStopped
+	case joined:
+		typ = TypePublishStarted
+	default:
+		typ = TypePublishStopped
+	}
+
+	e := newEvent(typ, ev.Namespace)
+	e.RouterID = ev.RouterID
+	e.SessionID = ev.SessionID
+	e.Peer = newPeer(ev)
+
+	return e
+}
+
+// on subscribes h to the events of type T, queued past the size of the
+// event queue since a webhook must not miss them.
+func on[T any](h func(ev T)) {
+	core.SetEventOptions[T](eventemitter.EventOptions{
+		Dispatch: eventemitter.DispatchAsync,
+		Overflow: eventemitter.OverflowUnbounded,
+	})
+	core.Subscribe(h)
+}
+
+// subscribe turns the core events into the events of the webhooks.
+func subscribe(dispatch func(e *Event)) {
+	on(func(ev router.NamespaceCreated) {
+		dispatch(newEvent(TypeNamespaceCreated, ev.Namespace))
+	})
+	on(func(ev router.NamespaceClosed) {
+		dispatch(newEvent(TypeNamespaceClosed, ev.Namespace))
+	})
+	on(func(ev router.RouterCreated) {
+		dispatch(routerEvent(TypeRouterCreated, ev.Namespace, ev.RouterID, nil))
+	})
+	on(func(ev router.RouterClosed) {
+		dispatch(routerEvent(TypeRouterClosed, ev.Namespace, ev.RouterID, ev.Err))
+	})
+	on(func(ev router.RouterIdleTimeout) {
+		dispatch(routerEvent(TypeRouterIdleTimeout, ev.Namespace, ev.RouterID, nil))
+	})
+	on(func(ev router.SessionJoined) {
+		dispatch(sessionEvent(true, router.SessionEvent(ev)))
+	})
+	on(func(ev router.SessionLeft) {
+		dispatch(sessionEvent(false, router.SessionEvent(ev)))
+	})
+	on(func(ev router.ProducerConflict) {
+		if ev.Policy != router.ProducerConflictKickOld {
+			return
+		}
+
+		e := routerEvent(TypeProducerReplaced, ev.Namespace, ev.RouterID, nil)
+		e.SessionID = ev.Incoming
+		e.Replaced = ev.Producer
+		dispatch(e)
+	})
+}
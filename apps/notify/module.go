@@ -1 +1,263 @@
 package notify
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/let-light/gomodule"
+	feature_notify "github.com/pingostack/neon/features/notify"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultQueueDir         = "data/notify"
+	defaultQueueSize        = 10000
+	defaultTimeout          = 5 * time.Second
+	defaultMaxRetries       = 10
+	defaultRetryInterval    = time.Second
+	defaultMaxRetryInterval = time.Minute
+)
+
+var notifyModule *notify
+
+type WebhookSettings struct {
+	URL string `json:"url" mapstructure:"url"`
+	// Secret signs the deliveries, unsigned if empty
+	Secret string `json:"secret" mapstructure:"secret"`
+	// Events are the event types sent, all if empty
+	Events []string `json:"events" mapstructure:"events"`
+}
+
+type NotifySettings struct {
+	Webhooks []WebhookSettings `json:"webhooks" mapstructure:"webhooks"`
+	// QueueDir keeps the events not delivered yet, a directory per webhook
+	QueueDir string `json:"queueDir" mapstructure:"queueDir"`
+	// QueueSize bounds the events kept for a webhook, the oldest are
+	// dropped past it
+	QueueSize          int `json:"queueSize" mapstructure:"queueSize"`
+	TimeoutMs          int `json:"timeoutMs" mapstructure:"timeoutMs"`
+	MaxRetries         int `json:"maxRetries" mapstructure:"maxRetries"`
+	RetryIntervalMs    int `json:"retryIntervalMs" mapstructure:"retryIntervalMs"`
+	MaxRetryIntervalMs int `json:"maxRetryIntervalMs" mapstructure:"maxRetryIntervalMs"`
+}
+
+type notify struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings NotifySettings
+	settings    *NotifySettings
+	logger      *logrus.Entry
+	webhooks    []*webhook
+	// pending are the events not queued on the webhooks yet, they are
+	// written to disk off the goroutine of the event emitter
+	lock     sync.Mutex
+	cond     *sync.Cond
+	pending  []*Event
+	disabled bool
+}
+
+func init() {
+	notifyModule = &notify{
+		logger: logrus.WithField("module", "notify"),
+	}
+}
+
+func NotifyModule() *notify {
+	return notifyModule
+}
+
+func (n *notify) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	n.ctx = ctx
+	n.cond = sync.NewCond(&n.lock)
+	// subscribed before the modules run, the first events are kept until
+	// the webhooks are open
+	subscribe(n.post)
+	return &n.preSettings, nil
+}
+
+func (n *notify) InitCommand() ([]*cobra.Command, error) {
+
+	return nil, nil
+}
+
+func (n *notify) ConfigChanged() {
+	if n.settings == nil {
+		n.settings = &n.preSettings
+	}
+}
+
+func durationMs(ms int, def time.Duration) time.Duration {
+	if ms <= 0 {
+		return def
+	}
+
+	return time.Duration(ms) * time.Millisecond
+}
+
+// newWebhook opens the queue of a webhook, named after its url so that
+// the events left are found again after a restart.
+func (n *notify) newWebhook(ws WebhookSettings) (*webhook, error) {
+	sum := sha1.Sum([]byte(ws.URL))
+	id := hex.EncodeToString(sum[:])[:12]
+	logger := n.logger.WithFields(logrus.Fields{
+		"webhook": ws.URL,
+	})
+
+	dir := n.settings.QueueDir
+	if dir == "" {
+		dir = defaultQueueDir
+	}
+
+	size := n.settings.QueueSize
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+
+	q, err := openQueue(filepath.Join(dir, id), size, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &webhook{
+		url:    ws.URL,
+		secret: ws.Secret,
+		queue:  q,
+		client: &http.Client{
+			Timeout: durationMs(n.settings.TimeoutMs, defaultTimeout),
+		},
+		retry: retryPolicy{
+			maxRetries:  n.settings.MaxRetries,
+			interval:    durationMs(n.settings.RetryIntervalMs, defaultRetryInterval),
+			maxInterval: durationMs(n.settings.MaxRetryIntervalMs, defaultMaxRetryInterval),
+		},
+		logger: logger,
+	}
+
+	if w.retry.maxRetries <= 0 {
+		w.retry.maxRetries = defaultMaxRetries
+	}
+
+	if len(ws.Events) > 0 {
+		w.events = make(map[string]bool, len(ws.Events))
+		for _, typ := range ws.Events {
+			w.events[typ] = true
+		}
+	}
+
+	return w, nil
+}
+
+// post keeps an event for dispatch, without blocking the event emitter.
+func (n *notify) post(e *Event) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.disabled {
+		return
+	}
+
+	n.pending = append(n.pending, e)
+	n.cond.Signal()
+}
+
+// run dispatches the posted events until the module is closed.
+func (n *notify) run() {
+	go func() {
+		<-n.ctx.Done()
+		n.lock.Lock()
+		n.disabled = true
+		n.cond.Broadcast()
+		n.lock.Unlock()
+	}()
+
+	for {
+		n.lock.Lock()
+		for len(n.pending) == 0 && !n.disabled {
+			n.cond.Wait()
+		}
+		pending := n.pending
+		n.pending = nil
+		n.lock.Unlock()
+
+		for _, e := range pending {
+			n.dispatch(e)
+		}
+
+		if n.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// dispatch queues an event on the webhooks accepting its type.
+func (n *notify) dispatch(e *Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		n.logger.WithError(err).Error("failed to encode event")
+		return
+	}
+
+	for _, w := range n.webhooks {
+		if !w.accepts(e.Type) {
+			continue
+		}
+
+		if err := w.queue.push(body); err != nil {
+			w.logger.WithError(err).Errorf("failed to queue event %s", e.Type)
+		}
+	}
+}
+
+func (n *notify) ModuleRun() {
+	// the queue of a webhook is named after its url, a url is only
+	// notified once
+	urls := make(map[string]bool, len(n.settings.Webhooks))
+	for _, ws := range n.settings.Webhooks {
+		if ws.URL == "" {
+			continue
+		}
+
+		if urls[ws.URL] {
+			n.logger.Errorf("webhook %s configured twice, merge its events, only the first kept", ws.URL)
+			continue
+		}
+		urls[ws.URL] = true
+
+		w, err := n.newWebhook(ws)
+		if err != nil {
+			n.logger.WithError(err).Errorf("webhook %s disabled", ws.URL)
+			continue
+		}
+
+		n.webhooks = append(n.webhooks, w)
+	}
+
+	if len(n.webhooks) == 0 {
+		n.lock.Lock()
+		n.disabled = true
+		n.pending = nil
+		n.lock.Unlock()
+		n.logger.Info("notify disabled")
+		return
+	}
+
+	go n.run()
+
+	for _, w := range n.webhooks {
+		go w.run(n.ctx)
+	}
+
+	<-n.ctx.Done()
+	n.logger.Info("notify closing")
+}
+
+func (n *notify) Type() interface{} {
+	return feature_notify.Type()
+}
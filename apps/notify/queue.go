@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	queueFileExt = ".json"
+	queueTmpExt  = ".tmp"
+)
+
+// queue keeps the events of a webhook on disk until they are delivered,
+// one file per event named by its sequence so that the order survives a
+// restart. Past max events the oldest ones are dropped.
+type queue struct {
+	dir    string
+	max    int
+	lock   sync.Mutex
+	files  []string
+	seq    uint64
+	notify chan struct{}
+	logger *logrus.Entry
+}
+
+func openQueue(dir string, max int, logger *logrus.Entry) (*queue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed to create queue directory")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read queue directory")
+	}
+
+	q := &queue{
+		dir:    dir,
+		max:    max,
+		notify: make(chan struct{}, 1),
+		logger: logger,
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case strings.HasSuffix(name, queueTmpExt):
+			// an event was being written when the server stopped
+			os.Remove(filepath.Join(dir, name))
+		case strings.HasSuffix(name, queueFileExt):
+			seq, err := strconv.ParseUint(strings.TrimSuffix(name, queueFileExt), 10, 64)
+			if err != nil {
+				continue
+			}
+			q.files = append(q.files, name)
+			if seq > q.seq {
+				q.seq = seq
+			}
+		}
+	}
+
+	sort.Strings(q.files)
+
+	if len(q.files) > 0 {
+		q.logger.Infof("%d events left to deliver", len(q.files))
+		q.signal()
+	}
+
+	return q, nil
+}
+
+func (q *queue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// push writes an event at the end of the queue.
+func (q *queue) push(data []byte) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for len(q.files) >= q.max {
+		q.logger.Warnf("queue full, dropping event %s", q.files[0])
+		os.Remove(filepath.Join(q.dir, q.files[0]))
+		q.files = q.files[1:]
+	}
+
+	q.seq++
+	name := fmt.Sprintf("%020d%s", q.seq, queueFileExt)
+	path := filepath.Join(q.dir, name)
+
+	if err := os.WriteFile(path+queueTmpExt, data, 0o644); err != nil {
+		return errors.Wrap(err, "failed to write event")
+	}
+
+	if err := os.Rename(path+queueTmpExt, path); err != nil {
+		os.Remove(path + queueTmpExt)
+		return errors.Wrap(err, "failed to write event")
+	}
+
+	q.files = append(q.files, name)
+	q.signal()
+
+	return nil
+}
+
+// peek returns the oldest event, false if the queue is empty.
+func (q *queue) peek() (string, []byte, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for len(q.files) > 0 {
+		name := q.files[0]
+		data, err := os.ReadFile(filepath.Join(q.dir, name))
+		if err == nil {
+			return name, data, true
+		}
+
+		q.logger.WithError(err).Warnf("dropping unreadable event %s", name)
+		os.Remove(filepath.Join(q.dir, name))
+		q.files = q.files[1:]
+	}
+
+	return "", nil, false
+}
+
+// remove deletes an event once delivered or given up, unless it was
+// dropped meanwhile.
+func (q *queue) remove(name string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if len(q.files) == 0 || q.files[0] != name {
+		return
+	}
+
+	os.Remove(filepath.Join(q.dir, name))
+	q.files = q.files[1:]
+}
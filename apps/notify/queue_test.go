@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func testQueue(t *testing.T, dir string, max int) *queue {
+	q, err := openQueue(dir, max, logrus.NewEntry(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return q
+}
+
+// drain removes the events of q in order and returns them.
+func drain(q *queue) []string {
+	var events []string
+	for {
+		name, data, ok := q.peek()
+		if !ok {
+			return events
+		}
+
+		events = append(events, string(data))
+		q.remove(name)
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	q := testQueue(t, t.TempDir(), 10)
+	for _, e := range []string{"a", "b", "c"} {
+		if err := q.push([]byte(e)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-q.notify:
+	default:
+		t.Error("push did not signal")
+	}
+
+	if got := drain(q); len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("events = %v, want [a b c]", got)
+	}
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	q := testQueue(t, dir, 10)
+	for _, e := range []string{"a", "b"} {
+		q.push([]byte(e))
+	}
+
+	// an event half written when the server stopped
+	os.WriteFile(filepath.Join(dir, "00000000000000000009.json.tmp"), []byte("x"), 0o644)
+
+	q = testQueue(t, dir, 10)
+	select {
+	case <-q.notify:
+	default:
+		t.Error("pending events not signaled")
+	}
+
+	q.push([]byte("c"))
+	if got := drain(q); len(got) != 3 || got[0] != "a" || got[2] != "c" {
+		t.Errorf("events = %v, want [a b c]", got)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files left in the queue directory", len(entries))
+	}
+}
+
+func TestQueueDropsOldest(t *testing.T) {
+	q := testQueue(t, t.TempDir(), 2)
+	for _, e := range []string{"a", "b", "c"} {
+		q.push([]byte(e))
+	}
+
+	if got := drain(q); len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Errorf("events = %v, want [b c]", got)
+	}
+}
+
+func TestQueueRemoveDropped(t *testing.T) {
+	q := testQueue(t, t.TempDir(), 1)
+	q.push([]byte("a"))
+	name, _, _ := q.peek()
+
+	// a is dropped while being delivered, removing it must keep b
+	q.push([]byte("b"))
+	q.remove(name)
+
+	if got := drain(q); len(got) != 1 || got[0] != "b" {
+		t.Errorf("events = %v, want [b]", got)
+	}
+}
@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Headers of a delivery, the signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" with the secret of the webhook.
+const (
+	HeaderEvent     = "X-Neon-Event"
+	HeaderDelivery  = "X-Neon-Delivery"
+	HeaderTimestamp = "X-Neon-Timestamp"
+	HeaderSignature = "X-Neon-Signature"
+)
+
+// Sign returns the signature header value of a body sent at timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type retryPolicy struct {
+	maxRetries  int
+	interval    time.Duration
+	maxInterval time.Duration
+}
+
+// backoff returns the wait before the retry following attempt, doubled at
+// each attempt up to the max interval.
+func (rp retryPolicy) backoff(attempt int) time.Duration {
+	d := rp.interval
+	for i := 0; i < attempt && d < rp.maxInterval; i++ {
+		d *= 2
+	}
+
+	if d > rp.maxInterval {
+		d = rp.maxInterval
+	}
+
+	return d
+}
+
+// webhook delivers the events it accepts in order, an event is retried
+// until it is acknowledged with a 2xx or its retries are exhausted.
+type webhook struct {
+	url    string
+	secret string
+	// events are the types accepted, all if nil
+	events map[string]bool
+	queue  *queue
+	client *http.Client
+	retry  retryPolicy
+	logger *logrus.Entry
+}
+
+func (w *webhook) accepts(typ string) bool {
+	return w.events == nil || w.events[typ]
+}
+
+func (w *webhook) run(ctx context.Context) {
+	for {
+		name, data, ok := w.queue.peek()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.queue.notify:
+				continue
+			}
+		}
+
+		if !w.deliver(ctx, name, data) {
+			return
+		}
+
+		w.queue.remove(name)
+	}
+}
+
+// deliver sends an event until it is delivered or given up, false if the
+// context is done meanwhile and the event must stay queued.
+func (w *webhook) deliver(ctx context.Context, name string, data []byte) bool {
+	for attempt := 0; ; attempt++ {
+		err := w.send(ctx, data)
+		if err == nil {
+			return true
+		}
+
+		if ctx.Err() != nil {
+			return false
+		}
+
+		if attempt >= w.retry.maxRetries {
+			w.logger.WithError(err).Errorf("giving up event %s after %d attempts", name, attempt+1)
+			return true
+		}
+
+		wait := w.retry.backoff(attempt)
+		w.logger.WithError(err).Warnf("failed to deliver event %s, retrying in %s", name, wait)
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return false
+		case <-t.C:
+		}
+	}
+}
+
+func (w *webhook) send(ctx context.Context, data []byte) error {
+	var head struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	}
+	json.Unmarshal(data, &head)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, head.Type)
+	req.Header.Set(HeaderDelivery, head.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if w.secret != "" {
+		req.Header.Set(HeaderSignature, Sign(w.secret, timestamp, data))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook status %d", resp.StatusCode)
+	}
+
+	return nil
+}
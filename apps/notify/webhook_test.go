@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestSign(t *testing.T) {
+	want := "sha256=086f6aff7bd084c98679825129c5a64dbad88c760016d6d2c0fb123f27951d54"
+	if got := Sign("secret", "1700000000", []byte(`{"id":"1"}`)); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+
+	if Sign("other", "1700000000", []byte(`{"id":"1"}`)) == want {
+		t.Error("signature does not depend on the secret")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	rp := retryPolicy{maxRetries: 5, interval: time.Second, maxInterval: 5 * time.Second}
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if got := rp.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestWebhookDeliver(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts := r.Header.Get(HeaderTimestamp)
+		if r.Header.Get(HeaderSignature) != Sign("secret", ts, body) {
+			t.Errorf("bad signature %s", r.Header.Get(HeaderSignature))
+		}
+
+		if r.Header.Get(HeaderEvent) != "stream.published" || r.Header.Get(HeaderDelivery) != "1" {
+			t.Errorf("headers = %v", r.Header)
+		}
+
+		// the first attempt fails
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	w := &webhook{
+		url:    srv.URL,
+		secret: "secret",
+		queue:  testQueue(t, t.TempDir(), 10),
+		client: srv.Client(),
+		retry:  retryPolicy{maxRetries: 2, interval: time.Millisecond, maxInterval: time.Millisecond},
+		logger: logrus.NewEntry(logrus.New()),
+	}
+
+	if !w.deliver(context.Background(), "e", []byte(`{"id":"1","type":"stream.published"}`)) {
+		t.Fatal("deliver = false, want true")
+	}
+
+	if n := calls.Load(); n != 2 {
+		t.Errorf("%d attempts, want 2", n)
+	}
+}
+
+func TestWebhookDeliverCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+
+	w := &webhook{
+		url:    srv.URL,
+		queue:  testQueue(t, t.TempDir(), 10),
+		client: srv.Client(),
+		retry:  retryPolicy{maxRetries: 10, interval: time.Hour, maxInterval: time.Hour},
+		logger: logrus.NewEntry(logrus.New()),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the event stays queued for the next start
+	if w.deliver(ctx, "e", []byte(`{"id":"1"}`)) {
+		t.Error("deliver = true, want false")
+	}
+}
@@ -24,6 +24,15 @@ type PMSSettings struct {
 	httpserv.HttpParams    `json:"http" mapstructure:"http"`
 	KeyFrameIntervalSecond time.Duration `json:"keyFrameIntervalSeconds" mapstructure:"keyFrameIntervalSeconds"`
 	JoinTimeoutSecond      time.Duration `json:"joinTimeoutSeconds" mapstructure:"joinTimeoutSeconds"`
+	// MuteKeepalive sends silence and black pictures in place of the
+	// tracks muted by stream.mute
+	MuteKeepalive bool `json:"muteKeepalive" mapstructure:"muteKeepalive"`
+	// PingIntervalSecond is the interval of the pings of the websockets, a
+	// socket silent for 3 intervals is closed
+	PingIntervalSecond time.Duration `json:"pingIntervalSeconds" mapstructure:"pingIntervalSeconds"`
+	// GraceSecond is how long the sessions of a closed websocket wait for
+	// a session.resume before they are closed
+	GraceSecond time.Duration `json:"graceSeconds" mapstructure:"graceSeconds"`
 }
 
 type pms struct {
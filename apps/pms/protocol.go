@@ -1,23 +1,87 @@
 package pms
 
+import (
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pion/webrtc/v4"
+)
+
+// Methods of Request and Response. Over a websocket the server pushes
+// ice.candidate, stream.metadata, renegotiate, session.closed and ping
+// responses, the client sends ice.candidate requests with its candidates,
+// renegotiate requests with the answers to the offers pushed and pong
+// requests to the pings.
+const (
+	MethodPublish       = "stream.publish"
+	MethodPlay          = "stream.play"
+	MethodClose         = "stream.close"
+	MethodMute          = "stream.mute"
+	MethodMaxBitrate    = "stream.max_bitrate"
+	MethodMetadata      = "stream.metadata"
+	MethodICECandidate  = "ice.candidate"
+	MethodRenegotiate   = "renegotiate"
+	MethodSessionClosed = "session.closed"
+	// MethodSessionResume binds a session of a closed websocket to a new
+	// one
+	MethodSessionResume = "session.resume"
+	MethodPing          = "ping"
+	MethodPong          = "pong"
+)
+
+// Error codes of Response.Err.
+const (
+	ErrCodeOK              = 0
+	ErrCodeBadRequest      = 400
+	ErrCodeUnauthorized    = 401
+	ErrCodeForbidden       = 403
+	ErrCodeSessionNotFound = 404
+	ErrCodeUnknownMethod   = 405
+	ErrCodeInternal        = 500
+	ErrCodeNotSupported    = 501
+)
+
 type Request struct {
 	Version string `json:"version"`
 	Method  string `json:"method"`
 	Stream  string `json:"stream"`
+	// Session names the session of the response to the publish or play
+	// in the requests that follow, only its owner may use it
 	Session string `json:"session"`
-	Data    struct {
-		SDP        string `json:"sdp"`
-		MaxBitrate int    `json:"max_bitrate"`
+	// Token authorizes the publish or play, it takes over the token query
+	// argument
+	Token string `json:"token,omitempty"`
+	Data  struct {
+		SDP string `json:"sdp"`
+		// MaxBitrate is the cap of stream.max_bitrate in bits per second,
+		// 0 lifts it
+		MaxBitrate int `json:"max_bitrate"`
+		// Audio and Video are muted by stream.mute, false unmutes them
+		Audio bool `json:"audio"`
+		Video bool `json:"video"`
+		// Candidate is the remote candidate of ice.candidate
+		Candidate *webrtc.ICECandidateInit `json:"candidate,omitempty"`
+		// Secret of the publish or play response resumes its session
+		// with session.resume, the token of the session does too
+		Secret string `json:"secret,omitempty"`
 	} `json:"data"`
 }
 
+type ResponseData struct {
+	SDP string `json:"sdp"`
+	// Secret of a publish or play response is only sent to the owner of
+	// the session, session.resume requires it or the token
+	Secret string `json:"secret,omitempty"`
+	// Candidate is the local candidate of a pushed ice.candidate
+	Candidate *webrtc.ICECandidateInit `json:"candidate,omitempty"`
+	// Metadata is the media of the producer of a pushed stream.metadata
+	Metadata *deliver.Metadata `json:"metadata,omitempty"`
+}
+
 type Response struct {
-	Version string `json:"version"`
-	Method  string `json:"method"`
-	Err     int    `json:"err"`
-	ErrMsg  string `json:"err_msg"`
-	Session string `json:"session"`
-	Data    struct {
-		SDP string `json:"sdp"`
-	} `json:"data"`
+	Version string       `json:"version"`
+	Method  string       `json:"method"`
+	Err     int          `json:"err"`
+	ErrMsg  string       `json:"err_msg"`
+	Session string       `json:"session"`
+	Stream  string       `json:"stream,omitempty"`
+	Data    ResponseData `json:"data"`
 }
@@ -3,23 +3,53 @@ package pms
 import (
 	"context"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gogf/gf/util/guid"
+	"github.com/pingostack/neon/internal/core/middleware"
 	"github.com/pingostack/neon/internal/core/router"
 	"github.com/pingostack/neon/internal/httpserv"
 	inter_rtc "github.com/pingostack/neon/internal/rtc"
+	"github.com/pingostack/neon/pkg/deliver"
 	"github.com/pingostack/neon/pkg/deliver/rtc"
+	"github.com/pion/webrtc/v4"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// tokenArg is the query argument of the token of a request.
+const tokenArg = "token"
+
 type SignalServer struct {
 	*httpserv.SignalServer
-	ctx    context.Context
-	logger *logrus.Entry
+	ctx      context.Context
+	logger   *logrus.Entry
+	sessions *sessions
+}
+
+// call is a request with the http request or the websocket it came from.
+type call struct {
+	Request
+	remoteAddr string
+	host       string
+	path       string
+	query      url.Values
+	// conn is the websocket of the request, nil over http
+	conn  *wsConn
+	write func(resp Response)
+}
+
+func (c *call) reply(code int, msg string) {
+	c.write(Response{
+		Version: c.Version,
+		Method:  c.Method,
+		Err:     code,
+		ErrMsg:  msg,
+		Session: c.Session,
+	})
 }
 
 func NewSignalServer(ctx context.Context, logger *logrus.Entry) *SignalServer {
@@ -27,6 +57,7 @@ func NewSignalServer(ctx context.Context, logger *logrus.Entry) *SignalServer {
 		SignalServer: httpserv.NewSignalServer(ctx, settings().HttpParams, logger),
 		ctx:          ctx,
 		logger:       logger,
+		sessions:     newSessions(),
 	}
 }
 
@@ -41,6 +72,12 @@ func (ss *SignalServer) Close() error {
 func (ss *SignalServer) handleRequest(gc *gin.Context) {
 	ss.logger.Infof("request: %s %s", gc.Request.Method, gc.Request.URL.String())
 
+	if strings.EqualFold(gc.Request.Method, http.MethodGet) &&
+		strings.EqualFold(gc.GetHeader("Upgrade"), "websocket") {
+		ss.serveWebSocket(gc)
+		return
+	}
+
 	if !strings.EqualFold(gc.Request.Method, http.MethodPost) {
 		gc.JSON(http.StatusMethodNotAllowed, gin.H{
 			"message": "method not allowed",
@@ -56,140 +93,364 @@ func (ss *SignalServer) handleRequest(gc *gin.Context) {
 		return
 	}
 
-	if err := ss.handleRequestInternal(req, gc); err != nil {
-		gc.JSON(http.StatusInternalServerError, gin.H{
-			"message": "internal server error",
-		})
+	c := &call{
+		Request:    req,
+		remoteAddr: gc.Request.RemoteAddr,
+		host:       gc.Request.Host,
+		path:       gc.Request.URL.Path,
+		query:      gc.Request.URL.Query(),
+		write: func(resp Response) {
+			gc.JSON(http.StatusOK, resp)
+		},
+	}
+
+	if err := ss.handleCall(c); err != nil {
+		switch {
+		case errors.Is(err, middleware.ErrUnauthorized):
+			gc.JSON(http.StatusUnauthorized, gin.H{
+				"message": "unauthorized",
+			})
+		case errors.Is(err, middleware.ErrForbidden):
+			gc.JSON(http.StatusForbidden, gin.H{
+				"message": "forbidden",
+			})
+		default:
+			gc.JSON(http.StatusInternalServerError, gin.H{
+				"message": "internal server error",
+			})
+		}
 		return
 	}
 
 }
 
-func (ss *SignalServer) handleRequestInternal(req Request, gc *gin.Context) error {
-	switch req.Method {
-	case "stream.publish":
-		return ss.publish(req, gc)
-	case "stream.play":
-		return ss.play(req, gc)
-	case "stream.close":
-		return ss.close(req, gc)
-	case "stream.mute":
-		return ss.mute(req, gc)
-	case "stream.max_bitrate":
-		return ss.maxBitrate(req, gc)
+// handleCall replies to the request of c, the errors returned are those
+// of a publish or play that failed and were not replied.
+func (ss *SignalServer) handleCall(c *call) error {
+	switch c.Method {
+	case MethodPublish:
+		return ss.publish(c)
+	case MethodPlay:
+		return ss.play(c)
+	case MethodClose:
+		return ss.close(c)
+	case MethodMute:
+		return ss.mute(c)
+	case MethodMaxBitrate:
+		return ss.maxBitrate(c)
+	case MethodICECandidate:
+		return ss.iceCandidate(c)
+	case MethodRenegotiate:
+		return ss.renegotiate(c)
+	case MethodSessionResume:
+		return ss.resume(c)
 	}
 
+	c.reply(ErrCodeUnknownMethod, "unknown method")
+
 	return nil
 }
 
-func (ss *SignalServer) publish(req Request, gc *gin.Context) error {
-	peerID := req.Session
-	if peerID == "" {
-		peerID = guid.S()
+// errCode is the Response.Err of the error of a publish or play, what the
+// http status of the error is over http.
+func errCode(err error) int {
+	switch {
+	case errors.Is(err, middleware.ErrUnauthorized):
+		return ErrCodeUnauthorized
+	case errors.Is(err, middleware.ErrForbidden):
+		return ErrCodeForbidden
 	}
+
+	return ErrCodeInternal
+}
+
+func (ss *SignalServer) newServSession(c *call, peerID string, producer bool) *rtc.ServSession {
 	logger := ss.logger.WithFields(logrus.Fields{
 		"session": peerID,
-		"router":  req.Stream,
+		"router":  c.Stream,
 	})
-	domain := gc.Request.Host
+	domain := c.host
 	sp := strings.Split(domain, ":")
 	if len(sp) > 0 {
 		domain = sp[0]
 	}
 
-	s := rtc.NewServSession(ss.ctx, inter_rtc.StreamFactory(), router.PeerParams{
-		RemoteAddr: gc.Request.RemoteAddr,
-		LocalAddr:  gc.Request.Host,
+	return rtc.NewServSession(ss.ctx, inter_rtc.StreamFactory(), router.PeerParams{
+		RemoteAddr: c.remoteAddr,
+		LocalAddr:  c.host,
 		PeerID:     peerID,
-		RouterID:   req.Stream,
+		RouterID:   c.Stream,
 		Domain:     domain,
-		URI:        gc.Request.URL.Path,
-		Producer:   true,
+		URI:        c.path,
+		Args:       requestArgs(c),
+		Producer:   producer,
 	}, logger)
+}
 
-	lsdp, err := s.Publish(settings().KeyFrameIntervalSecond*time.Second, req.Data.SDP)
+func (ss *SignalServer) publish(c *call) error {
+	peerID := guid.S()
+
+	s := ss.newServSession(c, peerID, true)
+	lsdp, err := s.Publish(settings().KeyFrameIntervalSecond*time.Second, c.Data.SDP)
 	if err != nil {
-		logger.WithError(err).Error("failed to publish")
+		ss.logger.WithField("session", peerID).WithError(err).Error("failed to publish")
 		return errors.Wrap(err, "failed to publish")
 	}
 
-	resp := Response{
-		Version: req.Version,
-		Method:  req.Method,
-		Err:     0,
+	sess := ss.sessions.add(c.Stream, peerID, requestToken(c), s)
+	ss.watch(c, sess)
+	ss.logger.WithField("answer", lsdp.SDP).Debug("resp answer")
+	c.write(Response{
+		Version: c.Version,
+		Method:  c.Method,
+		Err:     ErrCodeOK,
 		ErrMsg:  "",
 		Session: peerID,
-		Data: struct {
-			SDP string `json:"sdp"`
-		}{
-			SDP: lsdp.SDP,
+		Data: ResponseData{
+			SDP:    lsdp.SDP,
+			Secret: sess.secret,
 		},
+	})
+
+	return nil
+}
+
+func (ss *SignalServer) play(c *call) error {
+	peerID := guid.S()
+
+	s := ss.newServSession(c, peerID, false)
+	lsdp, err := s.Subscribe(c.Data.SDP, settings().JoinTimeoutSecond*time.Second)
+	if err != nil {
+		ss.logger.WithField("session", peerID).WithError(err).Error("failed to subscribe")
+		return errors.Wrap(err, "failed to subscribe")
 	}
 
-	logger.WithField("answer", lsdp.SDP).Debug("resp answer")
-	gc.JSON(http.StatusOK, resp)
+	sess := ss.sessions.add(c.Stream, peerID, requestToken(c), s)
+	sess.OnMetadata(func(md deliver.Metadata) {
+		ss.metadataChanged(sess, md)
+	})
+	ss.watch(c, sess)
+	ss.logger.WithField("answer", lsdp.SDP).Debug("resp answer")
+	c.write(Response{
+		Version: c.Version,
+		Method:  c.Method,
+		Err:     ErrCodeOK,
+		ErrMsg:  "",
+		Session: peerID,
+		Data: ResponseData{
+			SDP:    lsdp.SDP,
+			Secret: sess.secret,
+		},
+	})
 
 	return nil
 }
 
-func (ss *SignalServer) play(req Request, gc *gin.Context) error {
-	peerID := req.Session
-	if peerID == "" {
-		peerID = guid.S()
-	}
-	logger := ss.logger.WithFields(logrus.Fields{
-		"session": peerID,
-		"router":  req.Stream,
+// watch pushes the candidates of a session gathered after its answer,
+// the session of a websocket request is bound to the socket.
+func (ss *SignalServer) watch(c *call, sess *session) {
+	sess.OnICECandidate(func(candidate webrtc.ICECandidateInit) {
+		sess.push(Response{
+			Method: MethodICECandidate,
+			Data: ResponseData{
+				Candidate: &candidate,
+			},
+		})
 	})
-	domain := gc.Request.Host
-	sp := strings.Split(domain, ":")
-	if len(sp) > 0 {
-		domain = sp[0]
+
+	if c.conn != nil {
+		sess.bind(c.conn)
 	}
+}
 
-	s := rtc.NewServSession(ss.ctx, inter_rtc.StreamFactory(), router.PeerParams{
-		RemoteAddr: gc.Request.RemoteAddr,
-		LocalAddr:  gc.Request.Host,
-		PeerID:     peerID,
-		RouterID:   req.Stream,
-		Domain:     domain,
-		URI:        gc.Request.URL.Path,
-		Producer:   true,
-	}, logger)
+// metadataChanged pushes the media of the producer of a subscriber, and
+// the offer of the tracks it lacks.
+func (ss *SignalServer) metadataChanged(sess *session, md deliver.Metadata) {
+	sess.push(Response{
+		Method: MethodMetadata,
+		Data: ResponseData{
+			Metadata: &md,
+		},
+	})
 
-	lsdp, err := s.Subscribe(req.Data.SDP, settings().JoinTimeoutSecond*time.Second)
-	if err != nil {
-		logger.WithError(err).Error("failed to subscribe")
-		return errors.Wrap(err, "failed to subscribe")
+	// only a socket carries the offer
+	if !sess.bound() {
+		return
 	}
 
-	resp := Response{
-		Version: req.Version,
-		Method:  req.Method,
-		Err:     0,
-		ErrMsg:  "",
-		Session: peerID,
-		Data: struct {
-			SDP string `json:"sdp"`
-		}{
+	lsdp, err := sess.Renegotiate(md)
+	if err != nil || lsdp == nil {
+		return
+	}
+
+	ss.logger.WithField("session", sess.id).Info("session renegotiating")
+	sess.push(Response{
+		Method: MethodRenegotiate,
+		Data: ResponseData{
 			SDP: lsdp.SDP,
 		},
+	})
+}
+
+// requestArgs returns the query arguments of a request, with the token
+// of its body as the token argument.
+func requestArgs(c *call) map[string]string {
+	args := router.QueryArgs(c.query)
+	if c.Token != "" {
+		args[tokenArg] = c.Token
+	}
+
+	return args
+}
+
+// requestToken is the token of a request, in its body or its query.
+func requestToken(c *call) string {
+	if c.Token != "" {
+		return c.Token
+	}
+
+	return c.query.Get(tokenArg)
+}
+
+// ownedSession returns the session a request names, it is replied and
+// nil is returned unless the request comes from the owner of the session.
+func (ss *SignalServer) ownedSession(c *call) *session {
+	sess := ss.sessions.get(c.Stream, c.Session)
+	if sess == nil {
+		c.reply(ErrCodeSessionNotFound, "session not found")
+		return nil
+	}
+
+	if !sess.owns(c.conn, requestToken(c)) {
+		ss.logger.WithField("session", c.Session).Warnf("%s by another peer denied", c.Method)
+		c.reply(ErrCodeForbidden, "not the owner of the session")
+		return nil
+	}
+
+	return sess
+}
+
+func (ss *SignalServer) close(c *call) error {
+	sess := ss.ownedSession(c)
+	if sess == nil {
+		return nil
+	}
+
+	ss.sessions.remove(sess)
+	sess.Finalize(ErrSessionClosed)
+	c.reply(ErrCodeOK, "")
+
+	return nil
+}
+
+func (ss *SignalServer) mute(c *call) error {
+	sess := ss.ownedSession(c)
+	if sess == nil {
+		return nil
+	}
+
+	if err := sess.Mute(c.Data.Audio, c.Data.Video, settings().MuteKeepalive); err != nil {
+		c.reply(ErrCodeInternal, err.Error())
+		return nil
+	}
+
+	ss.logger.WithFields(logrus.Fields{
+		"session": c.Session,
+		"audio":   c.Data.Audio,
+		"video":   c.Data.Video,
+	}).Info("session muted")
+	c.reply(ErrCodeOK, "")
+
+	return nil
+}
+
+func (ss *SignalServer) maxBitrate(c *call) error {
+	sess := ss.ownedSession(c)
+	if sess == nil {
+		return nil
+	}
+
+	if c.Data.MaxBitrate < 0 {
+		c.reply(ErrCodeBadRequest, "invalid max_bitrate")
+		return nil
 	}
 
-	logger.WithField("answer", lsdp.SDP).Debug("resp answer")
-	gc.JSON(http.StatusOK, resp)
+	err := sess.SetMaxBitrate(uint64(c.Data.MaxBitrate))
+	switch {
+	case errors.Is(err, rtc.ErrLayerSelectionUnsupported):
+		c.reply(ErrCodeNotSupported, err.Error())
+	case err != nil:
+		c.reply(ErrCodeInternal, err.Error())
+	default:
+		ss.logger.WithFields(logrus.Fields{
+			"session": c.Session,
+			"bitrate": c.Data.MaxBitrate,
+		}).Info("session bitrate capped")
+		c.reply(ErrCodeOK, "")
+	}
 
 	return nil
 }
 
-func (ss *SignalServer) close(req Request, gc *gin.Context) error {
+func (ss *SignalServer) iceCandidate(c *call) error {
+	sess := ss.ownedSession(c)
+	if sess == nil {
+		return nil
+	}
+
+	if c.Data.Candidate == nil {
+		c.reply(ErrCodeBadRequest, "no candidate")
+		return nil
+	}
+
+	if err := sess.AddRemoteCandidate(*c.Data.Candidate); err != nil {
+		c.reply(ErrCodeBadRequest, err.Error())
+		return nil
+	}
+
+	c.reply(ErrCodeOK, "")
+
 	return nil
 }
 
-func (ss *SignalServer) mute(req Request, gc *gin.Context) error {
+// renegotiate sets the answer to the offer of a renegotiate push.
+func (ss *SignalServer) renegotiate(c *call) error {
+	sess := ss.ownedSession(c)
+	if sess == nil {
+		return nil
+	}
+
+	if err := sess.AnswerRenegotiation(c.Data.SDP); err != nil {
+		c.reply(ErrCodeBadRequest, err.Error())
+		return nil
+	}
+
+	c.reply(ErrCodeOK, "")
+
 	return nil
 }
 
-func (ss *SignalServer) maxBitrate(req Request, gc *gin.Context) error {
+func (ss *SignalServer) resume(c *call) error {
+	if c.conn == nil {
+		c.reply(ErrCodeNotSupported, "websocket only")
+		return nil
+	}
+
+	sess := ss.sessions.get(c.Stream, c.Session)
+	if sess == nil {
+		c.reply(ErrCodeSessionNotFound, "session not found")
+		return nil
+	}
+
+	if !sess.owns(c.conn, requestToken(c)) && !sess.secretMatches(c.Data.Secret) {
+		ss.logger.WithField("session", c.Session).Warn("resume by another peer denied")
+		c.reply(ErrCodeForbidden, "not the owner of the session")
+		return nil
+	}
+
+	sess.bind(c.conn)
+	ss.logger.WithField("session", c.Session).Info("session resumed")
+	c.reply(ErrCodeOK, "")
+
 	return nil
 }
@@ -0,0 +1,201 @@
+package pms
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver/rtc"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrSessionClosed finalizes the session of a stream.close request.
+	ErrSessionClosed = errors.New("session closed by client")
+	// ErrSocketClosed finalizes the sessions of a websocket closed and
+	// not resumed within the grace period.
+	ErrSocketClosed = errors.New("websocket closed")
+)
+
+// session is a session of a publish or play request, the requests that
+// follow name it by the session of the response and its stream. A session
+// of a websocket request is bound to the socket that pushes its events.
+type session struct {
+	id     string
+	stream string
+	// token is the token the session joined with, it proves its owner
+	token string
+	// secret is only sent to the owner, it resumes the session
+	secret string
+	*rtc.ServSession
+	lock  sync.Mutex
+	conn  *wsConn
+	grace *time.Timer
+}
+
+// push sends resp over the socket of the session, it is dropped while
+// the session has none.
+func (sess *session) push(resp Response) {
+	sess.lock.Lock()
+	conn := sess.conn
+	sess.lock.Unlock()
+
+	if conn == nil {
+		return
+	}
+
+	resp.Session = sess.id
+	resp.Stream = sess.stream
+	conn.send(resp)
+}
+
+func (sess *session) bound() bool {
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	return sess.conn != nil
+}
+
+// owns tells whether a request over conn, nil over http, with token
+// comes from the owner of the session: its socket, or a peer with the
+// token it joined with.
+func (sess *session) owns(conn *wsConn, token string) bool {
+	sess.lock.Lock()
+	bound := sess.conn
+	sess.lock.Unlock()
+
+	if conn != nil && conn == bound {
+		return true
+	}
+
+	return sess.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(sess.token)) == 1
+}
+
+// secretMatches tells whether secret is the one of the session.
+func (sess *session) secretMatches(secret string) bool {
+	return secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(sess.secret)) == 1
+}
+
+// bind makes conn the socket of the session, in place of the socket it
+// had.
+func (sess *session) bind(conn *wsConn) {
+	sess.lock.Lock()
+	if sess.grace != nil {
+		sess.grace.Stop()
+		sess.grace = nil
+	}
+	old := sess.conn
+	sess.conn = conn
+	sess.lock.Unlock()
+
+	if old != nil && old != conn {
+		old.forget(sess)
+	}
+	conn.track(sess)
+}
+
+// unbind detaches the session from its closed socket conn, the session
+// is finalized unless another socket resumes it within grace.
+func (sess *session) unbind(conn *wsConn, grace time.Duration) {
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	if sess.conn != conn {
+		return
+	}
+
+	sess.conn = nil
+	sess.grace = time.AfterFunc(grace, func() {
+		sess.Finalize(ErrSocketClosed)
+	})
+}
+
+// closed pushes the close of the session and detaches it from its
+// socket.
+func (sess *session) closed() {
+	resp := Response{
+		Method: MethodSessionClosed,
+		Err:    ErrCodeOK,
+	}
+	if err := sess.Err(); err != nil && !errors.Is(err, ErrSessionClosed) {
+		resp.Err = ErrCodeInternal
+		resp.ErrMsg = err.Error()
+	}
+	sess.push(resp)
+
+	sess.lock.Lock()
+	if sess.grace != nil {
+		sess.grace.Stop()
+		sess.grace = nil
+	}
+	conn := sess.conn
+	sess.conn = nil
+	sess.lock.Unlock()
+
+	if conn != nil {
+		conn.forget(sess)
+	}
+}
+
+func newSecret() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type sessions struct {
+	lock     sync.RWMutex
+	sessions map[string]*session
+}
+
+func newSessions() *sessions {
+	return &sessions{
+		sessions: make(map[string]*session),
+	}
+}
+
+// add keeps the session until it is closed.
+func (ss *sessions) add(stream, id, token string, s *rtc.ServSession) *session {
+	sess := &session{
+		id:          id,
+		stream:      stream,
+		token:       token,
+		secret:      newSecret(),
+		ServSession: s,
+	}
+
+	ss.lock.Lock()
+	ss.sessions[id] = sess
+	ss.lock.Unlock()
+
+	go func() {
+		<-s.Context().Done()
+		ss.remove(sess)
+		sess.closed()
+	}()
+
+	return sess
+}
+
+func (ss *sessions) get(stream, id string) *session {
+	ss.lock.RLock()
+	defer ss.lock.RUnlock()
+
+	sess := ss.sessions[id]
+	if sess == nil || sess.stream != stream {
+		return nil
+	}
+
+	return sess
+}
+
+func (ss *sessions) remove(sess *session) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if ss.sessions[sess.id] == sess {
+		delete(ss.sessions, sess.id)
+	}
+}
@@ -0,0 +1,207 @@
+package pms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+var errOriginDenied = errors.New("origin denied")
+
+const (
+	defaultPingInterval = 10 * time.Second
+	defaultGrace        = 10 * time.Second
+	// pingsMissed is the number of ping intervals a socket stays silent
+	// before it is closed
+	pingsMissed = 3
+	// maxMessageBytes bounds the requests, sdps included
+	maxMessageBytes = 1 << 20
+)
+
+// wsConn is a websocket of the signaling. It carries the requests and
+// responses of the http signaling, and the pushes of the sessions bound
+// to it. Its sessions outlive it by the grace period, a new socket
+// resumes them with session.resume.
+type wsConn struct {
+	ss        *SignalServer
+	ws        *websocket.Conn
+	ctx       context.Context
+	cancel    context.CancelFunc
+	logger    *logrus.Entry
+	writeLock sync.Mutex
+	lock      sync.Mutex
+	sessions  map[*session]struct{}
+}
+
+func pingInterval() time.Duration {
+	if s := settings().PingIntervalSecond; s > 0 {
+		return s * time.Second
+	}
+
+	return defaultPingInterval
+}
+
+func gracePeriod() time.Duration {
+	if s := settings().GraceSecond; s > 0 {
+		return s * time.Second
+	}
+
+	return defaultGrace
+}
+
+func (ss *SignalServer) serveWebSocket(gc *gin.Context) {
+	// the origin of the socket is checked by its handshake, not left to
+	// the middlewares of the router
+	s := websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			if !ss.OriginAllowed(r.Header.Get("Origin")) {
+				ss.logger.WithField("origin", r.Header.Get("Origin")).Warn("websocket origin denied")
+				return errOriginDenied
+			}
+
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			ss.newWSConn(ws).serve()
+		},
+	}
+
+	s.ServeHTTP(gc.Writer, gc.Request)
+}
+
+func (ss *SignalServer) newWSConn(ws *websocket.Conn) *wsConn {
+	ctx, cancel := context.WithCancel(ss.ctx)
+	ws.MaxPayloadBytes = maxMessageBytes
+
+	return &wsConn{
+		ss:       ss,
+		ws:       ws,
+		ctx:      ctx,
+		cancel:   cancel,
+		logger:   ss.logger.WithField("websocket", ws.Request().RemoteAddr),
+		sessions: make(map[*session]struct{}),
+	}
+}
+
+func (c *wsConn) serve() {
+	c.logger.Info("websocket connected")
+	defer c.close()
+
+	go c.keepalive()
+
+	for {
+		// any message keeps the socket alive, pongs included
+		c.ws.SetReadDeadline(time.Now().Add(pingsMissed * pingInterval()))
+
+		var msg []byte
+		if err := websocket.Message.Receive(c.ws, &msg); err != nil {
+			c.logger.WithError(err).Info("websocket read failed")
+			return
+		}
+
+		req := Request{}
+		if err := json.Unmarshal(msg, &req); err != nil {
+			c.send(Response{
+				Err:    ErrCodeBadRequest,
+				ErrMsg: "bad request",
+			})
+			continue
+		}
+
+		if req.Method == MethodPong {
+			continue
+		}
+
+		c.logger.Infof("request: %s %s", req.Method, req.Stream)
+		c.handle(req)
+	}
+}
+
+func (c *wsConn) handle(req Request) {
+	r := c.ws.Request()
+	call := &call{
+		Request:    req,
+		remoteAddr: r.RemoteAddr,
+		host:       r.Host,
+		path:       r.URL.Path,
+		query:      r.URL.Query(),
+		conn:       c,
+		write:      c.send,
+	}
+
+	if err := c.ss.handleCall(call); err != nil {
+		call.reply(errCode(err), err.Error())
+	}
+}
+
+func (c *wsConn) keepalive() {
+	ticker := time.NewTicker(pingInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.send(Response{
+				Method: MethodPing,
+			})
+		}
+	}
+}
+
+// send writes resp, a socket that fails to write is closed and its read
+// loop ends.
+func (c *wsConn) send(resp Response) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if c.ctx.Err() != nil {
+		return
+	}
+
+	c.ws.SetWriteDeadline(time.Now().Add(pingInterval()))
+	if err := websocket.JSON.Send(c.ws, resp); err != nil {
+		c.logger.WithError(err).Info("websocket write failed")
+		c.cancel()
+		c.ws.Close()
+	}
+}
+
+func (c *wsConn) close() {
+	c.cancel()
+	c.ws.Close()
+
+	c.lock.Lock()
+	sessions := c.sessions
+	c.sessions = make(map[*session]struct{})
+	c.lock.Unlock()
+
+	grace := gracePeriod()
+	for sess := range sessions {
+		sess.unbind(c, grace)
+	}
+
+	c.logger.WithField("sessions", len(sessions)).Info("websocket closed")
+}
+
+func (c *wsConn) track(sess *session) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.sessions[sess] = struct{}{}
+}
+
+func (c *wsConn) forget(sess *session) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.sessions, sess)
+}
@@ -0,0 +1,132 @@
+package rtsp
+
+import (
+	"context"
+
+	"github.com/let-light/gomodule"
+	feature_rtsp "github.com/pingostack/neon/features/rtsp"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var rtspModule *rtsp
+
+type ISignalServer interface {
+	Start() error
+	Close() error
+}
+
+type TcpSettings struct {
+	Multicore    bool `json:"multicore" mapstructure:"multicore"`
+	NumEventLoop int  `json:"numEventLoop" mapstructure:"numEventLoop"`
+	// TCPNoDelay follows gnet, 0 disables Nagle's algorithm and 1 enables it.
+	TCPNoDelay          int  `json:"tcpNoDelay" mapstructure:"tcpNoDelay"`
+	TCPKeepAliveSeconds int  `json:"tcpKeepAliveSeconds" mapstructure:"tcpKeepAliveSeconds"`
+	LockOSThread        bool `json:"lockOSThread" mapstructure:"lockOSThread"`
+	ReusePort           bool `json:"reusePort" mapstructure:"reusePort"`
+	ReuseAddr           bool `json:"reuseAddr" mapstructure:"reuseAddr"`
+	SocketRecvBuffer    int  `json:"socketRecvBuffer" mapstructure:"socketRecvBuffer"`
+	SocketSendBuffer    int  `json:"socketSendBuffer" mapstructure:"socketSendBuffer"`
+}
+
+// HttpTunnelSettings enables RTSP over HTTP on a dedicated port, for
+// viewers behind firewalls that only let HTTP through.
+type HttpTunnelSettings struct {
+	Addr string `json:"addr" mapstructure:"addr"`
+}
+
+type UserSettings struct {
+	User     string `json:"user" mapstructure:"user"`
+	Password string `json:"password" mapstructure:"password"`
+}
+
+type AuthSettings struct {
+	// Scheme is basic or digest.
+	Scheme    string   `json:"scheme" mapstructure:"scheme"`
+	Algorithm string   `json:"algorithm" mapstructure:"algorithm"`
+	Realm     string   `json:"realm" mapstructure:"realm"`
+	Methods   []string `json:"methods" mapstructure:"methods"`
+	// Users is the static credential list, CallbackUrl is asked instead
+	// when set.
+	Users                  []UserSettings `json:"users" mapstructure:"users"`
+	CallbackUrl            string         `json:"callbackUrl" mapstructure:"callbackUrl"`
+	CallbackTimeoutSeconds int            `json:"callbackTimeoutSeconds" mapstructure:"callbackTimeoutSeconds"`
+}
+
+type ServerSettings struct {
+	Addr               string      `json:"addr" mapstructure:"addr"`
+	Tcp                TcpSettings `json:"tcp" mapstructure:"tcp"`
+	JoinTimeoutSeconds int         `json:"joinTimeoutSeconds" mapstructure:"joinTimeoutSeconds"`
+	// IdleTimeoutSeconds is the session timeout announced to the clients,
+	// a connection receiving nothing for that long is closed.
+	IdleTimeoutSeconds int                `json:"idleTimeoutSeconds" mapstructure:"idleTimeoutSeconds"`
+	HttpTunnel         HttpTunnelSettings `json:"httpTunnel" mapstructure:"httpTunnel"`
+	// Auth maps namespaces to their authentication, "*" matches any
+	// namespace.
+	Auth map[string]AuthSettings `json:"auth" mapstructure:"auth"`
+}
+
+type RtspSettings struct {
+	Server ServerSettings `json:"server" mapstructure:"server"`
+}
+
+type rtsp struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings RtspSettings
+	settings    *RtspSettings
+	logger      *logrus.Entry
+	serv        ISignalServer
+}
+
+func init() {
+	rtspModule = &rtsp{
+		logger: logrus.WithField("module", "rtsp"),
+	}
+}
+
+func RtspModule() *rtsp {
+	return rtspModule
+}
+
+func (rtsp *rtsp) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	rtsp.ctx = ctx
+	return &rtsp.preSettings, nil
+}
+
+func (rtsp *rtsp) InitCommand() ([]*cobra.Command, error) {
+
+	return nil, nil
+}
+
+func (rtsp *rtsp) ConfigChanged() {
+	if rtsp.settings == nil {
+		rtsp.settings = &rtsp.preSettings
+	}
+}
+
+func (rtsp *rtsp) ModuleRun() {
+	serv, err := NewServer(rtsp.ctx, rtsp.settings.Server, rtsp.logger)
+	if err != nil {
+		rtsp.logger.Errorf("rtsp server error: %v", err)
+		return
+	}
+
+	rtsp.serv = serv
+	if err := rtsp.serv.Start(); err != nil {
+		rtsp.logger.Errorf("rtsp start error: %v", err)
+		return
+	}
+
+	<-rtsp.ctx.Done()
+	rtsp.close()
+}
+
+func (rtsp *rtsp) Type() interface{} {
+	return feature_rtsp.Type()
+}
+
+func (rtsp *rtsp) close() {
+	rtsp.logger.Info("rtsp closing")
+	rtsp.serv.Close()
+}
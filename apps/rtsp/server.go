@@ -0,0 +1,255 @@
+package rtsp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pingostack/neon/internal/httpserv"
+	proto_rtsp "github.com/pingostack/neon/protocols/rtsp"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAddr        = "tcp://:554"
+	defaultJoinTimeout = 10 * time.Second
+	shutdownTimeout    = 5 * time.Second
+)
+
+type Server struct {
+	ctx      context.Context
+	logger   *logrus.Entry
+	settings ServerSettings
+	serv     *proto_rtsp.Server
+	auth     proto_rtsp.IAuthProvider
+	tunnel   *proto_rtsp.HTTPTunnel
+	httpServ *httpserv.Server
+}
+
+func NewServer(ctx context.Context, settings ServerSettings, logger *logrus.Entry) (*Server, error) {
+	if settings.Addr == "" {
+		settings.Addr = defaultAddr
+	}
+
+	if !strings.Contains(settings.Addr, "://") {
+		settings.Addr = "tcp://" + settings.Addr
+	}
+
+	s := &Server{
+		ctx:      ctx,
+		logger:   logger,
+		settings: settings,
+	}
+
+	if len(settings.Auth) > 0 {
+		auth, err := newAuthProviders(settings.Auth)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid rtsp auth settings")
+		}
+		s.auth = auth
+	}
+
+	return s, nil
+}
+
+func newAuthProviders(settings map[string]AuthSettings) (proto_rtsp.AuthProviders, error) {
+	providers := make(proto_rtsp.AuthProviders)
+	for namespace, as := range settings {
+		a := &proto_rtsp.Authenticator{
+			Algorithm: as.Algorithm,
+			Realm:     as.Realm,
+		}
+
+		switch strings.ToLower(as.Scheme) {
+		case "basic":
+			a.Scheme = proto_rtsp.AuthSchemeBasic
+		case "", "digest":
+			a.Scheme = proto_rtsp.AuthSchemeDigest
+		default:
+			return nil, fmt.Errorf("namespace %s: %w", namespace, proto_rtsp.ErrAuthSchemeNotSupported)
+		}
+
+		if a.Realm == "" {
+			a.Realm = "neon"
+		}
+
+		for _, m := range as.Methods {
+			method := proto_rtsp.ParseMethod(m)
+			if method == proto_rtsp.UnknownMethod {
+				return nil, fmt.Errorf("namespace %s: unknown method %s", namespace, m)
+			}
+			a.Methods = append(a.Methods, method)
+		}
+
+		if as.CallbackUrl != "" {
+			a.Credentials = proto_rtsp.NewHTTPCredentials(as.CallbackUrl, time.Duration(as.CallbackTimeoutSeconds)*time.Second)
+		} else {
+			users := make(proto_rtsp.StaticCredentials)
+			for _, u := range as.Users {
+				users[u.User] = u.Password
+			}
+			a.Credentials = users
+		}
+
+		providers[namespace] = a
+	}
+
+	return providers, nil
+}
+
+func (s *Server) options() proto_rtsp.Options {
+	tcp := s.settings.Tcp
+	return proto_rtsp.Options{
+		ReuseAddr:        tcp.ReuseAddr,
+		ReusePort:        tcp.ReusePort,
+		TCPKeepAlive:     time.Duration(tcp.TCPKeepAliveSeconds) * time.Second,
+		TCPNoDelay:       tcp.TCPNoDelay == 0,
+		LockOSThread:     tcp.LockOSThread,
+		SocketRecvBuffer: tcp.SocketRecvBuffer,
+		SocketSendBuffer: tcp.SocketSendBuffer,
+		Logger:           s.logger,
+		NumEventLoop:     tcp.NumEventLoop,
+		Multicore:        tcp.Multicore,
+		Auth:             s.auth,
+		IdleTimeout:      time.Duration(s.settings.IdleTimeoutSeconds) * time.Second,
+	}
+}
+
+func (s *Server) Start() error {
+	serv, err := proto_rtsp.NewServer(s, s, s.settings.Addr, s.options())
+	if err != nil {
+		return err
+	}
+
+	s.serv = serv
+
+	if s.settings.HttpTunnel.Addr != "" {
+		if err := s.startHttpTunnel(); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		if err := serv.Run(); err != nil {
+			s.logger.WithError(err).Error("rtsp server stopped")
+		}
+	}()
+
+	return nil
+}
+
+// startHttpTunnel serves RTSP over HTTP, the tunnelled connections share
+// the sessions and settings of the plain ones.
+func (s *Server) startHttpTunnel() error {
+	tunnel, err := proto_rtsp.NewHTTPTunnel(s.ctx, s, s, s.options())
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", s.settings.HttpTunnel.Addr)
+	if err != nil {
+		return errors.Wrapf(err, "rtsp http tunnel listen on %s failed", s.settings.HttpTunnel.Addr)
+	}
+
+	s.logger.WithField("addr", s.settings.HttpTunnel.Addr).Info("rtsp http tunnel listen on")
+
+	s.tunnel = tunnel
+	s.httpServ = httpserv.NewServer(s.ctx, tunnel,
+		httpserv.WithListener(ln),
+		httpserv.WithLogger(s.logger))
+
+	return nil
+}
+
+func (s *Server) Close() error {
+	if s.httpServ != nil {
+		s.httpServ.Close()
+		s.tunnel.Close()
+	}
+
+	if s.serv == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return s.serv.Shutdown(ctx)
+}
+
+func (s *Server) joinTimeout() time.Duration {
+	if s.settings.JoinTimeoutSeconds <= 0 {
+		return defaultJoinTimeout
+	}
+
+	return time.Duration(s.settings.JoinTimeoutSeconds) * time.Second
+}
+
+func (s *Server) OnShutdown(serv *proto_rtsp.Server) {
+	s.logger.Info("rtsp server shutdown")
+}
+
+func (s *Server) OnConnect(ss proto_rtsp.IServSession) {
+	ss.(*session).logger.Debug("rtsp connected")
+}
+
+func (s *Server) OnDisconnect(ss proto_rtsp.IServSession) {
+	sess := ss.(*session)
+	sess.logger.Debug("rtsp disconnected")
+	sess.close(nil)
+}
+
+func (s *Server) NewOrGet() proto_rtsp.IServSession {
+	return newSession(s.ctx, s, s.joinTimeout(), s.logger)
+}
+
+func (s *Server) OnDescribe(serv *proto_rtsp.Serv) error {
+	return serv.Session().(*session).play(serv)
+}
+
+func (s *Server) OnAnnounce(serv *proto_rtsp.Serv) error {
+	return serv.Session().(*session).publish(serv)
+}
+
+func (s *Server) OnPause(serv *proto_rtsp.Serv) error {
+	serv.Session().(*session).pause()
+	return nil
+}
+
+func (s *Server) OnResume(serv *proto_rtsp.Serv) error {
+	return serv.Session().(*session).start(serv)
+}
+
+func (s *Server) OnStream(serv *proto_rtsp.Serv) error {
+	return serv.Session().(*session).start(serv)
+}
+
+func (s *Server) OnTeardown(serv *proto_rtsp.Serv) {
+	serv.Session().(*session).close(nil)
+}
+
+func (s *Server) OnGetParameter(serv *proto_rtsp.Serv, names []string) (map[string]string, error) {
+	return serv.Session().(*session).getParameters(names)
+}
+
+func (s *Server) OnSetParameter(serv *proto_rtsp.Serv, params map[string]string) error {
+	return serv.Session().(*session).setParameters(params)
+}
+
+func (s *Server) OnAuthenticate(serv *proto_rtsp.Serv, req *proto_rtsp.Request, user string, authErr error) error {
+	logger := serv.Session().(*session).logger.WithFields(logrus.Fields{
+		"method": req.Method().String(),
+		"user":   user,
+	})
+
+	if authErr != nil {
+		logger.WithError(authErr).Warn("rtsp authentication failed")
+	} else {
+		logger.Debug("rtsp authenticated")
+	}
+
+	return nil
+}
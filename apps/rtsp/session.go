@@ -0,0 +1,316 @@
+package rtsp
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/util/guid"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	deliver_rtsp "github.com/pingostack/neon/pkg/deliver/rtsp"
+	proto_rtsp "github.com/pingostack/neon/protocols/rtsp"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInvalidStreamUrl = errors.New("invalid rtsp stream url")
+	ErrSessionExists    = errors.New("rtsp session already joined")
+	ErrUnknownParameter = errors.New("rtsp unknown parameter")
+)
+
+// session is an RTSP connection, it joins the router of its url either as
+// the producer (ANNOUNCE/RECORD) or as a subscriber (DESCRIBE/PLAY).
+type session struct {
+	*proto_rtsp.ServSession
+	ctx         context.Context
+	cancel      context.CancelFunc
+	peerID      string
+	logger      *logrus.Entry
+	joinTimeout time.Duration
+	lock        sync.Mutex
+	core        router.Session
+	src         *deliver_rtsp.FrameSource
+	dest        *deliver_rtsp.FrameDestination
+}
+
+func newSession(ctx context.Context, listener proto_rtsp.IServSessionEventListener, joinTimeout time.Duration, logger *logrus.Entry) *session {
+	sess := &session{
+		ServSession: proto_rtsp.NewServSession(listener),
+		peerID:      guid.S(),
+		joinTimeout: joinTimeout,
+	}
+
+	sess.logger = logger.WithField("peer", sess.peerID)
+	sess.ctx, sess.cancel = context.WithCancel(ctx)
+
+	return sess
+}
+
+func (sess *session) Logger() proto_rtsp.Logger {
+	return sess.logger
+}
+
+func (sess *session) peerParams(serv *proto_rtsp.Serv, producer bool) (router.PeerParams, error) {
+	u, err := url.Parse(serv.Url())
+	if err != nil {
+		return router.PeerParams{}, errors.Wrap(ErrInvalidStreamUrl, err.Error())
+	}
+
+	routerID := strings.Trim(u.Path, "/")
+	if routerID == "" {
+		return router.PeerParams{}, ErrInvalidStreamUrl
+	}
+
+	pm := router.PeerParams{
+		PeerID:   sess.peerID,
+		RouterID: routerID,
+		Domain:   u.Hostname(),
+		URI:      u.Path,
+		Args:     router.QueryArgs(u.Query()),
+		Producer: producer,
+	}
+
+	if serv.RemoteAddr() != nil {
+		pm.RemoteAddr = serv.RemoteAddr().String()
+	}
+
+	if serv.LocalAddr() != nil {
+		pm.LocalAddr = serv.LocalAddr().String()
+	}
+
+	return pm, nil
+}
+
+func (sess *session) play(serv *proto_rtsp.Serv) error {
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	if sess.src != nil {
+		return ErrSessionExists
+	}
+
+	// DESCRIBE may be sent again, e.g. after an authentication challenge
+	if sess.dest != nil {
+		desc, err := sess.dest.SessionDescription()
+		if err != nil {
+			return err
+		}
+		serv.SetDescribe(desc)
+		return nil
+	}
+
+	pm, err := sess.peerParams(serv, false)
+	if err != nil {
+		return err
+	}
+
+	logger := sess.logger.WithField("router", pm.RouterID)
+
+	dest := deliver_rtsp.NewFrameDestination(sess.ctx, logger)
+
+	pm.HasAudio = true
+	pm.HasVideo = true
+	s := core.NewSession(sess.ctx, pm, logger)
+
+	err = s.BindFrameDestination(dest)
+	if err != nil {
+		dest.Close()
+		logger.WithError(err).Error("failed to bind frame destination")
+		return errors.Wrap(err, "failed to bind frame destination")
+	}
+
+	err = s.Join()
+	if err != nil && !errors.Is(err, router.ErrPaddingDestination) {
+		s.Finalize(err)
+		logger.WithError(err).Error("join failed")
+		return errors.Wrap(err, "join failed")
+	}
+
+	select {
+	case <-sess.ctx.Done():
+		s.Finalize(sess.ctx.Err())
+		return errors.Wrap(sess.ctx.Err(), "context done")
+	case err = <-dest.SourceCompletePromise():
+		if err != nil {
+			s.Finalize(err)
+			logger.WithError(err).Error("join failed")
+			return errors.Wrap(err, "join failed")
+		}
+	case <-time.After(sess.joinTimeout):
+		s.Finalize(errors.New("join timeout"))
+		logger.WithField("timeout", sess.joinTimeout).Error("join timeout")
+		return errors.New("join timeout")
+	}
+
+	desc, err := dest.SessionDescription()
+	if err != nil {
+		s.Finalize(err)
+		return err
+	}
+
+	sess.core = s
+	sess.dest = dest
+	sess.closeOnEnd(serv, s)
+
+	serv.SetDescribe(desc)
+
+	return nil
+}
+
+func (sess *session) publish(serv *proto_rtsp.Serv) error {
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	if sess.core != nil {
+		return ErrSessionExists
+	}
+
+	pm, err := sess.peerParams(serv, true)
+	if err != nil {
+		return err
+	}
+
+	logger := sess.logger.WithField("router", pm.RouterID)
+
+	src, err := deliver_rtsp.NewRecordFrameSource(sess.ctx, serv.Tracks(), logger)
+	if err != nil {
+		logger.WithError(err).Error("failed to create frame source")
+		return errors.Wrap(err, "failed to create frame source")
+	}
+
+	pm.HasAudio = src.Metadata().HasAudio()
+	pm.HasVideo = src.Metadata().HasVideo()
+
+	s := core.NewSession(sess.ctx, pm, logger)
+
+	err = s.BindFrameSource(src)
+	if err != nil {
+		src.Close()
+		logger.WithError(err).Error("failed to bind frame source")
+		return errors.Wrap(err, "failed to bind frame source")
+	}
+
+	err = s.Join()
+	if err != nil {
+		s.Finalize(err)
+		logger.WithError(err).Error("join failed")
+		return errors.Wrap(err, "join failed")
+	}
+
+	sess.core = s
+	sess.src = src
+	sess.closeOnEnd(serv, s)
+
+	return nil
+}
+
+// closeOnEnd drops the connection once the router ends the session, e.g.
+// when its lifetime expires or another producer replaces it.
+func (sess *session) closeOnEnd(serv *proto_rtsp.Serv, s router.Session) {
+	go func() {
+		select {
+		case <-sess.ctx.Done():
+		case <-s.Context().Done():
+			serv.Shutdown()
+		}
+	}()
+}
+
+func (sess *session) start(serv *proto_rtsp.Serv) error {
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	if sess.core == nil {
+		return errors.New("rtsp session not joined")
+	}
+
+	if sess.dest != nil {
+		sess.dest.Play(serv)
+	}
+
+	return nil
+}
+
+func (sess *session) pause() {
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	if sess.dest != nil {
+		sess.dest.Pause()
+	}
+}
+
+// getParameters answers GET_PARAMETER, "peer", "role" and "remaining"
+// are known.
+func (sess *session) getParameters(names []string) (map[string]string, error) {
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "peer":
+			values[name] = sess.peerID
+		case "role":
+			if sess.src != nil {
+				values[name] = "publisher"
+			} else if sess.dest != nil {
+				values[name] = "player"
+			} else {
+				values[name] = "none"
+			}
+		case "remaining":
+			// seconds before the router ends the session
+			values[name] = "unlimited"
+			if sess.core != nil && sess.core.GetRouter() != nil {
+				if remaining, ok := sess.core.GetRouter().Remaining(sess.core.ID()); ok {
+					values[name] = strconv.Itoa(int(remaining.Seconds()))
+				}
+			}
+		default:
+			return nil, errors.Wrap(ErrUnknownParameter, name)
+		}
+	}
+
+	return values, nil
+}
+
+// setParameters runs the commands of SET_PARAMETER, a player may ask
+// for a keyframe by "keyframe".
+func (sess *session) setParameters(params map[string]string) error {
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	for name := range params {
+		switch strings.ToLower(name) {
+		case "keyframe":
+			if sess.dest == nil {
+				return errors.New("rtsp session not playing")
+			}
+			sess.dest.RequestKeyFrame()
+		default:
+			return errors.Wrap(ErrUnknownParameter, name)
+		}
+	}
+
+	return nil
+}
+
+func (sess *session) close(e error) {
+	// cancel first, a pending DESCRIBE holds the lock while waiting for
+	// the producer
+	sess.cancel()
+
+	sess.lock.Lock()
+	s := sess.core
+	sess.lock.Unlock()
+
+	if s != nil {
+		s.Finalize(e)
+	}
+}
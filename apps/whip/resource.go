@@ -0,0 +1,161 @@
+package whip
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/util/guid"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/deliver/rtc"
+	"github.com/pingostack/neon/pkg/rtclib/transport"
+	"github.com/pkg/errors"
+)
+
+// ErrResourceDeleted finalizes the session of a resource deleted by its
+// client.
+var ErrResourceDeleted = errors.New("resource deleted")
+
+// resource is a session created by a POST, its Location is the path of
+// its router followed by its id.
+type resource struct {
+	id string
+	// typ is whip or whep
+	typ       string
+	routerID  string
+	createdAt time.Time
+	session   *rtc.ServSession
+	// lock orders the PATCH requests of the resource
+	lock sync.Mutex
+	// etag names the ICE session, it changes with an ICE restart
+	etag string
+}
+
+// ResourceInfo is the status of a resource, for debugging.
+type ResourceInfo struct {
+	ID            string    `json:"id"`
+	Type          string    `json:"type"`
+	RouterID      string    `json:"routerId"`
+	SessionID     string    `json:"sessionId"`
+	Producer      bool      `json:"producer"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UptimeSeconds int64     `json:"uptimeSeconds"`
+	ETag          string    `json:"etag"`
+	// SessionRouterID is the router the session joined, when a hook
+	// moved it to another one
+	SessionRouterID string            `json:"sessionRouterId,omitempty"`
+	Metadata        *deliver.Metadata `json:"metadata,omitempty"`
+	Transport       *transport.State  `json:"transport,omitempty"`
+}
+
+// transportStater is implemented by the frame sources and destinations
+// running on a WebRTC transport.
+type transportStater interface {
+	TransportState() transport.State
+}
+
+func newETag() string {
+	return `"` + guid.S() + `"`
+}
+
+// matches tells whether the If-Match of a request is empty, * or the ETag
+// of the resource, the caller holds its lock.
+func (r *resource) matches(ifMatch string) bool {
+	return ifMatch == "" || ifMatch == "*" || ifMatch == r.etag
+}
+
+func (r *resource) info() ResourceInfo {
+	r.lock.Lock()
+	etag := r.etag
+	r.lock.Unlock()
+
+	s := r.session
+	info := ResourceInfo{
+		ID:            r.id,
+		Type:          r.typ,
+		RouterID:      r.routerID,
+		SessionID:     s.ID(),
+		Producer:      s.PeerParams().Producer,
+		CreatedAt:     r.createdAt,
+		UptimeSeconds: int64(time.Since(r.createdAt) / time.Second),
+		ETag:          etag,
+	}
+
+	if id := s.RouterID(); id != r.routerID {
+		info.SessionRouterID = id
+	}
+
+	var stater interface{}
+	if src := s.FrameSource(); src != nil {
+		md := *src.Metadata()
+		info.Metadata = &md
+		stater = src
+	} else if dest := s.FrameDestination(); dest != nil {
+		md := *dest.Metadata()
+		info.Metadata = &md
+		stater = dest
+	}
+
+	if ts, ok := stater.(transportStater); ok {
+		state := ts.TransportState()
+		info.Transport = &state
+	}
+
+	return info
+}
+
+// resources are the sessions of the POST requests by id, a resource is
+// only found through the path of its router.
+type resources struct {
+	lock      sync.RWMutex
+	resources map[string]*resource
+}
+
+func newResources() *resources {
+	return &resources{
+		resources: make(map[string]*resource),
+	}
+}
+
+// add keeps the session until it is closed.
+func (rs *resources) add(typ, routerID, id string, s *rtc.ServSession) *resource {
+	r := &resource{
+		id:        id,
+		typ:       typ,
+		routerID:  routerID,
+		createdAt: time.Now(),
+		session:   s,
+		etag:      newETag(),
+	}
+
+	rs.lock.Lock()
+	rs.resources[id] = r
+	rs.lock.Unlock()
+
+	go func() {
+		<-s.Context().Done()
+		rs.remove(r)
+	}()
+
+	return r
+}
+
+func (rs *resources) get(typ, routerID, id string) *resource {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+
+	r := rs.resources[id]
+	if r == nil || r.typ != typ || r.routerID != routerID {
+		return nil
+	}
+
+	return r
+}
+
+func (rs *resources) remove(r *resource) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	if rs.resources[r.id] == r {
+		delete(rs.resources, r.id)
+	}
+}
@@ -1,6 +1,7 @@
 package whip
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -13,10 +14,14 @@ import (
 	"github.com/gogf/gf/util/guid"
 	"github.com/let-light/gomodule"
 	feature_rtc "github.com/pingostack/neon/features/rtc"
+	"github.com/pingostack/neon/internal/core/middleware"
 	"github.com/pingostack/neon/internal/core/router"
 	"github.com/pingostack/neon/internal/httpserv"
 	inter_rtc "github.com/pingostack/neon/internal/rtc"
 	"github.com/pingostack/neon/pkg/deliver/rtc"
+	"github.com/pingostack/neon/pkg/rtclib/rtcerror"
+	"github.com/pingostack/neon/pkg/rtclib/sdpassistor"
+	"github.com/pion/webrtc/v4"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -27,6 +32,7 @@ type SignalServer struct {
 	logger     *logrus.Entry
 	httpParams httpserv.HttpParams
 	rtc        feature_rtc.Feature
+	resources  *resources
 }
 
 func NewSignalServer(ctx context.Context, httpParams httpserv.HttpParams, logger *logrus.Entry) *SignalServer {
@@ -35,6 +41,7 @@ func NewSignalServer(ctx context.Context, httpParams httpserv.HttpParams, logger
 		ctx:        ctx,
 		logger:     logger,
 		httpParams: httpParams,
+		resources:  newResources(),
 	}
 
 	gomodule.RequireFeatures(func(rtc feature_rtc.Feature) {
@@ -49,6 +56,15 @@ const (
 	PathVarApp    = "app"
 	PathVarStream = "stream"
 	PathVarSecret = "secret"
+
+	TypeWhip = "whip"
+	TypeWhep = "whep"
+
+	ContentTypeSDP = "application/sdp"
+	// ContentTypeICEFragment is the body of the PATCH requests
+	ContentTypeICEFragment = "application/trickle-ice-sdpfrag"
+
+	patchTimeout = 5 * time.Second
 )
 
 func (ss *SignalServer) Start() error {
@@ -122,11 +138,21 @@ func (ss *SignalServer) handleRequest(gc *gin.Context) {
 			gc.JSON(http.StatusMethodNotAllowed, gin.H{"error": "method not allowed"})
 		}
 	} else {
+		r := ss.resources.get(gc.Param(PathVarType), fmt.Sprint(gc.Param(PathVarApp), "/", gc.Param(PathVarStream)), secret)
+		if r == nil && gc.Request.Method != http.MethodOptions {
+			gc.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+			return
+		}
+
 		switch gc.Request.Method {
+		case http.MethodOptions:
+			ss.handleOptions(gc)
+		case http.MethodGet:
+			gc.JSON(http.StatusOK, r.info())
 		case http.MethodPatch:
-			ss.handlePatch(gc, secret)
+			ss.handlePatch(gc, r)
 		case http.MethodDelete:
-			ss.handleDelete(gc, secret)
+			ss.handleDelete(gc, r)
 		default:
 			gc.JSON(http.StatusMethodNotAllowed, gin.H{"error": "method not allowed"})
 		}
@@ -145,28 +171,67 @@ func (ss *SignalServer) handlePost(gc *gin.Context) {
 
 	routerID := fmt.Sprint(app, "/", stream)
 
-	if typ == "whip" {
-		ss.handlePostWhip(gc, routerID)
-	} else {
-		ss.handlePostWhep(gc, routerID)
+	var err error
+	switch typ {
+	case TypeWhip:
+		err = ss.handlePostWhip(gc, routerID)
+	case TypeWhep:
+		err = ss.handlePostWhep(gc, routerID)
+	default:
+		gc.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	if err != nil {
+		ss.writeError(gc, err)
 	}
 }
 
-func sessionLocation(publish bool, secret string) string {
-	ret := ""
-	if publish {
-		ret += "whip"
-	} else {
-		ret += "whep"
+// writeError answers a failed request, 409 if the router keeps another
+// producer, 401, 403 or 429 when a middleware refused the join and 422
+// for a PATCH the session can not apply.
+func (ss *SignalServer) writeError(gc *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, router.ErrProducerRejected):
+		status = http.StatusConflict
+	case errors.Is(err, middleware.ErrUnauthorized):
+		status = http.StatusUnauthorized
+	case errors.Is(err, middleware.ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, middleware.ErrTooManyRequests):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, rtc.ErrNoOffer), errors.Is(err, rtc.ErrAlreadyAnswered),
+		errors.Is(err, rtcerror.ErrICERestartUnsupported):
+		status = http.StatusUnprocessableEntity
 	}
-	ret += "/" + secret
-	return ret
+
+	gc.JSON(status, gin.H{"error": err.Error()})
 }
 
-func (ss *SignalServer) handlePostWhip(gc *gin.Context, routerID string) error {
+// requestArgs returns the query arguments of a request, with the bearer
+// token of its Authorization header as the token argument.
+func requestArgs(gc *gin.Context) map[string]string {
+	args := router.QueryArgs(gc.Request.URL.Query())
+	if _, ok := args["token"]; ok {
+		return args
+	}
 
-	peerID := guid.S()
+	auth := gc.GetHeader("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		args["token"] = strings.TrimSpace(auth[7:])
+	}
+
+	return args
+}
 
+// resourceLocation is the path of a session, under the path of its
+// router.
+func resourceLocation(typ, routerID, id string) string {
+	return "/" + typ + "/" + routerID + "/" + id
+}
+
+func (ss *SignalServer) newServSession(gc *gin.Context, peerID, routerID string, producer bool) (*rtc.ServSession, *logrus.Entry) {
 	logger := ss.logger.WithFields(logrus.Fields{
 		"session": peerID,
 		"router":  routerID,
@@ -185,9 +250,31 @@ func (ss *SignalServer) handlePostWhip(gc *gin.Context, routerID string) error {
 		RouterID:   routerID,
 		Domain:     domain,
 		URI:        gc.Request.URL.Path,
-		Producer:   true,
+		Args:       requestArgs(gc),
+		Producer:   producer,
 	}, logger)
 
+	return s, logger
+}
+
+// writeCreated answers the POST of a resource with its sdp, an answer or
+// the offer of the server.
+func (ss *SignalServer) writeCreated(gc *gin.Context, r *resource, sdp string, acceptPatch string) {
+	gc.Writer.Header().Set("Content-Type", ContentTypeSDP)
+	gc.Writer.Header().Set("Access-Control-Expose-Headers", "ETag, ID, Accept-Patch, Link, Location")
+	gc.Writer.Header().Set("ETag", r.etag)
+	gc.Writer.Header().Set("ID", r.id)
+	gc.Writer.Header().Set("Accept-Patch", acceptPatch)
+	gc.Writer.Header().Set("Location", resourceLocation(r.typ, r.routerID, r.id))
+	gc.Writer.Header()["Link"] = ss.getLinkHeader()
+
+	gc.String(http.StatusCreated, sdp)
+}
+
+func (ss *SignalServer) handlePostWhip(gc *gin.Context, routerID string) error {
+	peerID := guid.S()
+	s, logger := ss.newServSession(gc, peerID, routerID, true)
+
 	sdpOffer, err := io.ReadAll(gc.Request.Body)
 	if err != nil {
 		return errors.Wrap(err, "failed to read sdp offer")
@@ -199,61 +286,139 @@ func (ss *SignalServer) handlePostWhip(gc *gin.Context, routerID string) error {
 		return errors.Wrap(err, "failed to publish")
 	}
 
-	logger.WithField("answer", lsdp.SDP).Debug("resp answer")
-	gc.Writer.Header().Set("Content-Type", "application/sdp")
-	gc.Writer.Header().Set("Access-Control-Expose-Headers", "ETag, ID, Accept-Patch, Link, Location")
-	gc.Writer.Header().Set("ETag", "*")
-	gc.Writer.Header().Set("ID", peerID)
-	gc.Writer.Header().Set("Accept-Patch", "application/trickle-ice-sdpfrag")
-	gc.Writer.Header().Set("Location", sessionLocation(true, peerID))
-	gc.Writer.Header()["Link"] = ss.getLinkHeader()
+	r := ss.resources.add(TypeWhip, routerID, peerID, s)
 
-	gc.String(http.StatusCreated, lsdp.SDP)
+	logger.WithField("answer", lsdp.SDP).Debug("resp answer")
+	ss.writeCreated(gc, r, lsdp.SDP, ContentTypeICEFragment)
 
 	return nil
 }
 
+// handlePostWhep answers the offer of a player, or makes the offer when
+// the body is empty: the player then answers with a PATCH of its sdp.
 func (ss *SignalServer) handlePostWhep(gc *gin.Context, routerID string) error {
 	peerID := guid.S()
-
-	logger := ss.logger.WithFields(logrus.Fields{
-		"session": peerID,
-		"router":  routerID,
-	})
-
-	s := rtc.NewServSession(ss.ctx, inter_rtc.StreamFactory(), router.PeerParams{
-		RemoteAddr: gc.Request.RemoteAddr,
-		LocalAddr:  gc.Request.Host,
-		PeerID:     peerID,
-		RouterID:   routerID,
-		Domain:     gc.Request.Host,
-		URI:        gc.Request.URL.Path,
-		Producer:   true,
-	}, logger)
+	s, logger := ss.newServSession(gc, peerID, routerID, false)
 
 	sdpOffer, err := io.ReadAll(gc.Request.Body)
 	if err != nil {
 		return errors.Wrap(err, "failed to read sdp offer")
 	}
 
-	lsdp, err := s.Subscribe(string(sdpOffer), 4*time.Second)
+	var lsdp *webrtc.SessionDescription
+	acceptPatch := ContentTypeICEFragment
+	if len(bytes.TrimSpace(sdpOffer)) == 0 {
+		lsdp, err = s.SubscribeOffer(4 * time.Second)
+		acceptPatch = ContentTypeSDP + ", " + ContentTypeICEFragment
+	} else {
+		lsdp, err = s.Subscribe(string(sdpOffer), 4*time.Second)
+	}
+
 	if err != nil {
 		logger.WithError(err).Error("failed to whep")
 		return errors.Wrap(err, "failed to whep")
 	}
 
-	logger.WithField("answer", lsdp.SDP).Debug("resp answer")
+	r := ss.resources.add(TypeWhep, routerID, peerID, s)
 
-	gc.String(http.StatusOK, lsdp.SDP)
+	logger.WithField("sdp", lsdp.SDP).Debug("resp sdp")
+	ss.writeCreated(gc, r, lsdp.SDP, acceptPatch)
 
 	return nil
 }
 
-func (ss *SignalServer) handlePatch(gc *gin.Context, secret string) {
-	ss.logger.Infof("handlePatch")
+// handleAnswer sets the answer of a player to the offer of the server,
+// If-Match must be the ETag of the resource or *.
+func (ss *SignalServer) handleAnswer(gc *gin.Context, r *resource) {
+	body, err := io.ReadAll(gc.Request.Body)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.matches(gc.GetHeader("If-Match")) {
+		gc.JSON(http.StatusPreconditionFailed, gin.H{"error": "etag mismatch"})
+		return
+	}
+
+	if err = r.session.Answer(string(body)); err != nil {
+		ss.writeError(gc, err)
+		return
+	}
+
+	gc.Status(http.StatusNoContent)
 }
 
-func (ss *SignalServer) handleDelete(gc *gin.Context, secret string) {
-	ss.logger.Infof("handleDelete")
+// handlePatch trickles the candidates of a peer or restarts ICE when its
+// credentials changed (RFC 9725). A restart is answered with our new
+// credentials and candidates and a new ETag, If-Match must be the ETag of
+// the ICE session or *. The sdp of a WHEP player answers the offer of the
+// server.
+func (ss *SignalServer) handlePatch(gc *gin.Context, r *resource) {
+	contentType := gc.ContentType()
+	if contentType == ContentTypeSDP && r.typ == TypeWhep {
+		ss.handleAnswer(gc, r)
+		return
+	}
+
+	if contentType != ContentTypeICEFragment {
+		gc.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported content type"})
+		return
+	}
+
+	body, err := io.ReadAll(gc.Request.Body)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+
+	frag, err := sdpassistor.ParseICEFragment(string(body))
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.matches(gc.GetHeader("If-Match")) {
+		gc.JSON(http.StatusPreconditionFailed, gin.H{"error": "etag mismatch"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ss.ctx, patchTimeout)
+	defer cancel()
+
+	answer, err := r.session.Patch(ctx, frag)
+	if err != nil {
+		ss.writeError(gc, err)
+		return
+	}
+
+	if answer == "" {
+		gc.Status(http.StatusNoContent)
+		return
+	}
+
+	r.etag = newETag()
+	gc.Writer.Header().Set("Access-Control-Expose-Headers", "ETag")
+	gc.Writer.Header().Set("ETag", r.etag)
+	gc.Data(http.StatusOK, ContentTypeICEFragment, []byte(answer))
+}
+
+// handleDelete finalizes the session of a resource, it is forgotten at
+// once.
+func (ss *SignalServer) handleDelete(gc *gin.Context, r *resource) {
+	ss.resources.remove(r)
+	r.session.Finalize(ErrResourceDeleted)
+
+	ss.logger.WithFields(logrus.Fields{
+		"session": r.id,
+		"router":  r.routerID,
+	}).Info("resource deleted")
 
+	gc.Status(http.StatusOK)
 }
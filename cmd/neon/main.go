@@ -4,7 +4,12 @@ import (
 	"context"
 
 	"github.com/let-light/gomodule"
+	"github.com/pingostack/neon/apps/admin"
+	"github.com/pingostack/neon/apps/edge"
+	"github.com/pingostack/neon/apps/metrics"
+	"github.com/pingostack/neon/apps/notify"
 	"github.com/pingostack/neon/apps/pms"
+	"github.com/pingostack/neon/apps/rtsp"
 	"github.com/pingostack/neon/apps/whip"
 	"github.com/pingostack/neon/internal/core"
 	"github.com/pingostack/neon/internal/rtc"
@@ -15,6 +20,11 @@ func serv(ctx context.Context) {
 	gomodule.RegisterDefaultModules()
 	gomodule.RegisterWithName(whip.WhipModule(), "whip")
 	gomodule.RegisterWithName(pms.PMSModule(), "pms")
+	gomodule.RegisterWithName(rtsp.RtspModule(), "rtsp")
+	gomodule.RegisterWithName(admin.AdminModule(), "admin")
+	gomodule.RegisterWithName(metrics.MetricsModule(), "metrics")
+	gomodule.RegisterWithName(notify.NotifyModule(), "notify")
+	gomodule.RegisterWithName(edge.EdgeModule(), "edge")
 	gomodule.RegisterWithName(core.CoreModule(), "core")
 	gomodule.RegisterWithName(rtc.RtcModule(), "webrtc")
 	gomodule.Launch(ctx)
@@ -1,25 +1,54 @@
 package event
 
 import (
-	"context"
+	"reflect"
+	"sync"
 
-	"github.com/let-light/gomodule"
-	feature_event "github.com/pingostack/neon/features/core"
 	"github.com/pingostack/neon/pkg/eventemitter"
-	"github.com/sirupsen/logrus"
 )
 
-type Event struct {
-	eventemitter.EventEmitter
-}
+// The events are identified by their type, each type is given an event
+// id of the emitters the first time it is used.
+var (
+	lock sync.Mutex
+	ids  = make(map[reflect.Type]eventemitter.EventID)
+)
+
+func idOf(t reflect.Type) eventemitter.EventID {
+	lock.Lock()
+	defer lock.Unlock()
 
-func init() {
-	event := &Event{
-		EventEmitter: eventemitter.NewEventEmitter(context.Background(), 100, logrus.WithField("module", "event")),
+	id, ok := ids[t]
+	if !ok {
+		id = eventemitter.GenEventID()
+		ids[t] = id
 	}
-	gomodule.AddFeature(event)
+
+	return id
+}
+
+// ID returns the event id of the events of type T.
+func ID[T any]() eventemitter.EventID {
+	return idOf(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// Emit sends ev to the handlers subscribed to its type.
+func Emit(ee eventemitter.EventEmitter, ev interface{}) error {
+	return ee.EmitEvent(idOf(reflect.TypeOf(ev)), ev)
+}
+
+// Subscribe calls h with the events of type T sent on ee.
+func Subscribe[T any](ee eventemitter.EventEmitter, h func(ev T)) {
+	ee.AddEvent(ID[T](), func(data interface{}) error {
+		if ev, ok := data.(T); ok {
+			h(ev)
+		}
+
+		return nil
+	})
 }
 
-func (e *Event) Type() interface{} {
-	return feature_event.Type()
+// SetOptions sets how the events of type T are dispatched on ee.
+func SetOptions[T any](ee eventemitter.EventEmitter, opts eventemitter.EventOptions) {
+	ee.SetEventOptions(ID[T](), opts)
 }
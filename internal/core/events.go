@@ -0,0 +1,59 @@
+package core
+
+import (
+	"sync"
+
+	"github.com/pingostack/neon/internal/core/event"
+	"github.com/pingostack/neon/pkg/eventemitter"
+)
+
+// eventListeners are the subscriptions of the apps, they are made on the
+// event emitter of the server once it is created since the modules run in
+// any order.
+type eventListeners struct {
+	lock      sync.Mutex
+	ee        eventemitter.EventEmitter
+	subscribe []func(ee eventemitter.EventEmitter)
+}
+
+var listeners = &eventListeners{}
+
+func (el *eventListeners) add(subscribe func(ee eventemitter.EventEmitter)) {
+	el.lock.Lock()
+	defer el.lock.Unlock()
+
+	if el.ee != nil {
+		subscribe(el.ee)
+		return
+	}
+
+	el.subscribe = append(el.subscribe, subscribe)
+}
+
+func (el *eventListeners) attach(ee eventemitter.EventEmitter) {
+	el.lock.Lock()
+	defer el.lock.Unlock()
+
+	el.ee = ee
+	for _, subscribe := range el.subscribe {
+		subscribe(ee)
+	}
+	el.subscribe = nil
+}
+
+// Subscribe calls h with the events of type T of the namespaces, their
+// routers and sessions, such as router.SessionJoined. Handlers run one at
+// a time and must not block.
+func Subscribe[T any](h func(ev T)) {
+	listeners.add(func(ee eventemitter.EventEmitter) {
+		event.Subscribe(ee, h)
+	})
+}
+
+// SetEventOptions sets how the events of type T are dispatched, e.g. so
+// that they are queued past the size of the queue instead of dropped.
+func SetEventOptions[T any](opts eventemitter.EventOptions) {
+	listeners.add(func(ee eventemitter.EventEmitter) {
+		event.SetOptions[T](ee, opts)
+	})
+}
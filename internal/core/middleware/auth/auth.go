@@ -1,15 +0,0 @@
-package auth
-
-import (
-	"context"
-
-	"github.com/pingostack/neon/internal/core/middleware"
-)
-
-func Recovery() middleware.Middleware {
-	return func(h middleware.Handler) middleware.Handler {
-		return func(ctx context.Context, req middleware.Request) (interface{}, error) {
-			return h(ctx, req)
-		}
-	}
-}
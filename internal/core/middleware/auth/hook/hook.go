@@ -0,0 +1,364 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/internal/core/middleware"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTimeout  = 3 * time.Second
+	maxCacheEntries = 4096
+	maxResultSize   = 64 << 10
+)
+
+var (
+	ErrDenied         = errors.Wrap(middleware.ErrForbidden, "denied by hook")
+	ErrHookFailed     = errors.Wrap(middleware.ErrForbidden, "hook failed")
+	ErrMissingSession = errors.New("request has no session")
+)
+
+// Endpoint is the hook urls of a namespace, an empty url lets the
+// operation through.
+type Endpoint struct {
+	OnPublish string `json:"onPublish" mapstructure:"onPublish"`
+	OnPlay    string `json:"onPlay" mapstructure:"onPlay"`
+}
+
+func (e Endpoint) url(operation string) string {
+	switch operation {
+	case middleware.OperationPublish:
+		return e.OnPublish
+	case middleware.OperationPlay:
+		return e.OnPlay
+	}
+
+	return ""
+}
+
+// Payload is posted as json to the hook of an operation.
+type Payload struct {
+	Operation  string            `json:"operation"`
+	Namespace  string            `json:"namespace"`
+	SessionID  string            `json:"sessionId"`
+	PeerID     string            `json:"peerId"`
+	RouterID   string            `json:"routerId"`
+	Domain     string            `json:"domain"`
+	URI        string            `json:"uri"`
+	RemoteAddr string            `json:"remoteAddr"`
+	Args       map[string]string `json:"args"`
+}
+
+// Result is the answer of a hook. A 2xx status with an empty body allows
+// the operation, a 401 or 403 denies it and any other status is a failure
+// of the hook.
+type Result struct {
+	// Allow denies the operation when false, absent means allowed
+	Allow *bool `json:"allow,omitempty"`
+	// Reason is the cause of a denial, returned to the peer
+	Reason string `json:"reason,omitempty"`
+	// RouterID moves the session to another router
+	RouterID string `json:"routerId,omitempty"`
+	// Metadata is attached to the session as its attributes
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+func (res *Result) allowed() bool {
+	return res.Allow == nil || *res.Allow
+}
+
+type options struct {
+	endpoint   Endpoint
+	namespaces map[string]Endpoint
+	timeout    time.Duration
+	failOpen   bool
+	cacheTTL   time.Duration
+	client     *http.Client
+}
+
+type Option func(*options)
+
+// WithEndpoint sets the hooks of the namespaces without their own.
+func WithEndpoint(e Endpoint) Option {
+	return func(o *options) {
+		o.endpoint = e
+	}
+}
+
+// WithNamespaceEndpoint sets the hooks of one namespace.
+func WithNamespaceEndpoint(namespace string, e Endpoint) Option {
+	return func(o *options) {
+		o.namespaces[namespace] = e
+	}
+}
+
+// WithTimeout bounds a call to a hook, 3 seconds by default.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithFailOpen lets the operations through when a hook fails or times
+// out, they are refused with ErrHookFailed by default.
+func WithFailOpen(failOpen bool) Option {
+	return func(o *options) {
+		o.failOpen = failOpen
+	}
+}
+
+// WithCacheTTL keeps the answers of the hooks for ttl, keyed by the
+// payload without the session, nothing is kept by default.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.cacheTTL = ttl
+	}
+}
+
+// WithHTTPClient sets the client calling the hooks.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+type cacheEntry struct {
+	result  *Result
+	expires time.Time
+}
+
+type hooks struct {
+	options
+	logger *logrus.Entry
+	lock   sync.Mutex
+	cache  map[string]cacheEntry
+}
+
+// Server asks the hook of the namespace of a request whether the session
+// may publish or play, before it joins its router. An allowed session may
+// be moved to another router and is given the metadata of the answer.
+func Server(logger *logrus.Entry, opts ...Option) middleware.Middleware {
+	hs := &hooks{
+		options: options{
+			namespaces: make(map[string]Endpoint),
+			timeout:    defaultTimeout,
+		},
+		logger: logger,
+		cache:  make(map[string]cacheEntry),
+	}
+
+	for _, opt := range opts {
+		opt(&hs.options)
+	}
+
+	if hs.client == nil {
+		hs.client = &http.Client{}
+	}
+
+	return func(h middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req middleware.Request) (interface{}, error) {
+			url := hs.url(req.Namespace, req.Operation)
+			if url == "" {
+				return h(ctx, req)
+			}
+
+			s := req.Session()
+			if s == nil {
+				return nil, ErrMissingSession
+			}
+
+			res, err := hs.check(ctx, url, newPayload(req, s))
+			if err != nil {
+				hs.logger.WithError(err).WithFields(logrus.Fields{
+					"operation": req.Operation,
+					"namespace": req.Namespace,
+					"session":   s.ID(),
+					"hook":      url,
+				}).Warn("hook failed")
+
+				if !hs.failOpen {
+					return nil, ErrHookFailed
+				}
+
+				return h(ctx, req)
+			}
+
+			if !res.allowed() {
+				if res.Reason != "" {
+					return nil, errors.Wrap(ErrDenied, res.Reason)
+				}
+
+				return nil, ErrDenied
+			}
+
+			if res.RouterID != "" && res.RouterID != s.PeerParams().RouterID {
+				s.SetRouterID(res.RouterID)
+			}
+
+			if len(res.Metadata) > 0 {
+				// the result may be cached and shared by other sessions
+				attrs := make(map[string]string, len(res.Metadata))
+				for k, v := range res.Metadata {
+					attrs[k] = v
+				}
+				router.SetSessionAttributes(s, attrs)
+			}
+
+			return h(ctx, req)
+		}
+	}
+}
+
+func newPayload(req middleware.Request, s router.Session) *Payload {
+	pp := s.PeerParams()
+	return &Payload{
+		Operation:  req.Operation,
+		Namespace:  req.Namespace,
+		SessionID:  s.ID(),
+		PeerID:     pp.PeerID,
+		RouterID:   pp.RouterID,
+		Domain:     pp.Domain,
+		URI:        pp.URI,
+		RemoteAddr: pp.RemoteAddr,
+		Args:       pp.Args,
+	}
+}
+
+func (hs *hooks) url(namespace, operation string) string {
+	if e, ok := hs.namespaces[namespace]; ok {
+		return e.url(operation)
+	}
+
+	return hs.endpoint.url(operation)
+}
+
+// cacheKey identifies the answers which do not depend on the session, the
+// port of the peer is left out as well.
+func cacheKey(url string, p *Payload) string {
+	host, _, err := net.SplitHostPort(p.RemoteAddr)
+	if err != nil {
+		host = p.RemoteAddr
+	}
+
+	key, _ := json.Marshal([]interface{}{url, p.Operation, p.Namespace, p.RouterID,
+		p.Domain, p.URI, host, p.Args})
+
+	return string(key)
+}
+
+func (hs *hooks) cached(key string) (*Result, bool) {
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+
+	e, ok := hs.cache[key]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(e.expires) {
+		delete(hs.cache, key)
+		return nil, false
+	}
+
+	return e.result, true
+}
+
+func (hs *hooks) store(key string, res *Result) {
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+
+	now := time.Now()
+	if len(hs.cache) >= maxCacheEntries {
+		for k, e := range hs.cache {
+			if now.After(e.expires) {
+				delete(hs.cache, k)
+			}
+		}
+
+		if len(hs.cache) >= maxCacheEntries {
+			return
+		}
+	}
+
+	hs.cache[key] = cacheEntry{
+		result:  res,
+		expires: now.Add(hs.cacheTTL),
+	}
+}
+
+func (hs *hooks) check(ctx context.Context, url string, p *Payload) (*Result, error) {
+	var key string
+	if hs.cacheTTL > 0 {
+		key = cacheKey(url, p)
+		if res, ok := hs.cached(key); ok {
+			return res, nil
+		}
+	}
+
+	res, err := hs.call(ctx, url, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if hs.cacheTTL > 0 {
+		hs.store(key, res)
+	}
+
+	return res, nil
+}
+
+func (hs *hooks) call(ctx context.Context, url string, p *Payload) (*Result, error) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hs.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResultSize))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, res); err != nil && resp.StatusCode/100 == 2 {
+			return nil, errors.Wrap(err, "failed to decode hook result")
+		}
+	}
+
+	switch {
+	case resp.StatusCode/100 == 2:
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		denied := false
+		res.Allow = &denied
+	default:
+		return nil, fmt.Errorf("hook %s status %d", url, resp.StatusCode)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,169 @@
+package hook_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/middleware"
+	"github.com/pingostack/neon/internal/core/middleware/auth/hook"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/sirupsen/logrus"
+)
+
+// newHookServer answers every hook with status and body, the payloads
+// posted are sent on the returned channel.
+func newHookServer(t *testing.T, status int, body string) (*httptest.Server, chan hook.Payload) {
+	payloads := make(chan hook.Payload, 8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := hook.Payload{}
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("bad payload: %v", err)
+		}
+		payloads <- p
+
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, payloads
+}
+
+func newSession(routerID string) router.Session {
+	return core.NewSession(context.Background(), router.PeerParams{
+		PeerID:     "peer",
+		RouterID:   routerID,
+		RemoteAddr: "127.0.0.1:5000",
+		Args:       map[string]string{"user": "alice"},
+	}, logrus.NewEntry(logrus.New()))
+}
+
+// join runs the middleware for a publish of s, it returns whether the
+// handler was reached.
+func join(m middleware.Middleware, s router.Session) (bool, error) {
+	reached := false
+	_, err := m(func(ctx context.Context, req middleware.Request) (interface{}, error) {
+		reached = true
+		return nil, nil
+	})(context.Background(), middleware.Request{
+		Operation: middleware.OperationPublish,
+		Namespace: "live",
+		Params:    s,
+	})
+
+	return reached, err
+}
+
+func TestHookAllows(t *testing.T) {
+	srv, payloads := newHookServer(t, http.StatusOK, `{"allow": true, "metadata": {"tier": "gold"}}`)
+	m := hook.Server(logrus.NewEntry(logrus.New()), hook.WithEndpoint(hook.Endpoint{OnPublish: srv.URL}))
+
+	s := newSession("live/a")
+	reached, err := join(m, s)
+	if err != nil || !reached {
+		t.Fatalf("join = %v, %v, want allowed", reached, err)
+	}
+
+	p := <-payloads
+	if p.Operation != middleware.OperationPublish || p.Namespace != "live" || p.RouterID != "live/a" ||
+		p.SessionID != s.ID() || p.Args["user"] != "alice" {
+		t.Errorf("payload = %+v", p)
+	}
+
+	if attrs := router.GetSessionAttributes(s); attrs["tier"] != "gold" {
+		t.Errorf("attributes = %v", attrs)
+	}
+}
+
+func TestHookDenies(t *testing.T) {
+	srv, _ := newHookServer(t, http.StatusForbidden, `{"reason": "banned"}`)
+	m := hook.Server(logrus.NewEntry(logrus.New()), hook.WithEndpoint(hook.Endpoint{OnPublish: srv.URL}))
+
+	reached, err := join(m, newSession("live/a"))
+	if reached {
+		t.Fatal("denied session reached the handler")
+	}
+
+	if !errors.Is(err, hook.ErrDenied) || !errors.Is(err, middleware.ErrForbidden) {
+		t.Errorf("err = %v, want %v", err, hook.ErrDenied)
+	}
+}
+
+func TestHookFailure(t *testing.T) {
+	srv, _ := newHookServer(t, http.StatusInternalServerError, "")
+
+	for _, failOpen := range []bool{false, true} {
+		m := hook.Server(logrus.NewEntry(logrus.New()),
+			hook.WithEndpoint(hook.Endpoint{OnPublish: srv.URL}),
+			hook.WithFailOpen(failOpen))
+
+		reached, err := join(m, newSession("live/a"))
+		if failOpen && (err != nil || !reached) {
+			t.Errorf("fail open: join = %v, %v, want allowed", reached, err)
+		}
+
+		if !failOpen && (reached || !errors.Is(err, hook.ErrHookFailed)) {
+			t.Errorf("fail closed: join = %v, %v, want %v", reached, err, hook.ErrHookFailed)
+		}
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	m := hook.Server(logrus.NewEntry(logrus.New()),
+		hook.WithEndpoint(hook.Endpoint{OnPublish: srv.URL}),
+		hook.WithTimeout(50*time.Millisecond))
+
+	if reached, err := join(m, newSession("live/a")); reached || !errors.Is(err, hook.ErrHookFailed) {
+		t.Errorf("join = %v, %v, want %v", reached, err, hook.ErrHookFailed)
+	}
+}
+
+func TestHookRewritesRouter(t *testing.T) {
+	srv, _ := newHookServer(t, http.StatusOK, `{"routerId": "live/b"}`)
+	m := hook.Server(logrus.NewEntry(logrus.New()), hook.WithEndpoint(hook.Endpoint{OnPublish: srv.URL}))
+
+	s := newSession("live/a")
+	if reached, err := join(m, s); err != nil || !reached {
+		t.Fatalf("join = %v, %v, want allowed", reached, err)
+	}
+
+	if id := s.PeerParams().RouterID; id != "live/b" {
+		t.Errorf("router = %s, want live/b", id)
+	}
+}
+
+func TestHookCachedMetadataIsCopied(t *testing.T) {
+	srv, payloads := newHookServer(t, http.StatusOK, `{"metadata": {"tier": "gold"}}`)
+	m := hook.Server(logrus.NewEntry(logrus.New()),
+		hook.WithEndpoint(hook.Endpoint{OnPublish: srv.URL}),
+		hook.WithCacheTTL(time.Minute))
+
+	first, second := newSession("live/a"), newSession("live/a")
+	for _, s := range []router.Session{first, second} {
+		if reached, err := join(m, s); err != nil || !reached {
+			t.Fatalf("join = %v, %v, want allowed", reached, err)
+		}
+	}
+
+	if n := len(payloads); n != 1 {
+		t.Errorf("hook called %d times, want 1", n)
+	}
+
+	router.GetSessionAttributes(first)["tier"] = "changed"
+	if attrs := router.GetSessionAttributes(second); attrs["tier"] != "gold" {
+		t.Errorf("attributes of the second session = %v", attrs)
+	}
+}
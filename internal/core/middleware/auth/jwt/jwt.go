@@ -0,0 +1,223 @@
+package jwt
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/pingostack/neon/internal/core/middleware"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pkg/errors"
+)
+
+const defaultTokenArg = "token"
+
+var (
+	ErrMissingToken    = errors.Wrap(middleware.ErrUnauthorized, "token is missing")
+	ErrTokenInvalid    = errors.Wrap(middleware.ErrUnauthorized, "token is invalid")
+	ErrTokenExpired    = errors.Wrap(middleware.ErrUnauthorized, "token has expired")
+	ErrUnsupportedAlg  = errors.Wrap(middleware.ErrUnauthorized, "token signing method is not supported")
+	ErrMissingKey      = errors.Wrap(middleware.ErrUnauthorized, "token signing key is unknown")
+	ErrNamespaceDenied = errors.Wrap(middleware.ErrForbidden, "token does not grant the namespace")
+	ErrStreamDenied    = errors.Wrap(middleware.ErrForbidden, "token does not grant the stream")
+	ErrOperationDenied = errors.Wrap(middleware.ErrForbidden, "token does not grant the operation")
+	ErrMissingSession  = errors.New("request has no session")
+	errMissingKeyFunc  = errors.New("jwt key func is nil")
+)
+
+const (
+	// RolePublish grants publishing a stream
+	RolePublish = middleware.OperationPublish
+	// RolePlay grants playing a stream
+	RolePlay = middleware.OperationPlay
+)
+
+// Claims are the registered claims and the grants of a token, an empty
+// grant allows everything.
+type Claims struct {
+	jwt.Claims
+	// Namespace is the namespace the token is valid in
+	Namespace string `json:"ns,omitempty"`
+	// Stream is the router id pattern, a trailing "*" matches any suffix
+	// and the other wildcards follow path.Match
+	Stream string `json:"stream,omitempty"`
+	// Role is the operation granted, publish or play
+	Role string `json:"role,omitempty"`
+	// MaxDuration caps the lifetime of the session, in seconds
+	MaxDuration int64 `json:"max_duration,omitempty"`
+	// MaxBitrate caps the bitrate of a publisher, in kbps
+	MaxBitrate int `json:"max_bitrate,omitempty"`
+}
+
+// KeyFunc returns the HMAC keys a token of a namespace may be signed
+// with, the key id is empty for tokens without one. Several keys are
+// returned while they are rotated.
+type KeyFunc func(namespace, kid string) ([][]byte, error)
+
+// StaticKey verifies every token with one key.
+func StaticKey(key []byte) KeyFunc {
+	return func(string, string) ([][]byte, error) {
+		return [][]byte{key}, nil
+	}
+}
+
+type options struct {
+	tokenArg string
+	leeway   time.Duration
+}
+
+type Option func(*options)
+
+// WithTokenArg sets the peer argument carrying the token, "token" by
+// default.
+func WithTokenArg(name string) Option {
+	return func(o *options) {
+		o.tokenArg = name
+	}
+}
+
+// WithLeeway sets the clock skew tolerated on expiry and not before.
+func WithLeeway(leeway time.Duration) Option {
+	return func(o *options) {
+		o.leeway = leeway
+	}
+}
+
+type claimsKey struct{}
+
+// NewContext returns a context carrying the verified claims.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims verified for the request.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// Server verifies the HS256 token of the session and that it grants the
+// namespace, stream and operation of the request. The duration and
+// bitrate caps of the token are set as the limits of the session.
+func Server(keyFunc KeyFunc, opts ...Option) middleware.Middleware {
+	o := &options{
+		tokenArg: defaultTokenArg,
+		leeway:   jwt.DefaultLeeway,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return func(h middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req middleware.Request) (interface{}, error) {
+			if keyFunc == nil {
+				return nil, errMissingKeyFunc
+			}
+
+			s := req.Session()
+			if s == nil {
+				return nil, ErrMissingSession
+			}
+
+			pp := s.PeerParams()
+			claims, err := Parse(pp.Args[o.tokenArg], req.Namespace, keyFunc, o.leeway)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := claims.Grants(req.Namespace, pp.RouterID, req.Operation); err != nil {
+				return nil, err
+			}
+
+			if claims.MaxDuration > 0 || claims.MaxBitrate > 0 {
+				router.SetSessionLimits(s, router.SessionLimits{
+					MaxDuration: time.Duration(claims.MaxDuration) * time.Second,
+					MaxBitrate:  claims.MaxBitrate,
+				})
+			}
+
+			return h(NewContext(ctx, claims), req)
+		}
+	}
+}
+
+// Parse verifies the signature and the validity period of a token used
+// in a namespace, against each of the keys of the namespace.
+func Parse(token, namespace string, keyFunc KeyFunc, leeway time.Duration) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	tok, err := jwt.ParseSigned(token)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	if len(tok.Headers) != 1 || tok.Headers[0].Algorithm != string(jose.HS256) {
+		return nil, ErrUnsupportedAlg
+	}
+
+	keys, err := keyFunc(namespace, tok.Headers[0].KeyID)
+	if err != nil || len(keys) == 0 {
+		return nil, ErrMissingKey
+	}
+
+	var claims *Claims
+	for _, key := range keys {
+		c := &Claims{}
+		if len(key) > 0 && tok.Claims(key, c) == nil {
+			claims = c
+			break
+		}
+	}
+
+	if claims == nil {
+		return nil, ErrTokenInvalid
+	}
+
+	if err := claims.ValidateWithLeeway(jwt.Expected{Time: time.Now()}, leeway); err != nil {
+		if errors.Is(err, jwt.ErrExpired) {
+			return nil, ErrTokenExpired
+		}
+
+		return nil, ErrTokenInvalid
+	}
+
+	return claims, nil
+}
+
+// Grants reports whether the claims allow an operation on a router of a
+// namespace.
+func (c *Claims) Grants(namespace, routerID, operation string) error {
+	if c.Namespace != "" && c.Namespace != namespace {
+		return ErrNamespaceDenied
+	}
+
+	if c.Stream != "" && !matchStream(c.Stream, routerID) {
+		return ErrStreamDenied
+	}
+
+	if c.Role != "" && c.Role != operation {
+		return ErrOperationDenied
+	}
+
+	return nil
+}
+
+func matchStream(pattern, routerID string) bool {
+	if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern &&
+		!strings.ContainsAny(prefix, "*?[\\") {
+		return strings.HasPrefix(routerID, prefix)
+	}
+
+	matched, err := path.Match(pattern, routerID)
+	if err != nil {
+		return pattern == routerID
+	}
+
+	return matched
+}
@@ -2,29 +2,41 @@ package logging
 
 import (
 	"context"
-	"fmt"
+	"time"
 
 	"github.com/pingostack/neon/internal/core/middleware"
 	"github.com/sirupsen/logrus"
 )
 
-func Recovery(logger *logrus.Entry) middleware.Middleware {
+// Server logs every request with its session, latency and error.
+func Server(logger *logrus.Entry) middleware.Middleware {
 	return func(h middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req middleware.Request) (interface{}, error) {
+			start := time.Now()
 			reply, err := h(ctx, req)
-			logger.Infof("request: %s, reply: %s, err: %v", toString(req), toString(reply), err)
-			return reply, err
-		}
-	}
-}
 
-func toString(x interface{}) string {
-	if x == nil {
-		return "none"
-	}
+			fields := logrus.Fields{
+				"operation": req.Operation,
+				"namespace": req.Namespace,
+				"latency":   time.Since(start).Round(time.Microsecond),
+			}
 
-	if stringer, ok := x.(fmt.Stringer); ok {
-		return stringer.String()
+			if s := req.Session(); s != nil {
+				pp := s.PeerParams()
+				fields["session"] = s.ID()
+				fields["peer"] = pp.PeerID
+				fields["router"] = pp.RouterID
+				fields["remote"] = pp.RemoteAddr
+			}
+
+			entry := logger.WithFields(fields)
+			if err != nil {
+				entry.WithError(err).Warn("request failed")
+			} else {
+				entry.Info("request")
+			}
+
+			return reply, err
+		}
 	}
-	return fmt.Sprintf("%+v", x)
 }
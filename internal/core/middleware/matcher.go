@@ -3,12 +3,15 @@ package middleware
 import (
 	"sort"
 	"strings"
+	"sync"
 )
 
 type Matcher interface {
 	Use(ms ...Middleware)
 	Add(selector string, ms ...Middleware)
 	Match(operation string) []Middleware
+	Select(operation string) []Middleware
+	SelectAfter(operation, previous string) []Middleware
 }
 
 func New() Matcher {
@@ -18,37 +21,90 @@ func New() Matcher {
 }
 
 type matcher struct {
+	lock     sync.RWMutex
 	prefix   []string
 	defaults []Middleware
 	matchs   map[string][]Middleware
 }
 
+// Use appends middlewares run for every operation, before the selected
+// ones.
 func (m *matcher) Use(ms ...Middleware) {
-	m.defaults = ms
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.defaults = append(m.defaults, ms...)
 }
 
+// Add appends middlewares run for the operations of a selector, an
+// operation or a prefix ending with "*".
 func (m *matcher) Add(selector string, ms ...Middleware) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	if strings.HasSuffix(selector, "*") {
 		selector = strings.TrimSuffix(selector, "*")
-		m.prefix = append(m.prefix, selector)
-		sort.Slice(m.prefix, func(i, j int) bool {
-			return m.prefix[i] > m.prefix[j]
-		})
+		if !m.hasPrefix(selector) {
+			m.prefix = append(m.prefix, selector)
+			sort.Slice(m.prefix, func(i, j int) bool {
+				return m.prefix[i] > m.prefix[j]
+			})
+		}
 	}
-	m.matchs[selector] = ms
+	m.matchs[selector] = append(m.matchs[selector], ms...)
 }
 
+func (m *matcher) hasPrefix(prefix string) bool {
+	for _, p := range m.prefix {
+		if p == prefix {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Match returns the defaults and the middlewares selected for an
+// operation.
 func (m *matcher) Match(operation string) []Middleware {
+	m.lock.RLock()
 	ms := make([]Middleware, 0, len(m.defaults))
-	if len(m.defaults) > 0 {
-		ms = append(ms, m.defaults...)
-	}
-	if next, ok := m.matchs[operation]; ok {
-		return append(ms, next...)
+	ms = append(ms, m.defaults...)
+	m.lock.RUnlock()
+
+	return append(ms, m.Select(operation)...)
+}
+
+// Select returns the middlewares selected for an operation, without the
+// defaults: the ones of the operation itself, then the ones of the
+// matching prefixes from the longest.
+func (m *matcher) Select(operation string) []Middleware {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.selectLocked(operation, func(string) bool { return false })
+}
+
+// SelectAfter returns the middlewares selected for an operation run
+// inside the chain of a previous one, e.g. publish inside join: the
+// prefixes matching both operations already ran and are left out.
+func (m *matcher) SelectAfter(operation, previous string) []Middleware {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.selectLocked(operation, func(prefix string) bool {
+		return strings.HasPrefix(previous, prefix)
+	})
+}
+
+func (m *matcher) selectLocked(operation string, skip func(prefix string) bool) []Middleware {
+	var ms []Middleware
+	if next, ok := m.matchs[operation]; ok && !m.hasPrefix(operation) {
+		ms = append(ms, next...)
 	}
 	for _, prefix := range m.prefix {
-		if strings.HasPrefix(operation, prefix) {
-			return append(ms, m.matchs[prefix]...)
+		if strings.HasPrefix(operation, prefix) && !skip(prefix) {
+			ms = append(ms, m.matchs[prefix]...)
 		}
 	}
 	return ms
@@ -1,16 +1,38 @@
 package middleware
 
-import "context"
+import (
+	"context"
+	"errors"
+
+	"github.com/pingostack/neon/internal/core/router"
+)
 
 const (
-	OperationJoin = "join"
+	// OperationJoin wraps every join, as a publish or a play.
+	OperationJoin    = "join"
+	OperationPublish = "publish"
+	OperationPlay    = "play"
+	OperationLeave   = "leave"
+)
+
+var (
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrTooManyRequests = errors.New("too many requests")
 )
 
 type Request struct {
 	Operation string      `json:"operation"`
+	Namespace string      `json:"namespace"`
 	Params    interface{} `json:"params"`
 }
 
+// Session returns the session the request is about, nil if it has none.
+func (req Request) Session() router.Session {
+	s, _ := req.Params.(router.Session)
+	return s
+}
+
 type Middleware func(Handler) Handler
 
 type Handler func(ctx context.Context, req Request) (interface{}, error)
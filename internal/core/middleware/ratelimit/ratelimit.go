@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pingostack/neon/internal/core/middleware"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+var ErrLimitExceed = errors.Wrap(middleware.ErrTooManyRequests, "rate limit exceeded")
+
+// Limit lets Rate requests a second through, in bursts of Burst. A zero
+// rate does not limit.
+type Limit struct {
+	Rate  float64 `json:"rate" mapstructure:"rate"`
+	Burst int     `json:"burst" mapstructure:"burst"`
+}
+
+type options struct {
+	limit      Limit
+	namespaces map[string]Limit
+}
+
+type Option func(*options)
+
+// WithLimit sets the limit of the namespaces without their own.
+func WithLimit(limit Limit) Option {
+	return func(o *options) {
+		o.limit = limit
+	}
+}
+
+// WithNamespaceLimit sets the limit of one namespace.
+func WithNamespaceLimit(namespace string, limit Limit) Option {
+	return func(o *options) {
+		o.namespaces[namespace] = limit
+	}
+}
+
+type limiters struct {
+	options
+	lock     sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func (l *limiters) get(namespace string) *rate.Limiter {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if limiter, ok := l.limiters[namespace]; ok {
+		return limiter
+	}
+
+	limit, ok := l.namespaces[namespace]
+	if !ok {
+		limit = l.limit
+	}
+
+	var limiter *rate.Limiter
+	if limit.Rate > 0 {
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(rate.Limit(limit.Rate), burst)
+	}
+
+	l.limiters[namespace] = limiter
+
+	return limiter
+}
+
+// Server refuses the requests of a namespace past its limit with
+// ErrLimitExceed, each namespace has its own bucket.
+func Server(opts ...Option) middleware.Middleware {
+	l := &limiters{
+		options: options{
+			namespaces: make(map[string]Limit),
+		},
+		limiters: make(map[string]*rate.Limiter),
+	}
+
+	for _, opt := range opts {
+		opt(&l.options)
+	}
+
+	return func(h middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req middleware.Request) (interface{}, error) {
+			if limiter := l.get(req.Namespace); limiter != nil && !limiter.Allow() {
+				return nil, ErrLimitExceed
+			}
+
+			return h(ctx, req)
+		}
+	}
+}
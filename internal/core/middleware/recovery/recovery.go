@@ -0,0 +1,36 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"runtime"
+
+	"github.com/pingostack/neon/internal/core/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrUnknownRequest = errors.New("unknown request error")
+
+const stackSize = 64 << 10
+
+// Recovery turns a panic of the next handlers into ErrUnknownRequest and
+// logs it with its stack.
+func Recovery(logger *logrus.Entry) middleware.Middleware {
+	return func(h middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req middleware.Request) (reply interface{}, err error) {
+			defer func() {
+				if rerr := recover(); rerr != nil {
+					buf := make([]byte, stackSize)
+					buf = buf[:runtime.Stack(buf, false)]
+					logger.WithFields(logrus.Fields{
+						"operation": req.Operation,
+						"namespace": req.Namespace,
+					}).Errorf("panic: %v\n%s", rerr, buf)
+					err = ErrUnknownRequest
+				}
+			}()
+
+			return h(ctx, req)
+		}
+	}
+}
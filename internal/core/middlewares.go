@@ -0,0 +1,244 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/pingostack/neon/internal/core/middleware"
+	"github.com/pingostack/neon/internal/core/middleware/auth/hook"
+	"github.com/pingostack/neon/internal/core/middleware/auth/jwt"
+	"github.com/pingostack/neon/internal/core/middleware/logging"
+	"github.com/pingostack/neon/internal/core/middleware/ratelimit"
+	"github.com/pingostack/neon/internal/core/middleware/recovery"
+	"github.com/sirupsen/logrus"
+)
+
+type MiddlewareSettings struct {
+	// Logging logs every operation with its session and latency
+	Logging   bool              `json:"logging" mapstructure:"logging"`
+	JWT       JWTSettings       `json:"jwt" mapstructure:"jwt"`
+	RateLimit RateLimitSettings `json:"rateLimit" mapstructure:"rateLimit"`
+	Hooks     HookSettings      `json:"hooks" mapstructure:"hooks"`
+}
+
+// JWTKey is an HMAC key of the tokens, tokens naming a key id in their
+// header are verified with that key only.
+type JWTKey struct {
+	Kid    string `json:"kid" mapstructure:"kid"`
+	Secret string `json:"secret" mapstructure:"secret"`
+}
+
+// JWTNamespace replaces the keys of the tokens of one namespace.
+type JWTNamespace struct {
+	Keys []JWTKey `json:"keys" mapstructure:"keys"`
+}
+
+// JWTSettings enable the token check when a key is configured at start,
+// the keys are reloaded with the config as long as one is left. Keys are
+// rotated by adding the new one next to the old one, until the tokens
+// signed with the old one expire.
+type JWTSettings struct {
+	// Secret is a key without id, kept next to Keys
+	Secret     string                  `json:"secret" mapstructure:"secret"`
+	Keys       []JWTKey                `json:"keys" mapstructure:"keys"`
+	Namespaces map[string]JWTNamespace `json:"namespaces" mapstructure:"namespaces"`
+	// Operations are the selectors checked, publish and play by default
+	Operations    []string `json:"operations" mapstructure:"operations"`
+	TokenArg      string   `json:"tokenArg" mapstructure:"tokenArg"`
+	LeewaySeconds int      `json:"leewaySeconds" mapstructure:"leewaySeconds"`
+}
+
+// RateLimitSettings enable the limit when a rate is set, globally or for
+// a namespace.
+type RateLimitSettings struct {
+	ratelimit.Limit `mapstructure:",squash"`
+	// Operations are the selectors limited, join by default
+	Operations []string                   `json:"operations" mapstructure:"operations"`
+	Namespaces map[string]ratelimit.Limit `json:"namespaces" mapstructure:"namespaces"`
+}
+
+// HookSettings enable the publish and play hooks when an url is set,
+// globally or for a namespace.
+type HookSettings struct {
+	hook.Endpoint `mapstructure:",squash"`
+	Namespaces    map[string]hook.Endpoint `json:"namespaces" mapstructure:"namespaces"`
+	TimeoutMs     int                      `json:"timeoutMs" mapstructure:"timeoutMs"`
+	// FailOpen lets the operations through when a hook is unreachable
+	FailOpen     bool `json:"failOpen" mapstructure:"failOpen"`
+	CacheSeconds int  `json:"cacheSeconds" mapstructure:"cacheSeconds"`
+}
+
+func (hs HookSettings) enabled() bool {
+	if hs.OnPublish != "" || hs.OnPlay != "" {
+		return true
+	}
+
+	for _, e := range hs.Namespaces {
+		if e.OnPublish != "" || e.OnPlay != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newBuiltins returns the middlewares enabled by the settings, panics are
+// always recovered.
+func newBuiltins(settings MiddlewareSettings, logger *logrus.Entry) middleware.Matcher {
+	m := middleware.New()
+	m.Use(recovery.Recovery(logger))
+
+	if settings.Logging {
+		m.Use(logging.Server(logger))
+	}
+
+	if rl := settings.RateLimit; rl.Rate > 0 || len(rl.Namespaces) > 0 {
+		opts := []ratelimit.Option{ratelimit.WithLimit(rl.Limit)}
+		for ns, limit := range rl.Namespaces {
+			opts = append(opts, ratelimit.WithNamespaceLimit(ns, limit))
+		}
+
+		limiter := ratelimit.Server(opts...)
+		for _, selector := range selectors(rl.Operations, middleware.OperationJoin) {
+			m.Add(selector, limiter)
+		}
+	}
+
+	if jwtKeys.enabled() {
+		opts := []jwt.Option{}
+		if settings.JWT.TokenArg != "" {
+			opts = append(opts, jwt.WithTokenArg(settings.JWT.TokenArg))
+		}
+		if settings.JWT.LeewaySeconds > 0 {
+			opts = append(opts, jwt.WithLeeway(time.Duration(settings.JWT.LeewaySeconds)*time.Second))
+		}
+
+		auth := jwt.Server(jwtKeys.lookup, opts...)
+		for _, selector := range selectors(settings.JWT.Operations, middleware.OperationPublish, middleware.OperationPlay) {
+			m.Add(selector, auth)
+		}
+	}
+
+	if hs := settings.Hooks; hs.enabled() {
+		opts := []hook.Option{
+			hook.WithEndpoint(hs.Endpoint),
+			hook.WithFailOpen(hs.FailOpen),
+			hook.WithCacheTTL(time.Duration(hs.CacheSeconds) * time.Second),
+		}
+		for ns, e := range hs.Namespaces {
+			opts = append(opts, hook.WithNamespaceEndpoint(ns, e))
+		}
+		if hs.TimeoutMs > 0 {
+			opts = append(opts, hook.WithTimeout(time.Duration(hs.TimeoutMs)*time.Millisecond))
+		}
+
+		// after the token check, so that a hook only sees granted sessions
+		check := hook.Server(logger, opts...)
+		m.Add(middleware.OperationPublish, check)
+		m.Add(middleware.OperationPlay, check)
+	}
+
+	return m
+}
+
+// keyring holds the jwt keys by namespace, it is swapped as a whole when
+// the settings change so that keys rotate without a restart.
+type keyring struct {
+	keys atomic.Value
+}
+
+// namespaceKeys are the keys of a namespace by id, the keys without id
+// are under the empty one.
+type namespaceKeys map[string][][]byte
+
+type keyringKeys struct {
+	defaults   namespaceKeys
+	namespaces map[string]namespaceKeys
+}
+
+var jwtKeys = &keyring{}
+
+func newNamespaceKeys(secret string, keys []JWTKey) namespaceKeys {
+	nk := make(namespaceKeys)
+	if secret != "" {
+		nk[""] = append(nk[""], []byte(secret))
+	}
+
+	for _, key := range keys {
+		if key.Secret != "" {
+			nk[key.Kid] = append(nk[key.Kid], []byte(key.Secret))
+		}
+	}
+
+	return nk
+}
+
+func (kr *keyring) update(settings JWTSettings) {
+	kk := &keyringKeys{
+		defaults:   newNamespaceKeys(settings.Secret, settings.Keys),
+		namespaces: make(map[string]namespaceKeys, len(settings.Namespaces)),
+	}
+
+	for ns, nsSettings := range settings.Namespaces {
+		kk.namespaces[ns] = newNamespaceKeys("", nsSettings.Keys)
+	}
+
+	kr.keys.Store(kk)
+}
+
+func (kr *keyring) load() *keyringKeys {
+	kk, _ := kr.keys.Load().(*keyringKeys)
+	return kk
+}
+
+func (kr *keyring) enabled() bool {
+	kk := kr.load()
+	if kk == nil {
+		return false
+	}
+
+	if len(kk.defaults) > 0 {
+		return true
+	}
+
+	for _, nk := range kk.namespaces {
+		if len(nk) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookup returns the keys of a namespace matching a key id, all of them
+// when the token names none.
+func (kr *keyring) lookup(namespace, kid string) ([][]byte, error) {
+	kk := kr.load()
+	if kk == nil {
+		return nil, jwt.ErrMissingKey
+	}
+
+	nk, ok := kk.namespaces[namespace]
+	if !ok {
+		nk = kk.defaults
+	}
+
+	if kid != "" {
+		return nk[kid], nil
+	}
+
+	keys := make([][]byte, 0, len(nk))
+	for _, k := range nk {
+		keys = append(keys, k...)
+	}
+
+	return keys, nil
+}
+
+func selectors(configured []string, defaults ...string) []string {
+	if len(configured) > 0 {
+		return configured
+	}
+
+	return defaults
+}
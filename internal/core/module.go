@@ -12,6 +12,9 @@ import (
 
 var coreModule *core
 
+// jwtConfigKey is the section of the jwt settings in the config.
+const jwtConfigKey = "core.middlewares.jwt"
+
 // type NamespaceInfo struct {
 // 	Name    string   `json:"name" mapstructure:"name"`
 // 	Domains []string `json:"domain" mapstructure:"domain"`
@@ -19,7 +22,10 @@ var coreModule *core
 
 type CoreSettings struct {
 	//httpserv.HttpParams `json:"http" mapstructure:"http"`
-	Namespaces router.NSManagerParams `json:"namespaces" mapstructure:"namespaces"`
+	Namespaces  router.NSManagerParams `json:"namespaces" mapstructure:"namespaces"`
+	Middlewares MiddlewareSettings     `json:"middlewares" mapstructure:"middlewares"`
+	// Transcoders are the external commands added to the builtin ones
+	Transcoders []TranscoderSettings `json:"transcoders" mapstructure:"transcoders"`
 }
 
 type core struct {
@@ -54,10 +60,24 @@ func (core *core) ConfigChanged() {
 	if core.settings == nil {
 		core.settings = &core.preSettings
 	}
+
+	// settings are decoded in place and keep the keys removed from the
+	// config, the keyring is rebuilt from a snapshot of the jwt section,
+	// without keys once the last one is removed.
+	jwt := JWTSettings{}
+	if err := gomodule.ConfigModule().Viper().UnmarshalKey(jwtConfigKey, &jwt); err != nil {
+		core.logger.WithError(err).Error("failed to decode the jwt keys, keyring kept")
+		return
+	}
+
+	jwtKeys.update(jwt)
 }
 
 func (core *core) ModuleRun() {
-	defaultServ = NewServ(core.ctx, core.settings.Namespaces)
+	registerTranscoders(core.settings.Transcoders, core.logger)
+
+	defaultServ = NewServ(core.ctx, core.settings.Namespaces,
+		WithBuiltins(newBuiltins(core.settings.Middlewares, core.logger)))
 }
 
 func (core *core) Type() interface{} {
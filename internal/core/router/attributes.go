@@ -0,0 +1,16 @@
+package router
+
+type sessionAttributesKey struct{}
+
+// SetSessionAttributes attaches business attributes to a session, e.g.
+// the ones returned by an authorization hook.
+func SetSessionAttributes(s Session, attrs map[string]string) {
+	s.Set(sessionAttributesKey{}, attrs)
+}
+
+// GetSessionAttributes returns the attributes of a session, nil if it has
+// none.
+func GetSessionAttributes(s Session) map[string]string {
+	attrs, _ := s.Get(sessionAttributesKey{}).(map[string]string)
+	return attrs
+}
@@ -8,8 +8,14 @@ var (
 	ErrSessionAlreadyExists = errors.New("session already exists")
 	ErrRouterClosed         = errors.New("router closed")
 	ErrSessionIdleTimeout   = errors.New("session idle timeout")
+	ErrSessionExpired       = errors.New("session lifetime expired")
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrSessionKicked        = errors.New("session kicked")
 	ErrProducerEmpty        = errors.New("producer empty")
 	ErrProducerRepeated     = errors.New("producer repeated")
+	ErrProducerRejected     = errors.New("producer rejected")
+	ErrProducerStalled      = errors.New("producer stalled")
+	ErrBitrateExceeded      = errors.New("bitrate exceeded")
 	ErrStreamFormatNotFound = errors.New("stream format not found")
 	ErrStreamClosed         = errors.New("stream closed")
 	ErrNilFrameDestination  = errors.New("nil frame destination")
@@ -0,0 +1,158 @@
+package router
+
+import (
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+// The events of the namespaces and their routers, each one is a type of
+// its own and is subscribed to by type with core.Subscribe.
+
+// SessionRole is the part a session plays in its router.
+type SessionRole string
+
+const (
+	SessionRoleProducer   SessionRole = "producer"
+	SessionRoleBackup     SessionRole = "backup"
+	SessionRoleSubscriber SessionRole = "subscriber"
+)
+
+func sessionRole(pp PeerParams) SessionRole {
+	switch {
+	case pp.Backup():
+		return SessionRoleBackup
+	case pp.Producer:
+		return SessionRoleProducer
+	}
+
+	return SessionRoleSubscriber
+}
+
+// NamespaceCreated is emitted by the NSManager when a namespace is
+// created for a domain or by name.
+type NamespaceCreated struct {
+	Namespace string
+}
+
+// NamespaceClosed is emitted by the NSManager once a removed namespace
+// closed its routers.
+type NamespaceClosed struct {
+	Namespace string
+}
+
+// RouterCreated is emitted when a namespace creates a router.
+type RouterCreated struct {
+	Namespace string
+	RouterID  string
+}
+
+// RouterClosed is emitted once a router finalized its sessions with Err.
+type RouterClosed struct {
+	Namespace string
+	RouterID  string
+	Err       error
+}
+
+// RouterIdleTimeout is emitted when a router left without producer is
+// closed after its idle subscriber timeout.
+type RouterIdleTimeout struct {
+	Namespace string
+	RouterID  string
+}
+
+// SessionEvent is the session joining or leaving a router.
+type SessionEvent struct {
+	Namespace  string
+	RouterID   string
+	SessionID  string
+	Role       SessionRole
+	PeerParams PeerParams
+}
+
+// SessionJoined is emitted once a session joined its router, a subscriber
+// may still wait for the producer.
+type SessionJoined SessionEvent
+
+// SessionLeft is emitted once a session left its router.
+type SessionLeft SessionEvent
+
+// SessionClosed is emitted by a session of a namespace when it is closed,
+// Err is the reason it was finalized with.
+type SessionClosed struct {
+	Namespace string
+	RouterID  string
+	SessionID string
+	Err       error
+}
+
+// ProducerChanged is emitted when the producer of a router changes, the
+// session ids are empty when there is none.
+type ProducerChanged struct {
+	Namespace string
+	RouterID  string
+	Previous  string
+	Current   string
+}
+
+// ProducerConflict reports how a router handled a producer joining while
+// another one was publishing.
+type ProducerConflict struct {
+	Namespace string
+	RouterID  string
+	Policy    ProducerConflictPolicy
+	// Producer is the session publishing when the new one joined.
+	Producer string
+	// Incoming is the session of the new producer.
+	Incoming string
+	// Err is the error given to the session that lost, nil if the new
+	// producer was kept as a backup.
+	Err error
+}
+
+// MetadataChanged is emitted when the media of a producer change, e.g. a
+// track is added or its codec renegotiated.
+type MetadataChanged struct {
+	Namespace string
+	RouterID  string
+	SessionID string
+	Metadata  deliver.Metadata
+}
+
+// SessionExpiryEvent reports a session reaching the end of its lifetime,
+// Router.Extend grants it more time.
+type SessionExpiryEvent struct {
+	Namespace string
+	RouterID  string
+	SessionID string
+	Producer  bool
+	Remaining time.Duration
+	Router    Router
+}
+
+// SessionExpiring is emitted ExpiryWarningTimeout before the lifetime of
+// a session ends.
+type SessionExpiring SessionExpiryEvent
+
+// SessionExpired is emitted once a session was finalized with
+// ErrSessionExpired.
+type SessionExpired SessionExpiryEvent
+
+// ProducerStallEvent reports a media of a producer missing or back, the
+// duration is how long it has been missing.
+type ProducerStallEvent struct {
+	Namespace string
+	RouterID  string
+	SessionID string
+	Media     string
+	Duration  time.Duration
+	Action    WatchdogAction
+}
+
+// ProducerStalled is emitted when a stall threshold is crossed, before
+// its action runs.
+type ProducerStalled ProducerStallEvent
+
+// ProducerRecovered is emitted when the media of a stalled producer flows
+// again.
+type ProducerRecovered ProducerStallEvent
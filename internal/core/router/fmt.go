@@ -5,6 +5,7 @@ import (
 
 	sourcemanager "github.com/pingostack/neon/internal/core/router/source_manager"
 	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/transcoder"
 )
 
 type StreamFormat interface {
@@ -16,6 +17,8 @@ type StreamFormatImpl struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 	sm     *sourcemanager.Instance
+	src    deliver.FrameSource
+	tc     transcoder.Transcoder
 }
 
 type StreamFormatOption func(*StreamFormatImpl)
@@ -26,6 +29,22 @@ func WithFrameSourceManager(sm *sourcemanager.Instance) StreamFormatOption {
 	}
 }
 
+// WithFrameSource feeds the format from src instead of the default source
+// of the source manager.
+func WithFrameSource(src deliver.FrameSource) StreamFormatOption {
+	return func(fmt *StreamFormatImpl) {
+		fmt.src = src
+	}
+}
+
+// WithTranscoder converts the frames of the source before they reach the
+// destinations of the format.
+func WithTranscoder(tc transcoder.Transcoder) StreamFormatOption {
+	return func(fmt *StreamFormatImpl) {
+		fmt.tc = tc
+	}
+}
+
 func NewStreamFormat(ctx context.Context, fmtSettings deliver.FormatSettings, opts ...StreamFormatOption) (StreamFormat, error) {
 	fmt := &StreamFormatImpl{}
 
@@ -37,18 +56,31 @@ func NewStreamFormat(ctx context.Context, fmtSettings deliver.FormatSettings, op
 		opt(fmt)
 	}
 
-	if fmt.sm.DefaultSource() == nil {
+	src := fmt.src
+	if src == nil && fmt.sm != nil {
+		src = fmt.sm.DefaultSource()
+	}
+
+	if src == nil {
 		return nil, ErrNilFrameSource
 	}
 
 	fmt.MediaFramePipe = deliver.NewMediaFramePipe(ctx, fmtSettings)
 
-	deliver.AddDestination(fmt.sm.DefaultSource(), fmt)
+	if fmt.tc != nil {
+		deliver.AddDestination(src, fmt.tc)
+		deliver.AddDestination(fmt.tc, fmt)
+	} else {
+		deliver.AddDestination(src, fmt)
+	}
 
 	return fmt, nil
 }
 
 func (fmt *StreamFormatImpl) Close() {
+	if fmt.tc != nil {
+		fmt.tc.Close()
+	}
 	fmt.MediaFramePipe.Close()
 	fmt.cancel()
 }
@@ -0,0 +1,159 @@
+package router
+
+import (
+	"time"
+)
+
+// lifetime is the time left to a session before the router finalizes it
+// with ErrSessionExpired.
+type lifetime struct {
+	session  Session
+	deadline time.Time
+	warn     *time.Timer
+	expire   *time.Timer
+}
+
+func (lt *lifetime) stop() {
+	if lt.warn != nil {
+		lt.warn.Stop()
+	}
+
+	if lt.expire != nil {
+		lt.expire.Stop()
+	}
+}
+
+// maxLifetime returns the limit of the router for the kind of a session,
+// or the cap of the session if it is shorter.
+func (r *RouterImpl) maxLifetime(s Session) time.Duration {
+	max := time.Duration(r.params.MaxSubscriberTimeout) * time.Second
+	if s.PeerParams().Producer {
+		max = time.Duration(r.params.MaxProducerTimeout) * time.Second
+	}
+
+	if capped := GetSessionLimits(s).MaxDuration; capped > 0 && (max <= 0 || capped < max) {
+		max = capped
+	}
+
+	return max
+}
+
+// startLifetime limits the lifetime of a joining session, if the router
+// has a limit for its kind. The lock must be held.
+func (r *RouterImpl) startLifetime(s Session) {
+	max := r.maxLifetime(s)
+	if max <= 0 {
+		return
+	}
+
+	lt := &lifetime{
+		session:  s,
+		deadline: time.Now().Add(max),
+	}
+	r.lifetimes[s.ID()] = lt
+	r.scheduleLifetime(lt)
+}
+
+// scheduleLifetime arms the timers of lt for its deadline. The lock must
+// be held.
+func (r *RouterImpl) scheduleLifetime(lt *lifetime) {
+	lt.stop()
+
+	remaining := time.Until(lt.deadline)
+	if warning := time.Duration(r.params.ExpiryWarningTimeout) * time.Second; warning > 0 {
+		wait := remaining - warning
+		if wait < 0 {
+			wait = 0
+		}
+		lt.warn = time.AfterFunc(wait, func() { r.onLifetimeWarning(lt) })
+	}
+
+	lt.expire = time.AfterFunc(remaining, func() { r.onLifetimeExpired(lt) })
+}
+
+func (r *RouterImpl) stopLifetime(s Session) {
+	if lt, ok := r.lifetimes[s.ID()]; ok {
+		lt.stop()
+		delete(r.lifetimes, s.ID())
+	}
+}
+
+func (r *RouterImpl) onLifetimeWarning(lt *lifetime) {
+	r.lock.RLock()
+	if r.closed || r.lifetimes[lt.session.ID()] != lt {
+		r.lock.RUnlock()
+		return
+	}
+	remaining := time.Until(lt.deadline)
+	r.lock.RUnlock()
+
+	r.logger.Infof("session %s expires in %s", lt.session.ID(), remaining.Round(time.Second))
+
+	r.ns.emit(SessionExpiring{
+		Namespace: r.ns.Name(),
+		RouterID:  r.id,
+		SessionID: lt.session.ID(),
+		Producer:  lt.session.PeerParams().Producer,
+		Remaining: remaining,
+		Router:    r,
+	})
+}
+
+func (r *RouterImpl) onLifetimeExpired(lt *lifetime) {
+	r.lock.Lock()
+	// extended meanwhile
+	if r.closed || r.lifetimes[lt.session.ID()] != lt || time.Now().Before(lt.deadline) {
+		r.lock.Unlock()
+		return
+	}
+	delete(r.lifetimes, lt.session.ID())
+	r.lock.Unlock()
+
+	r.logger.Infof("session %s lifetime expired", lt.session.ID())
+	lt.session.Finalize(ErrSessionExpired)
+
+	r.ns.emit(SessionExpired{
+		Namespace: r.ns.Name(),
+		RouterID:  r.id,
+		SessionID: lt.session.ID(),
+		Producer:  lt.session.PeerParams().Producer,
+		Router:    r,
+	})
+}
+
+// Remaining returns the time left to a session, false if the session has
+// no lifetime limit or is not in the router.
+func (r *RouterImpl) Remaining(sessionID string) (time.Duration, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	lt, ok := r.lifetimes[sessionID]
+	if !ok {
+		return 0, false
+	}
+
+	return time.Until(lt.deadline), true
+}
+
+// Extend pushes the deadline of a session back by d, e.g. from a listener
+// of SessionExpiring granting more time.
+func (r *RouterImpl) Extend(sessionID string, d time.Duration) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return ErrRouterClosed
+	}
+
+	lt, ok := r.lifetimes[sessionID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	lt.deadline = lt.deadline.Add(d)
+	r.scheduleLifetime(lt)
+
+	r.logger.Infof("session %s lifetime extended by %s", sessionID, d)
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package router
+
+import "time"
+
+// SessionLimits are the caps granted to a session, e.g. by its token, on
+// top of the limits of the router. A zero cap does not limit.
+type SessionLimits struct {
+	// MaxDuration caps the lifetime of the session
+	MaxDuration time.Duration
+	// MaxBitrate caps the bitrate of a producer, in kbps
+	MaxBitrate int
+}
+
+type sessionLimitsKey struct{}
+
+// SetSessionLimits sets the caps of a session, before it joins a router.
+func SetSessionLimits(s Session, limits SessionLimits) {
+	s.Set(sessionLimitsKey{}, limits)
+}
+
+// GetSessionLimits returns the caps of a session.
+func GetSessionLimits(s Session) SessionLimits {
+	limits, _ := s.Get(sessionLimitsKey{}).(SessionLimits)
+	return limits
+}
@@ -2,15 +2,45 @@ package router
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
 
+	"github.com/pingostack/neon/internal/core/event"
+	"github.com/pingostack/neon/pkg/eventemitter"
 	"github.com/sirupsen/logrus"
 )
 
+// ProducerConflictPolicy tells a router what to do when a producer joins
+// while another one is publishing.
+type ProducerConflictPolicy string
+
+const (
+	// ProducerConflictKickOld finalizes the current producer, the default.
+	ProducerConflictKickOld ProducerConflictPolicy = "kick_old"
+	// ProducerConflictRejectNew keeps the current producer and fails the
+	// join of the new one with ErrProducerRejected.
+	ProducerConflictRejectNew ProducerConflictPolicy = "reject_new"
+	// ProducerConflictBackup keeps the new producer as a backup.
+	ProducerConflictBackup ProducerConflictPolicy = "backup"
+)
+
 type RouterParams struct {
 	IdleSubscriberTimeout int `yaml:"idle_subscriber_timeout" json:"idle_subscriber_timeout" mapstructure:"idle_subscriber_timeout"`
 	MaxProducerTimeout    int `yaml:"max_producer_timeout" json:"max_producer_timeout" mapstructure:"max_producer_timeout"`
 	MaxSubscriberTimeout  int `yaml:"max_subscriber_timeout" json:"max_subscriber_timeout" mapstructure:"max_subscriber_timeout"`
+	// ExpiryWarningTimeout is how many seconds before the end of its
+	// lifetime a session is reported by SessionExpiring.
+	ExpiryWarningTimeout int `yaml:"expiry_warning_timeout" json:"expiry_warning_timeout" mapstructure:"expiry_warning_timeout"`
+	// BackupStallTimeoutMs is how long the primary producer may stay
+	// silent before its backup takes over.
+	BackupStallTimeoutMs int `yaml:"backup_stall_timeout_ms" json:"backup_stall_timeout_ms" mapstructure:"backup_stall_timeout_ms"`
+	// ProducerConflictPolicy is one of kick_old, reject_new and backup,
+	// kick_old if empty.
+	ProducerConflictPolicy ProducerConflictPolicy `yaml:"producer_conflict_policy" json:"producer_conflict_policy" mapstructure:"producer_conflict_policy"`
+	// StallThresholds are the actions run while a producer sends no
+	// frames, a failover after BackupStallTimeoutMs if empty.
+	StallThresholds []WatchdogThreshold `yaml:"stall_thresholds" json:"stall_thresholds" mapstructure:"stall_thresholds"`
 }
 
 type NamespaceParams struct {
@@ -29,10 +59,12 @@ type Namespace struct {
 	cancel  context.CancelFunc
 	logger  *logrus.Entry
 	params  NamespaceParams
+	ee      eventemitter.EventEmitter
 }
 
-func NewNamespace(ctx context.Context, params NamespaceParams) *Namespace {
+func NewNamespace(ctx context.Context, params NamespaceParams, ee eventemitter.EventEmitter) *Namespace {
 	ns := &Namespace{
+		ee:      ee,
 		params:  params,
 		name:    params.Name,
 		domains: params.Domains,
@@ -61,6 +93,24 @@ func (ns *Namespace) Domains() []string {
 	return domains
 }
 
+// Routers returns the routers of the namespace sorted by id.
+func (ns *Namespace) Routers() []Router {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+	routers := make([]Router, 0, len(ns.routers))
+	for _, r := range ns.routers {
+		routers = append(routers, r)
+	}
+	sort.Slice(routers, func(i, j int) bool {
+		return routers[i].ID() < routers[j].ID()
+	})
+	return routers
+}
+
+func (ns *Namespace) String() string {
+	return fmt.Sprintf("Namespace(%s, %d routers)", ns.Name(), len(ns.Routers()))
+}
+
 func (ns *Namespace) Router(name string) Router {
 	ns.lock.RLock()
 	defer ns.lock.RUnlock()
@@ -98,6 +148,22 @@ func (ns *Namespace) waitRouterDone(router Router) {
 	ns.logger.Infof("router %s removed", router.ID())
 }
 
+// emit sends an event of the namespace, nothing happens without an
+// event emitter.
+func (ns *Namespace) emit(ev interface{}) {
+	emit(ns.ee, ns.logger, ev)
+}
+
+func emit(ee eventemitter.EventEmitter, logger *logrus.Entry, ev interface{}) {
+	if ee == nil {
+		return
+	}
+
+	if err := event.Emit(ee, ev); err != nil {
+		logger.WithError(err).Warnf("failed to emit %T", ev)
+	}
+}
+
 func (ns *Namespace) HasDomain(domain string) bool {
 	ns.lock.RLock()
 	defer ns.lock.RUnlock()
@@ -109,6 +175,16 @@ func (ns *Namespace) HasDomain(domain string) bool {
 	return false
 }
 
+// Close closes the routers of the namespace with e.
+func (ns *Namespace) Close(e error) {
+	for _, r := range ns.Routers() {
+		r.Close(e)
+	}
+
+	ns.cancel()
+	ns.logger.Infof("namespace closed")
+}
+
 func (ns *Namespace) RemoveRouter(r Router) {
 	ns.lock.Lock()
 	defer ns.lock.Unlock()
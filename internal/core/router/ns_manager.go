@@ -2,7 +2,13 @@ package router
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
+
+	"github.com/pingostack/neon/pkg/eventemitter"
+	"github.com/sirupsen/logrus"
 )
 
 type NSManagerParams struct {
@@ -14,13 +20,30 @@ type NSManager struct {
 	namespaces map[string]*Namespace
 	lock       sync.RWMutex
 	params     NSManagerParams
+	ee         eventemitter.EventEmitter
+}
+
+type NSManagerOption func(*NSManager)
+
+// WithEventEmitter makes the namespaces and their routers emit their
+// events on ee.
+func WithEventEmitter(ee eventemitter.EventEmitter) NSManagerOption {
+	return func(m *NSManager) {
+		m.ee = ee
+	}
 }
 
-func NewNSManager(params NSManagerParams) *NSManager {
-	return &NSManager{
+func NewNSManager(params NSManagerParams, opts ...NSManagerOption) *NSManager {
+	m := &NSManager{
 		namespaces: make(map[string]*Namespace),
 		params:     params,
 	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
 }
 
 func (m *NSManager) LookupDomain(domain string) (*Namespace, bool) {
@@ -47,8 +70,9 @@ func (m *NSManager) GetOrNewNamespace(ctx context.Context, name string) (*Namesp
 		if len(params.Domains) == 0 {
 			params.Domains = []string{name}
 		}
-		ns = NewNamespace(ctx, params)
+		ns = NewNamespace(ctx, params, m.ee)
 		m.namespaces[name] = ns
+		m.emit(NamespaceCreated{Namespace: name})
 	}
 
 	return ns, ok
@@ -89,8 +113,9 @@ func (m *NSManager) GetOrNewNamespaceByDomain(ctx context.Context, domain string
 
 	params := getNSParams()
 
-	ns := NewNamespace(ctx, params)
+	ns := NewNamespace(ctx, params, m.ee)
 	m.namespaces[params.Name] = ns
+	m.emit(NamespaceCreated{Namespace: params.Name})
 	return ns, true
 }
 
@@ -101,9 +126,68 @@ func (m *NSManager) Namespaces() []*Namespace {
 	for _, ns := range m.namespaces {
 		namespaces = append(namespaces, ns)
 	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Name() < namespaces[j].Name()
+	})
 	return namespaces
 }
 
+// RemoveNamespace removes a namespace and closes its routers with e, the
+// namespace is created again by the next session of its domains.
+func (m *NSManager) RemoveNamespace(name string, e error) error {
+	m.lock.Lock()
+	ns, ok := m.namespaces[name]
+	if ok {
+		delete(m.namespaces, name)
+	}
+	m.lock.Unlock()
+
+	if !ok {
+		return ErrNSNotFound
+	}
+
+	ns.Close(e)
+	m.emit(NamespaceClosed{Namespace: name})
+
+	return nil
+}
+
+func (m *NSManager) emit(ev interface{}) {
+	emit(m.ee, logrus.WithField("obj", "nsmanager"), ev)
+}
+
+// LookupRouter finds a router by id in any namespace.
+func (m *NSManager) LookupRouter(id string) (Router, bool) {
+	for _, ns := range m.Namespaces() {
+		if r := ns.Router(id); r != nil {
+			return r, true
+		}
+	}
+
+	return nil, false
+}
+
+// LookupSession finds a session by id in any router.
+func (m *NSManager) LookupSession(id string) (Session, bool) {
+	for _, ns := range m.Namespaces() {
+		for _, r := range ns.Routers() {
+			if s := r.Session(id); s != nil {
+				return s, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
 func (m *NSManager) String() string {
-	return "NSManager" // TODO
+	namespaces := m.Namespaces()
+	names := make([]string, 0, len(namespaces))
+	routers := 0
+	for _, ns := range namespaces {
+		names = append(names, ns.Name())
+		routers += len(ns.Routers())
+	}
+
+	return fmt.Sprintf("NSManager(namespaces: [%s], routers: %d)", strings.Join(names, ", "), routers)
 }
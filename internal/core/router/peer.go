@@ -2,6 +2,8 @@ package router
 
 import (
 	"context"
+	"net/url"
+	"time"
 
 	"github.com/pingostack/neon/pkg/deliver"
 	"github.com/sirupsen/logrus"
@@ -24,8 +26,31 @@ type PeerParams struct {
 	HasDataChannel bool
 }
 
+// QueryArgs turns the query of a request URL into PeerParams.Args, the
+// first value of each key is kept.
+func QueryArgs(query url.Values) map[string]string {
+	args := make(map[string]string, len(query))
+	for k, v := range query {
+		if len(v) > 0 {
+			args[k] = v[0]
+		}
+	}
+
+	return args
+}
+
+// ProducerRoleBackup is the role argument of a producer kept warm while
+// the primary one flows.
+const ProducerRoleBackup = "backup"
+
+// Backup reports whether the peer publishes as a backup producer.
+func (p PeerParams) Backup() bool {
+	return p.Producer && p.Args["role"] == ProducerRoleBackup
+}
+
 type Session interface {
 	ID() string
+	CreatedAt() time.Time
 	Set(key, value interface{})
 	Get(key interface{}) interface{}
 	Logger() *logrus.Entry
@@ -36,7 +61,11 @@ type Session interface {
 	SetRouter(r Router)
 	PeerParams() PeerParams
 	Finalize(e error)
+	// Err is the error of Finalize, once the context is done
+	Err() error
 	RouterID() string
+	// SetRouterID moves the session to another router, before it joins
+	SetRouterID(id string)
 	BindFrameSource(src deliver.FrameSource) error
 	BindFrameDestination(dest deliver.FrameDestination) error
 	FrameSource() deliver.FrameSource
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gogf/gf/os/gtimer"
+	"github.com/pingostack/neon/pkg/metrics"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -16,6 +17,15 @@ type Router interface {
 	Namespace() *Namespace
 	Context() context.Context
 	Closed() bool
+	Remaining(sessionID string) (time.Duration, bool)
+	Extend(sessionID string, d time.Duration) error
+	CreatedAt() time.Time
+	Producer() Session
+	Backups() []Session
+	Subscribers() []Session
+	Session(id string) Session
+	Kick(sessionID string, e error) error
+	Close(e error)
 }
 
 type RouterImpl struct {
@@ -24,29 +34,48 @@ type RouterImpl struct {
 	id          string
 	ns          *Namespace
 	producer    Session
+	backups     map[string]Session
 	subscribers map[string]Session
+	lifetimes   map[string]*lifetime
+	watchdogs   map[string]*watchdog
 	lock        sync.RWMutex
 	logger      *logrus.Entry
 	closed      bool
 	params      RouterParams
 	closeTimer  *gtimer.Entry
 	stream      Stream
+	stats       *metrics.Stream
+	createdAt   time.Time
 }
 
 func NewRouter(ctx context.Context, ns *Namespace, params RouterParams, id string, logger *logrus.Entry) Router {
+	// the namespace lock is held while routers are created
+	stats := metrics.NewStream(ns.name, id)
 	r := &RouterImpl{
 		ns:          ns,
 		params:      params,
 		id:          id,
+		backups:     make(map[string]Session),
 		subscribers: make(map[string]Session),
+		lifetimes:   make(map[string]*lifetime),
+		watchdogs:   make(map[string]*watchdog),
+		createdAt:   time.Now(),
 		logger:      logger.WithField("obj", "router"),
-		stream:      NewStreamImpl(ctx, id),
+		stats:       stats,
+		stream: NewStreamImpl(ctx, id,
+			WithStallTimeout(time.Duration(params.BackupStallTimeoutMs)*time.Millisecond),
+			WithStats(stats)),
 	}
 
 	r.ctx, r.cancel = context.WithCancel(ctx)
 
 	r.logger.Infof("router created")
 
+	ns.emit(RouterCreated{
+		Namespace: ns.name,
+		RouterID:  id,
+	})
+
 	return r
 }
 
@@ -68,17 +97,134 @@ func (r *RouterImpl) addProducer(s Session) error {
 		r.closeTimer = nil
 	}
 
-	if r.producer != nil {
-		r.producer.Finalize(ErrProducerRepeated)
-	}
+	// the previous producer is left as it is until the source of s is
+	// added, a failure keeps it producing
+	previous := r.producer
+	demote := previous != nil && previous.PeerParams().Backup()
+	var kicked *ProducerConflict
+	if previous != nil && !demote {
+		ev := ProducerConflict{
+			Namespace: r.ns.Name(),
+			RouterID:  r.id,
+			Policy:    r.params.ProducerConflictPolicy,
+			Producer:  previous.ID(),
+			Incoming:  s.ID(),
+		}
 
-	r.producer = s
+		switch r.params.ProducerConflictPolicy {
+		case ProducerConflictRejectNew:
+			ev.Err = ErrProducerRejected
+			r.ns.emit(ev)
+			r.logger.Infof("producer %s rejected, %s is publishing", s.ID(), previous.ID())
+			return ErrProducerRejected
+		case ProducerConflictBackup:
+			r.ns.emit(ev)
+			r.logger.Infof("producer %s kept as backup of %s", s.ID(), previous.ID())
+			return r.addBackupLocked(s)
+		default:
+			ev.Policy = ProducerConflictKickOld
+			ev.Err = ErrProducerRepeated
+			kicked = &ev
+		}
+	}
 
 	if err := r.stream.AddFrameSource(s.FrameSource()); err != nil {
 		r.logger.WithError(err).Error("failed to add frame source")
 		return errors.Wrap(err, "failed to add frame source")
 	}
 
+	if demote {
+		// a promoted backup makes way for the primary, it is delivered
+		// until the keyframe of the primary
+		r.stream.DemoteFrameSource(previous.FrameSource())
+		r.backups[previous.ID()] = previous
+		r.logger.Infof("producer %s back to backup", previous.ID())
+	} else if kicked != nil {
+		r.ns.emit(*kicked)
+		r.logger.Infof("producer %s replaced by %s", previous.ID(), s.ID())
+		previous.Finalize(ErrProducerRepeated)
+	}
+
+	r.producer = s
+	r.emitProducerChanged(previous, s)
+
+	r.startWatchdog(s)
+	r.startLifetime(s)
+	r.emitSession(true, s)
+
+	go r.waitSessionDone(s)
+
+	return nil
+}
+
+func (r *RouterImpl) addBackup(s Session) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return ErrRouterClosed
+	}
+
+	if err := r.addBackupLocked(s); err != nil {
+		return err
+	}
+
+	// a backup joining a router without producer is delivered at once
+	if r.producer == nil {
+		r.producer = r.promoteBackupLocked()
+		if r.producer != nil {
+			r.emitProducerChanged(nil, r.producer)
+		}
+	}
+
+	return nil
+}
+
+// promoteBackupLocked makes the backup the stream delivers, or delivers
+// next, the producer. It returns nil if there is no backup. The lock must
+// be held.
+func (r *RouterImpl) promoteBackupLocked() Session {
+	src := r.stream.PromoteBackupFrameSource()
+	if src == nil {
+		return nil
+	}
+
+	for id, b := range r.backups {
+		if b.FrameSource() == src {
+			delete(r.backups, id)
+			r.logger.Infof("backup producer %s promoted", id)
+			return b
+		}
+	}
+
+	return nil
+}
+
+func (r *RouterImpl) addBackupLocked(s Session) error {
+	if _, ok := r.backups[s.ID()]; ok {
+		return ErrSessionAlreadyExists
+	}
+
+	if r.closeTimer != nil {
+		r.closeTimer.Stop()
+		r.closeTimer.Close()
+		r.closeTimer = nil
+	}
+
+	r.backups[s.ID()] = s
+
+	if err := r.stream.AddBackupFrameSource(s.FrameSource()); err != nil {
+		delete(r.backups, s.ID())
+		r.logger.WithError(err).Error("failed to add backup frame source")
+		return errors.Wrap(err, "failed to add backup frame source")
+	}
+
+	r.logger.Infof("backup producer %s added", s.ID())
+
+	r.startWatchdog(s)
+	r.startLifetime(s)
+	r.emitSession(true, s)
+
 	go r.waitSessionDone(s)
 
 	return nil
@@ -98,53 +244,128 @@ func (r *RouterImpl) addSubscriber(s Session) error {
 
 	r.subscribers[s.ID()] = s
 
-	if err := r.stream.AddFrameDestination(s.FrameDestination()); err != nil {
+	err := r.stream.AddFrameDestination(s.FrameDestination())
+	if err != nil && !errors.Is(err, ErrPaddingDestination) {
 		return errors.Wrap(err, "failed to add frame destination")
 	}
 
+	// a padding subscriber waits for the producer and is timed as well
+	r.startLifetime(s)
+	r.emitSession(true, s)
+
 	go r.waitSessionDone(s)
 
+	if err != nil {
+		return errors.Wrap(err, "failed to add frame destination")
+	}
+
 	return nil
 }
 
 func (r *RouterImpl) AddSession(s Session) error {
-	if s.PeerParams().Producer {
+	if s.PeerParams().Backup() {
+		return r.addBackup(s)
+	} else if s.PeerParams().Producer {
 		return r.addProducer(s)
 	} else {
 		return r.addSubscriber(s)
 	}
 }
 
-func (r *RouterImpl) waitSessionDone(s Session) {
-	<-s.Context().Done()
+// closeLocked finalizes all the sessions of the router with e. The lock
+// must be held.
+func (r *RouterImpl) closeLocked(e error) {
+	if r.closed {
+		return
+	}
 
-	close := func(e error) {
-		if r.closed {
-			return
-		}
+	r.closed = true
+	r.cancel()
+	r.stats.Close()
 
-		r.closed = true
-		r.cancel()
+	for _, lt := range r.lifetimes {
+		lt.stop()
+	}
+	r.lifetimes = make(map[string]*lifetime)
 
-		if r.producer != nil {
-			r.producer.Finalize(e)
-		}
+	for _, w := range r.watchdogs {
+		w.stop()
+	}
+	r.watchdogs = make(map[string]*watchdog)
 
-		for _, s := range r.subscribers {
-			s.Finalize(e)
-		}
+	if r.producer != nil {
+		r.producer.Finalize(e)
+	}
+
+	for _, s := range r.backups {
+		s.Finalize(e)
+	}
 
-		r.logger.Infof("router closed")
+	for _, s := range r.subscribers {
+		s.Finalize(e)
 	}
 
+	r.logger.Infof("router closed")
+
+	r.ns.emit(RouterClosed{
+		Namespace: r.ns.Name(),
+		RouterID:  r.id,
+		Err:       e,
+	})
+}
+
+// emitSession sends SessionJoined or SessionLeft for a session.
+func (r *RouterImpl) emitSession(joined bool, s Session) {
+	pp := s.PeerParams()
+	ev := SessionEvent{
+		Namespace:  r.ns.Name(),
+		RouterID:   r.id,
+		SessionID:  s.ID(),
+		Role:       sessionRole(pp),
+		PeerParams: pp,
+	}
+
+	if joined {
+		r.ns.emit(SessionJoined(ev))
+	} else {
+		r.ns.emit(SessionLeft(ev))
+	}
+}
+
+// emitProducerChanged sends ProducerChanged, a nil session is no
+// producer.
+func (r *RouterImpl) emitProducerChanged(previous, current Session) {
+	ev := ProducerChanged{
+		Namespace: r.ns.Name(),
+		RouterID:  r.id,
+	}
+
+	if previous != nil {
+		ev.Previous = previous.ID()
+	}
+
+	if current != nil {
+		ev.Current = current.ID()
+	}
+
+	r.ns.emit(ev)
+}
+
+func (r *RouterImpl) waitSessionDone(s Session) {
+	<-s.Context().Done()
+
 	delayClose := func() {
 		r.closeTimer = gtimer.AddOnce(time.Duration(r.params.IdleSubscriberTimeout)*time.Second, func() {
 			r.lock.Lock()
 			defer r.lock.Unlock()
 
-			if r.producer != nil {
+			if r.producer == nil && len(r.backups) == 0 && !r.closed {
 				r.logger.Infof("router idle timeout")
-				close(ErrSessionIdleTimeout)
+				r.ns.emit(RouterIdleTimeout{
+					Namespace: r.ns.Name(),
+					RouterID:  r.id,
+				})
+				r.closeLocked(ErrSessionIdleTimeout)
 			}
 		})
 		r.closeTimer.Start()
@@ -153,16 +374,35 @@ func (r *RouterImpl) waitSessionDone(s Session) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
+	r.stopLifetime(s)
+	r.stopWatchdog(s)
+
+	r.emitSession(false, s)
+
 	if s.PeerParams().Producer {
-		r.producer = nil
-		r.logger.Infof("producer %s removed", s.ID())
-		if len(r.subscribers) > 0 {
+		if src := s.FrameSource(); src != nil {
+			r.stream.RemoveFrameSource(src)
+		}
+
+		if _, ok := r.backups[s.ID()]; ok {
+			delete(r.backups, s.ID())
+			r.logger.Infof("backup producer %s removed", s.ID())
+		} else {
+			// a replaced producer is gone already, a backup takes over
+			if r.producer == s {
+				r.producer = r.promoteBackupLocked()
+				r.emitProducerChanged(s, r.producer)
+			}
+			r.logger.Infof("producer %s removed", s.ID())
+		}
+
+		if r.producer == nil && len(r.backups) == 0 && len(r.subscribers) > 0 {
 			if r.params.IdleSubscriberTimeout > 0 {
 				delayClose()
 				return
 			} else if r.params.IdleSubscriberTimeout == 0 {
 				r.logger.Infof("router idle timeout is 0, close router")
-				close(ErrProducerEmpty)
+				r.closeLocked(ErrProducerEmpty)
 				return
 			} else {
 				r.logger.Debugf("router idle timeout disabled, keep router")
@@ -173,10 +413,82 @@ func (r *RouterImpl) waitSessionDone(s Session) {
 		r.logger.Infof("subscriber %s removed", s.ID())
 	}
 
-	if len(r.subscribers) == 0 && r.producer == nil {
+	if len(r.subscribers) == 0 && r.producer == nil && len(r.backups) == 0 {
 		r.logger.Infof("no producer and subscribers, close router")
-		close(nil)
+		r.closeLocked(nil)
+	}
+}
+
+func (r *RouterImpl) CreatedAt() time.Time {
+	return r.createdAt
+}
+
+func (r *RouterImpl) Producer() Session {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.producer
+}
+
+func (r *RouterImpl) Backups() []Session {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	backups := make([]Session, 0, len(r.backups))
+	for _, s := range r.backups {
+		backups = append(backups, s)
+	}
+	return backups
+}
+
+func (r *RouterImpl) Subscribers() []Session {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	subscribers := make([]Session, 0, len(r.subscribers))
+	for _, s := range r.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	return subscribers
+}
+
+// Session looks a producer, backup or subscriber up by id, nil if the
+// router has none.
+func (r *RouterImpl) Session(id string) Session {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if r.producer != nil && r.producer.ID() == id {
+		return r.producer
 	}
+
+	if s, ok := r.backups[id]; ok {
+		return s
+	}
+
+	return r.subscribers[id]
+}
+
+// Kick finalizes a session of the router with e, ErrSessionKicked if nil.
+func (r *RouterImpl) Kick(sessionID string, e error) error {
+	s := r.Session(sessionID)
+	if s == nil {
+		return ErrSessionNotFound
+	}
+
+	if e == nil {
+		e = ErrSessionKicked
+	}
+
+	r.logger.Infof("session %s kicked", sessionID)
+	s.Finalize(e)
+
+	return nil
+}
+
+// Close finalizes all the sessions of the router with e.
+func (r *RouterImpl) Close(e error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.closeLocked(e)
 }
 
 func (r *RouterImpl) Namespace() *Namespace {
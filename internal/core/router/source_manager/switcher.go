@@ -0,0 +1,476 @@
+package sourcemanager
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pion/rtp"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/atomic"
+)
+
+const (
+	DefaultStallTimeout = 2 * time.Second
+	switchCheckInterval = 250 * time.Millisecond
+	keyFrameRetry       = time.Second
+)
+
+// Switcher delivers the frames of one of its sources, the primary while
+// it flows and a backup otherwise. The switch happens on a keyframe of the
+// new source and the RTP headers are rewritten so that the destinations
+// see a single continuous stream.
+type Switcher struct {
+	deliver.FrameSource
+	ctx          context.Context
+	cancel       context.CancelFunc
+	logger       *logrus.Entry
+	stallTimeout time.Duration
+	lock         sync.Mutex
+	inputs       []*switchInput
+	active       *switchInput
+	pending      *switchInput
+	lastPLI      time.Time
+	audio        rtpRewriter
+	video        rtpRewriter
+	metadata     deliver.Metadata
+	hasMetadata  bool
+	stats        *metrics.Stream
+}
+
+type SwitcherOption func(*Switcher)
+
+// WithStats counts the delivered and dropped frames.
+func WithStats(stats *metrics.Stream) SwitcherOption {
+	return func(sw *Switcher) {
+		sw.stats = stats
+	}
+}
+
+// switchInput receives the frames of one source.
+type switchInput struct {
+	deliver.FrameDestination
+	sw        *Switcher
+	src       deliver.FrameSource
+	backup    bool
+	lastFrame atomic.Int64
+}
+
+func (in *switchInput) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	in.lastFrame.Store(time.Now().UnixNano())
+	in.sw.onFrame(in, frame, attr)
+}
+
+func (in *switchInput) OnMetaData(metadata *deliver.Metadata) {
+	in.FrameDestination.OnMetaData(metadata)
+	in.sw.onMetaData(in, metadata)
+}
+
+func (in *switchInput) stalled(now time.Time, timeout time.Duration) bool {
+	return now.Sub(time.Unix(0, in.lastFrame.Load())) > timeout
+}
+
+func NewSwitcher(ctx context.Context, stallTimeout time.Duration, logger *logrus.Entry, opts ...SwitcherOption) *Switcher {
+	if stallTimeout <= 0 {
+		stallTimeout = DefaultStallTimeout
+	}
+
+	if logger == nil {
+		logger = logrus.WithField("obj", "source-switcher")
+	} else {
+		logger = logger.WithField("obj", "source-switcher")
+	}
+
+	sw := &Switcher{
+		logger:       logger,
+		stallTimeout: stallTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(sw)
+	}
+
+	sw.ctx, sw.cancel = context.WithCancel(ctx)
+	sw.FrameSource = deliver.NewFrameSourceImpl(sw.ctx, deliver.Metadata{})
+
+	go sw.watch()
+
+	return sw
+}
+
+// AddSource adds a primary or backup source, the first source is active
+// at once and a primary replaces a backup on its next keyframe.
+func (sw *Switcher) AddSource(src deliver.FrameSource, backup bool) error {
+	in := &switchInput{
+		FrameDestination: deliver.NewFrameDestinationImpl(sw.ctx, src.FormatSettings()),
+		sw:               sw,
+		src:              src,
+		backup:           backup,
+	}
+	in.lastFrame.Store(time.Now().UnixNano())
+
+	sw.lock.Lock()
+	sw.inputs = append(sw.inputs, in)
+	if sw.active == nil && sw.pending == nil {
+		sw.active = in
+	} else if !backup {
+		sw.pending = in
+	}
+	sw.lock.Unlock()
+
+	// the metadata of the first source is forwarded from here
+	if err := deliver.AddDestination(src, in); err != nil {
+		sw.RemoveSource(src)
+		return err
+	}
+
+	return nil
+}
+
+// RemoveSource drops a source, if it was delivering a backup takes over.
+func (sw *Switcher) RemoveSource(src deliver.FrameSource) {
+	sw.lock.Lock()
+	var removed *switchInput
+	for i, in := range sw.inputs {
+		if in.src == src {
+			removed = in
+			sw.inputs = append(sw.inputs[:i], sw.inputs[i+1:]...)
+			break
+		}
+	}
+
+	if removed == nil {
+		sw.lock.Unlock()
+		return
+	}
+
+	if sw.pending == removed {
+		sw.pending = nil
+	}
+
+	if sw.active == removed {
+		sw.active = nil
+		sw.failover(time.Now(), false)
+	}
+	sw.lock.Unlock()
+
+	removed.Close()
+}
+
+// Promote makes a backup a primary source: the one about to be delivered,
+// else the delivered one, else the first added. It returns nil if there
+// is no backup.
+func (sw *Switcher) Promote() deliver.FrameSource {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+
+	var promoted *switchInput
+	for _, in := range []*switchInput{sw.pending, sw.active} {
+		if in != nil && in.backup {
+			promoted = in
+			break
+		}
+	}
+
+	if promoted == nil {
+		for _, in := range sw.inputs {
+			if in.backup {
+				promoted = in
+				break
+			}
+		}
+	}
+
+	if promoted == nil {
+		return nil
+	}
+
+	promoted.backup = false
+
+	return promoted.src
+}
+
+// Demote makes src a backup source again, a primary added next replaces
+// it on its keyframe.
+func (sw *Switcher) Demote(src deliver.FrameSource) {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+
+	for _, in := range sw.inputs {
+		if in.src == src {
+			in.backup = true
+			return
+		}
+	}
+}
+
+// Active returns the delivered source, nil if none.
+func (sw *Switcher) Active() deliver.FrameSource {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+
+	if sw.active == nil {
+		return nil
+	}
+
+	return sw.active.src
+}
+
+// failover picks the next source among the flowing ones, primaries first,
+// it waits for its keyframe. The lock must be held.
+func (sw *Switcher) failover(now time.Time, primaryOnly bool) {
+	var next *switchInput
+	for _, in := range sw.inputs {
+		if in == sw.active || in.stalled(now, sw.stallTimeout) || (primaryOnly && in.backup) {
+			continue
+		}
+
+		if next == nil || (next.backup && !in.backup) {
+			next = in
+		}
+	}
+
+	if next == nil || next == sw.pending {
+		return
+	}
+
+	sw.logger.WithField("backup", next.backup).Info("switching source")
+	sw.pending = next
+	sw.requestKeyFrame(now)
+}
+
+func (sw *Switcher) requestKeyFrame(now time.Time) {
+	sw.lastPLI = now
+	in := sw.pending
+	go in.DeliverFeedback(deliver.FeedbackMsg{
+		Type: deliver.FeedbackTypeVideo,
+		Cmd:  deliver.FeedbackCmdPLI,
+	})
+}
+
+// Failover switches away from src if it is delivered and another source
+// flows, on the keyframe of the new source.
+func (sw *Switcher) Failover(src deliver.FrameSource) {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+
+	if sw.active == nil || sw.active.src != src || sw.pending != nil {
+		return
+	}
+
+	sw.failover(time.Now(), false)
+}
+
+// watch retries the keyframe requests of the pending source and switches
+// back to the primary once it flows again, the switch away from a stalled
+// source is up to Failover.
+func (sw *Switcher) watch() {
+	ticker := time.NewTicker(switchCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sw.ctx.Done():
+			return
+		case now := <-ticker.C:
+			sw.lock.Lock()
+			if sw.pending != nil {
+				if sw.pending.stalled(now, sw.stallTimeout) {
+					sw.pending = nil
+				} else if now.Sub(sw.lastPLI) > keyFrameRetry {
+					sw.requestKeyFrame(now)
+				}
+			}
+
+			if sw.pending == nil {
+				if sw.active == nil {
+					sw.failover(now, false)
+				} else if sw.active.backup {
+					sw.failover(now, true)
+				}
+			}
+			sw.lock.Unlock()
+		}
+	}
+}
+
+func (sw *Switcher) onMetaData(in *switchInput, metadata *deliver.Metadata) {
+	sw.deliverMetaData(in, metadata, false)
+}
+
+// deliverMetaData forwards the metadata of the active source, on a switch
+// it is kept from the destinations if the codecs do not change.
+func (sw *Switcher) deliverMetaData(in *switchInput, metadata *deliver.Metadata, switching bool) {
+	sw.lock.Lock()
+	if in != sw.active {
+		sw.lock.Unlock()
+		return
+	}
+
+	if sw.hasMetadata {
+		if switching && sameCodecs(&sw.metadata, metadata) {
+			sw.lock.Unlock()
+			return
+		}
+
+		if sw.metadata.String() == metadata.String() {
+			sw.lock.Unlock()
+			return
+		}
+	}
+
+	sw.metadata = *metadata
+	sw.hasMetadata = true
+	sw.lock.Unlock()
+
+	sw.FrameSource.DeliverMetaData(*metadata)
+}
+
+func sameCodecs(md1, md2 *deliver.Metadata) bool {
+	if md1.HasAudio() != md2.HasAudio() || md1.HasVideo() != md2.HasVideo() {
+		return false
+	}
+
+	if md1.HasAudio() && md1.Audio.CodecType != md2.Audio.CodecType {
+		return false
+	}
+
+	if md1.HasVideo() && md1.Video.CodecType != md2.Video.CodecType {
+		return false
+	}
+
+	return true
+}
+
+func (sw *Switcher) onFrame(in *switchInput, frame deliver.Frame, attr deliver.Attributes) {
+	sw.lock.Lock()
+	if in == sw.pending && (!in.src.Metadata().HasVideo() || (frame.Codec.IsVideo() && deliver.IsKeyFrame(frame))) {
+		sw.logger.WithField("backup", in.backup).Info("source switched")
+		sw.active = in
+		sw.pending = nil
+		sw.audio.rebase()
+		sw.video.rebase()
+		metadata := in.src.Metadata()
+		sw.lock.Unlock()
+		sw.deliverMetaData(in, metadata, true)
+		sw.lock.Lock()
+	}
+
+	if in != sw.active {
+		sw.lock.Unlock()
+		return
+	}
+
+	if pkt, ok := frame.RawPacket.(*rtp.Packet); ok && frame.PacketType == deliver.PacketTypeRtp {
+		if frame.Codec.IsAudio() {
+			var clockRate uint32 = 48000
+			var payloadType int = -1
+			if sw.metadata.HasAudio() {
+				clockRate, payloadType = sw.metadata.Audio.SampleRate, int(sw.metadata.Audio.RtpPayloadType)
+			}
+			frame.RawPacket = sw.audio.rewrite(pkt, clockRate, payloadType)
+		} else if frame.Codec.IsVideo() {
+			var clockRate uint32 = 90000
+			var payloadType int = -1
+			if sw.metadata.HasVideo() {
+				payloadType = int(sw.metadata.Video.RtpPayloadType)
+				if sw.metadata.Video.ClockRate > 0 {
+					clockRate = sw.metadata.Video.ClockRate
+				}
+			}
+			frame.RawPacket = sw.video.rewrite(pkt, clockRate, payloadType)
+		}
+		frame.TimeStamp = frame.RawPacket.(*rtp.Packet).Timestamp
+	}
+	sw.lock.Unlock()
+
+	if sw.stats == nil {
+		sw.FrameSource.DeliverFrame(frame, attr)
+		return
+	}
+
+	if err := sw.FrameSource.DeliverFrame(frame, attr); err != nil {
+		sw.stats.OnDrop(frame)
+	} else {
+		sw.stats.OnFrame(frame)
+	}
+}
+
+// OnFeedback goes to the delivered source.
+func (sw *Switcher) OnFeedback(fb deliver.FeedbackMsg) {
+	sw.lock.Lock()
+	active := sw.active
+	sw.lock.Unlock()
+
+	if active != nil {
+		active.DeliverFeedback(fb)
+	}
+}
+
+func (sw *Switcher) Metadata() *deliver.Metadata {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+
+	md := sw.metadata
+	return &md
+}
+
+func (sw *Switcher) Close() {
+	sw.cancel()
+	sw.FrameSource.Close()
+}
+
+// rtpRewriter keeps the SSRC, sequence numbers and timestamps of a media
+// continuous across source switches.
+type rtpRewriter struct {
+	started   bool
+	rebasing  bool
+	ssrc      uint32
+	seqOffset uint16
+	tsOffset  uint32
+	lastSeq   uint16
+	lastTs    uint32
+	lastTime  time.Time
+}
+
+func (r *rtpRewriter) rebase() {
+	if r.started {
+		r.rebasing = true
+	}
+}
+
+func (r *rtpRewriter) rewrite(pkt *rtp.Packet, clockRate uint32, payloadType int) *rtp.Packet {
+	now := time.Now()
+	if !r.started {
+		r.started = true
+		r.ssrc = pkt.SSRC
+	} else if r.rebasing {
+		r.rebasing = false
+		// continue after the last packet, as far in time as it was sent
+		elapsed := uint32(now.Sub(r.lastTime).Seconds() * float64(clockRate))
+		if elapsed == 0 {
+			elapsed = 1
+		}
+		r.seqOffset = r.lastSeq + 1 - pkt.SequenceNumber
+		r.tsOffset = r.lastTs + elapsed - pkt.Timestamp
+	}
+
+	out := &rtp.Packet{
+		Header:  pkt.Header,
+		Payload: pkt.Payload,
+	}
+	out.SSRC = r.ssrc
+	out.SequenceNumber = pkt.SequenceNumber + r.seqOffset
+	out.Timestamp = pkt.Timestamp + r.tsOffset
+	if payloadType >= 0 {
+		out.PayloadType = uint8(payloadType)
+	}
+
+	r.lastSeq = out.SequenceNumber
+	r.lastTs = out.Timestamp
+	r.lastTime = now
+
+	return out
+}
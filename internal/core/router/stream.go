@@ -3,9 +3,12 @@ package router
 import (
 	"context"
 	"sync"
+	"time"
 
 	sourcemanager "github.com/pingostack/neon/internal/core/router/source_manager"
 	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/transcoder"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -13,6 +16,11 @@ import (
 type Stream interface {
 	GetFormat(fmtName string) (StreamFormat, error)
 	AddFrameSource(source deliver.FrameSource) error
+	AddBackupFrameSource(source deliver.FrameSource) error
+	RemoveFrameSource(source deliver.FrameSource)
+	FailoverFrameSource(source deliver.FrameSource)
+	PromoteBackupFrameSource() deliver.FrameSource
+	DemoteFrameSource(source deliver.FrameSource)
 	AddFrameDestination(dest deliver.FrameDestination) (err error)
 	Close()
 }
@@ -26,17 +34,46 @@ type StreamImpl struct {
 	//pendingDests []deliver.FrameDestination
 	logger       *logrus.Entry
 	sm           *sourcemanager.Instance
+	sw           *sourcemanager.Switcher
 	paddingDests []deliver.FrameDestination
+	stallTimeout time.Duration
+	stats        *metrics.Stream
 }
 
-func NewStreamImpl(ctx context.Context, id string) Stream {
+type StreamOption func(*StreamImpl)
+
+// WithStats counts the frames delivered by the stream.
+func WithStats(stats *metrics.Stream) StreamOption {
+	return func(s *StreamImpl) {
+		s.stats = stats
+	}
+}
+
+// WithStallTimeout sets how long a source may stay silent before the
+// stream switches to another one.
+func WithStallTimeout(timeout time.Duration) StreamOption {
+	return func(s *StreamImpl) {
+		s.stallTimeout = timeout
+	}
+}
+
+func NewStreamImpl(ctx context.Context, id string, opts ...StreamOption) Stream {
 	s := &StreamImpl{
 		formats: make(map[string]StreamFormat),
 		logger:  logrus.WithField("stream", id),
 		sm:      sourcemanager.NewInstance(),
 	}
 
+	for _, opt := range opts {
+		opt(s)
+	}
+
 	s.ctx, s.cancel = context.WithCancel(ctx)
+	var swOpts []sourcemanager.SwitcherOption
+	if s.stats != nil {
+		swOpts = append(swOpts, sourcemanager.WithStats(s.stats))
+	}
+	s.sw = sourcemanager.NewSwitcher(s.ctx, s.stallTimeout, s.logger, swOpts...)
 
 	go func() {
 		<-ctx.Done()
@@ -54,6 +91,8 @@ func NewStreamImpl(ctx context.Context, id string) Stream {
 		for _, f := range s.formats {
 			f.Close()
 		}
+
+		s.sw.Close()
 	}()
 
 	return s
@@ -76,6 +115,16 @@ func (s *StreamImpl) GetFormat(fmtName string) (StreamFormat, error) {
 }
 
 func (s *StreamImpl) AddFrameSource(source deliver.FrameSource) error {
+	return s.addFrameSource(source, false)
+}
+
+// AddBackupFrameSource adds a source delivered only while the primary
+// one stalls or is gone.
+func (s *StreamImpl) AddBackupFrameSource(source deliver.FrameSource) error {
+	return s.addFrameSource(source, true)
+}
+
+func (s *StreamImpl) addFrameSource(source deliver.FrameSource, backup bool) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
@@ -87,19 +136,156 @@ func (s *StreamImpl) AddFrameSource(source deliver.FrameSource) error {
 		return ErrFrameSourceExists
 	}
 
+	if err := s.sw.AddSource(source, backup); err != nil {
+		s.sm.RemoveSource(source.ID())
+		return errors.Wrap(err, "failed to add source to switcher")
+	}
+
 	for _, dest := range s.paddingDests {
 		s.addFrameDestination(dest)
 	}
+	s.paddingDests = nil
 
 	return nil
 }
 
+// RemoveFrameSource drops a source, the destinations stay and get the
+// frames of the next flowing source.
+func (s *StreamImpl) RemoveFrameSource(source deliver.FrameSource) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.sm.RemoveSource(source.ID())
+	s.sw.RemoveSource(source)
+}
+
+// FailoverFrameSource switches away from a stalled source if another one
+// flows.
+func (s *StreamImpl) FailoverFrameSource(source deliver.FrameSource) {
+	s.sw.Failover(source)
+}
+
+// PromoteBackupFrameSource makes the backup source delivered, or about to
+// be, a primary one and returns it, nil if there is no backup.
+func (s *StreamImpl) PromoteBackupFrameSource() deliver.FrameSource {
+	return s.sw.Promote()
+}
+
+// DemoteFrameSource makes a source a backup one again.
+func (s *StreamImpl) DemoteFrameSource(source deliver.FrameSource) {
+	s.sw.Demote(source)
+}
+
+// transcodeTarget picks the codec to deliver to a destination, the
+// source codec if the destination accepts it, otherwise the candidate
+// reachable at the lowest transcoding cost. It returns CodecTypeNone when
+// no transcoding is needed or possible.
+func transcodeTarget(in deliver.CodecType, candidates []deliver.CodecType) deliver.CodecType {
+	if len(candidates) == 0 {
+		return deliver.CodecTypeNone
+	}
+
+	for _, c := range candidates {
+		if c == in {
+			return deliver.CodecTypeNone
+		}
+	}
+
+	out, err := transcoder.DefaultRegistry.Cheapest(in, candidates)
+	if err != nil || out == in {
+		return deliver.CodecTypeNone
+	}
+
+	return out
+}
+
+type transcodePair struct {
+	in  deliver.CodecType
+	out deliver.CodecType
+}
+
+// transcodePairs returns the conversions a destination needs to receive
+// the source, none if it accepts the source as is.
+func (s *StreamImpl) transcodePairs(settings deliver.FormatSettings) []transcodePair {
+	src := s.sw.Metadata()
+
+	var pairs []transcodePair
+	if src.HasAudio() {
+		candidates := make([]deliver.CodecType, 0, len(settings.AudioCandidates))
+		for _, a := range settings.AudioCandidates {
+			candidates = append(candidates, a.CodecType)
+		}
+
+		if out := transcodeTarget(src.Audio.CodecType, candidates); out != deliver.CodecTypeNone {
+			pairs = append(pairs, transcodePair{src.Audio.CodecType, out})
+		}
+	}
+
+	if src.HasVideo() {
+		candidates := make([]deliver.CodecType, 0, len(settings.VideoCandidates))
+		for _, v := range settings.VideoCandidates {
+			candidates = append(candidates, v.CodecType)
+		}
+
+		if out := transcodeTarget(src.Video.CodecType, candidates); out != deliver.CodecTypeNone {
+			pairs = append(pairs, transcodePair{src.Video.CodecType, out})
+		}
+	}
+
+	return pairs
+}
+
+func (s *StreamImpl) newTranscoder(pairs []transcodePair) (transcoder.Transcoder, error) {
+	stages := make([]transcoder.Transcoder, 0, len(pairs))
+	for _, p := range pairs {
+		tc, err := transcoder.DefaultRegistry.NewTranscoder(s.ctx, p.in, p.out)
+		if err != nil {
+			for _, stage := range stages {
+				stage.Close()
+			}
+			return nil, err
+		}
+
+		stages = append(stages, tc)
+	}
+
+	if len(stages) == 1 {
+		return stages[0], nil
+	}
+
+	return transcoder.NewChain(s.ctx, stages...)
+}
+
 func (s *StreamImpl) addFrameDestination(dest deliver.FrameDestination) (err error) {
+	settings := dest.FormatSettings()
+	pairs := s.transcodePairs(settings)
+
+	// the destinations sharing a packet type and conversions share a
+	// format
 	fmtName := dest.Metadata().FormatName()
+	for _, p := range pairs {
+		fmtName += "/" + p.in.String() + "->" + p.out.String()
+	}
+
 	format, ok := s.formats[fmtName]
 	if !ok {
-		format, err = NewStreamFormat(s.ctx, dest.FormatSettings(), WithFrameSourceManager(s.sm))
+		var tc transcoder.Transcoder
+		opts := []StreamFormatOption{WithFrameSourceManager(s.sm), WithFrameSource(s.sw)}
+		if len(pairs) > 0 {
+			tc, err = s.newTranscoder(pairs)
+			if err != nil {
+				return errors.Wrap(err, "failed to create transcoder")
+			}
+
+			s.logger.WithField("transcoder", tc.Label()).Info("transcoding for destination")
+			opts = append(opts, WithTranscoder(tc))
+		}
+
+		format, err = NewStreamFormat(s.ctx, settings, opts...)
 		if err != nil {
+			if tc != nil {
+				tc.Close()
+			}
 			return errors.Wrap(err, "failed to create stream format")
 		}
 
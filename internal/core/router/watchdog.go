@@ -0,0 +1,339 @@
+package router
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	sourcemanager "github.com/pingostack/neon/internal/core/router/source_manager"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/atomic"
+)
+
+// WatchdogAction is what a router does when a producer stops sending a
+// media for longer than a threshold.
+type WatchdogAction string
+
+const (
+	// WatchdogActionEvent only emits ProducerStalled, as every action does.
+	WatchdogActionEvent WatchdogAction = "event"
+	// WatchdogActionKeyFrame asks the producer for a keyframe.
+	WatchdogActionKeyFrame WatchdogAction = "keyframe"
+	// WatchdogActionFailover switches the stream to a flowing backup.
+	WatchdogActionFailover WatchdogAction = "failover"
+	// WatchdogActionClose closes the router with ErrProducerStalled.
+	WatchdogActionClose WatchdogAction = "close"
+)
+
+// WatchdogThreshold runs Action once a media of a producer has been
+// missing for TimeoutMs, once per stall.
+type WatchdogThreshold struct {
+	TimeoutMs int            `yaml:"timeout_ms" json:"timeout_ms" mapstructure:"timeout_ms"`
+	Action    WatchdogAction `yaml:"action" json:"action" mapstructure:"action"`
+}
+
+const (
+	watchdogCheckInterval = 250 * time.Millisecond
+	// bitrateWindow is the period the bitrate of a producer is measured on
+	bitrateWindow = time.Second
+	// bitrateGraceWindows is the number of windows in a row a producer may
+	// exceed its bitrate cap before it is finalized
+	bitrateGraceWindows = 3
+)
+
+// stallThresholds returns the configured thresholds by timeout, a stall
+// fails over after the backup stall timeout unless a threshold fails over.
+func (r *RouterImpl) stallThresholds() []WatchdogThreshold {
+	thresholds := make([]WatchdogThreshold, 0, len(r.params.StallThresholds)+1)
+	failover := false
+	for _, t := range r.params.StallThresholds {
+		if t.TimeoutMs > 0 {
+			thresholds = append(thresholds, t)
+			failover = failover || t.Action == WatchdogActionFailover
+		}
+	}
+
+	if !failover {
+		timeout := r.params.BackupStallTimeoutMs
+		if timeout <= 0 {
+			timeout = int(sourcemanager.DefaultStallTimeout / time.Millisecond)
+		}
+
+		thresholds = append(thresholds, WatchdogThreshold{
+			TimeoutMs: timeout,
+			Action:    WatchdogActionFailover,
+		})
+	}
+
+	sort.SliceStable(thresholds, func(i, j int) bool {
+		return thresholds[i].TimeoutMs < thresholds[j].TimeoutMs
+	})
+
+	return thresholds
+}
+
+// mediaWatch is the stall state of one media of a producer.
+type mediaWatch struct {
+	media     string
+	lastFrame atomic.Int64
+	// fired is the number of thresholds run during the current stall
+	fired int
+	// since is the time of the last frame before the current stall
+	since int64
+}
+
+// watchdog follows the frames of a producer and runs the actions of the
+// thresholds its media cross while missing.
+type watchdog struct {
+	deliver.FrameDestination
+	ctx        context.Context
+	cancel     context.CancelFunc
+	r          *RouterImpl
+	session    Session
+	src        deliver.FrameSource
+	thresholds []WatchdogThreshold
+	audio      mediaWatch
+	video      mediaWatch
+	once       sync.Once
+	// maxBitrate is the cap of the producer in kbps, zero for none
+	maxBitrate  int
+	bytes       atomic.Int64
+	windowStart time.Time
+	exceeded    int
+	// metadata is the last metadata of the producer, as json
+	metadata atomic.String
+}
+
+func newWatchdog(r *RouterImpl, s Session) *watchdog {
+	src := s.FrameSource()
+	w := &watchdog{
+		r:           r,
+		session:     s,
+		src:         src,
+		thresholds:  r.stallThresholds(),
+		audio:       mediaWatch{media: "audio"},
+		video:       mediaWatch{media: "video"},
+		maxBitrate:  GetSessionLimits(s).MaxBitrate,
+		windowStart: time.Now(),
+	}
+
+	w.ctx, w.cancel = context.WithCancel(r.ctx)
+	w.FrameDestination = deliver.NewFrameDestinationImpl(w.ctx, src.FormatSettings())
+
+	now := time.Now().UnixNano()
+	w.audio.lastFrame.Store(now)
+	w.video.lastFrame.Store(now)
+
+	return w
+}
+
+func (w *watchdog) start() error {
+	if err := deliver.AddDestination(w.src, w); err != nil {
+		w.cancel()
+		return err
+	}
+
+	go w.run()
+
+	return nil
+}
+
+func (w *watchdog) stop() {
+	w.once.Do(func() {
+		w.cancel()
+		w.FrameDestination.Close()
+	})
+}
+
+func (w *watchdog) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	now := time.Now().UnixNano()
+	if frame.Codec.IsAudio() {
+		w.audio.lastFrame.Store(now)
+	} else if frame.Codec.IsVideo() {
+		w.video.lastFrame.Store(now)
+	}
+
+	if w.maxBitrate > 0 {
+		w.bytes.Add(int64(metrics.FrameSize(frame)))
+	}
+}
+
+// OnMetaData reports the changes of the media of the producer, the first
+// metadata is the one it joined with.
+func (w *watchdog) OnMetaData(metadata *deliver.Metadata) {
+	w.FrameDestination.OnMetaData(metadata)
+
+	md := metadata.String()
+	previous := w.metadata.Load()
+	w.metadata.Store(md)
+
+	if previous != "" && previous != md {
+		w.r.ns.emit(MetadataChanged{
+			Namespace: w.r.ns.Name(),
+			RouterID:  w.r.id,
+			SessionID: w.session.ID(),
+			Metadata:  *metadata,
+		})
+	}
+}
+
+func (w *watchdog) run() {
+	ticker := time.NewTicker(watchdogCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case now := <-ticker.C:
+			var audioMuted, videoMuted bool
+			if m, ok := w.src.(deliver.EnableMute); ok {
+				audioMuted, videoMuted = m.Muted()
+			}
+
+			md := w.src.Metadata()
+			if md.HasAudio() {
+				w.check(&w.audio, now, audioMuted)
+			}
+
+			if md.HasVideo() {
+				w.check(&w.video, now, videoMuted)
+			}
+
+			if w.maxBitrate > 0 {
+				w.checkBitrate(now)
+			}
+		}
+	}
+}
+
+// check runs the thresholds a media crossed. A muted media is not
+// watched, its stall starts over once unmuted.
+func (w *watchdog) check(m *mediaWatch, now time.Time, muted bool) {
+	if muted {
+		if m.fired == 0 {
+			m.lastFrame.Store(now.UnixNano())
+		}
+		return
+	}
+
+	last := m.lastFrame.Load()
+	if m.fired > 0 && last != m.since {
+		// frames again, the stall ended with the first of them
+		m.fired = 0
+		w.r.onProducerRecovered(w, m.media, time.Duration(last-m.since))
+		return
+	}
+
+	stalled := now.Sub(time.Unix(0, last))
+	for m.fired < len(w.thresholds) && stalled >= time.Duration(w.thresholds[m.fired].TimeoutMs)*time.Millisecond {
+		t := w.thresholds[m.fired]
+		if m.fired == 0 {
+			m.since = last
+		}
+		m.fired++
+		w.r.onProducerStalled(w, m.media, stalled, t.Action)
+	}
+}
+
+// checkBitrate measures the bitrate of the producer once a window has
+// passed and finalizes it once it exceeded its cap for the grace windows.
+func (w *watchdog) checkBitrate(now time.Time) {
+	elapsed := now.Sub(w.windowStart)
+	if elapsed < bitrateWindow {
+		return
+	}
+
+	kbps := int(float64(w.bytes.Swap(0)*8) / elapsed.Seconds() / 1000)
+	w.windowStart = now
+
+	if kbps <= w.maxBitrate {
+		w.exceeded = 0
+		return
+	}
+
+	w.exceeded++
+	w.r.logger.WithFields(logrus.Fields{
+		"session":    w.session.ID(),
+		"bitrate":    kbps,
+		"maxBitrate": w.maxBitrate,
+	}).Warn("producer exceeds its bitrate")
+
+	if w.exceeded >= bitrateGraceWindows {
+		w.session.Finalize(ErrBitrateExceeded)
+		w.stop()
+	}
+}
+
+// startWatchdog follows the frames of a producer. The lock must be held.
+func (r *RouterImpl) startWatchdog(s Session) {
+	w := newWatchdog(r, s)
+	if err := w.start(); err != nil {
+		r.logger.WithError(err).Warnf("failed to watch producer %s", s.ID())
+		return
+	}
+
+	r.watchdogs[s.ID()] = w
+}
+
+func (r *RouterImpl) stopWatchdog(s Session) {
+	if w, ok := r.watchdogs[s.ID()]; ok {
+		w.stop()
+		delete(r.watchdogs, s.ID())
+	}
+}
+
+func (r *RouterImpl) onProducerStalled(w *watchdog, media string, stalled time.Duration, action WatchdogAction) {
+	r.logger.WithFields(logrus.Fields{
+		"session": w.session.ID(),
+		"media":   media,
+		"stalled": stalled.Round(time.Millisecond),
+		"action":  action,
+	}).Warn("producer stalled")
+
+	// every stall is reported, the event action does nothing more
+	r.ns.emit(ProducerStalled{
+		Namespace: r.ns.Name(),
+		RouterID:  r.id,
+		SessionID: w.session.ID(),
+		Media:     media,
+		Duration:  stalled,
+		Action:    action,
+	})
+
+	switch action {
+	case WatchdogActionEvent:
+	case WatchdogActionKeyFrame:
+		w.DeliverFeedback(deliver.FeedbackMsg{
+			Type: deliver.FeedbackTypeVideo,
+			Cmd:  deliver.FeedbackCmdPLI,
+		})
+	case WatchdogActionFailover:
+		r.stream.FailoverFrameSource(w.src)
+	case WatchdogActionClose:
+		r.lock.Lock()
+		r.closeLocked(ErrProducerStalled)
+		r.lock.Unlock()
+	default:
+		r.logger.Warnf("unknown watchdog action %s", action)
+	}
+}
+
+func (r *RouterImpl) onProducerRecovered(w *watchdog, media string, duration time.Duration) {
+	r.logger.WithFields(logrus.Fields{
+		"session":  w.session.ID(),
+		"media":    media,
+		"duration": duration.Round(time.Millisecond),
+	}).Info("producer recovered")
+
+	r.ns.emit(ProducerRecovered{
+		Namespace: r.ns.Name(),
+		RouterID:  r.id,
+		SessionID: w.session.ID(),
+		Media:     media,
+		Duration:  duration,
+	})
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"errors"
 
 	"github.com/pingostack/neon/internal/core/middleware"
 	"github.com/pingostack/neon/internal/core/router"
@@ -10,6 +11,8 @@ import (
 
 type serv struct {
 	*router.NSManager
+	// builtins run before the middlewares of the apps
+	builtins   middleware.Matcher
 	middleware middleware.Matcher
 	ee         eventemitter.EventEmitter
 	ctx        context.Context
@@ -19,83 +22,134 @@ type ServerOption func(*serv)
 
 var (
 	defaultServ *serv
+	// middlewares are the middlewares added by the apps
+	middlewares = middleware.New()
 )
 
 const (
 	defaultEventEmitterSize = 100
 )
 
-func NewServ(ctx context.Context, params router.NSManagerParams) *serv {
+// WithBuiltins sets the middlewares run before the ones of the apps.
+func WithBuiltins(m middleware.Matcher) ServerOption {
+	return func(s *serv) {
+		s.builtins = m
+	}
+}
+
+func NewServ(ctx context.Context, params router.NSManagerParams, opts ...ServerOption) *serv {
 	s := &serv{
 		ctx:        ctx,
-		middleware: middleware.New(),
+		builtins:   middleware.New(),
+		middleware: middlewares,
 		ee:         eventemitter.NewEventEmitter(ctx, defaultEventEmitterSize, DefaultLogger()),
-		NSManager:  router.NewNSManager(params),
 	}
 
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	listeners.attach(s.ee)
+	s.NSManager = router.NewNSManager(params, router.WithEventEmitter(s.ee))
+
 	return s
 }
 
-func (s *serv) join(session router.Session) error {
-	ns, _ := s.NSManager.GetOrNewNamespaceByDomain(s.ctx, session.PeerParams().Domain)
-	// if ns == nil {
-	// 	return router.ErrNamespaceNotFound
-	// }
+// Use adds middlewares run for every operation.
+func Use(ms ...middleware.Middleware) {
+	middlewares.Use(ms...)
+}
+
+// Add adds middlewares run for the operations of a selector, such as
+// "publish" or "*".
+func Add(selector string, ms ...middleware.Middleware) {
+	middlewares.Add(selector, ms...)
+}
 
+// NSManager returns the namespaces of the running server, nil before the
+// core module runs.
+func NSManager() *router.NSManager {
+	if defaultServ == nil {
+		return nil
+	}
+
+	return defaultServ.NSManager
+}
+
+func (s *serv) match(operation string) []middleware.Middleware {
+	return append(s.builtins.Match(operation), s.middleware.Match(operation)...)
+}
+
+// selected returns the middlewares of an operation run inside the join
+// chain, without those the join chain ran already.
+func (s *serv) selected(operation string) []middleware.Middleware {
+	return append(s.builtins.SelectAfter(operation, middleware.OperationJoin),
+		s.middleware.SelectAfter(operation, middleware.OperationJoin)...)
+}
+
+func (s *serv) join(ns *router.Namespace, session router.Session) error {
 	r, _ := ns.GetOrNewRouter(session.PeerParams().RouterID)
 	err := r.AddSession(session)
 	if err == router.ErrRouterClosed {
 		ns.RemoveRouter(r)
 		r, _ = ns.GetOrNewRouter(session.PeerParams().RouterID)
 		err = r.AddSession(session)
-		if err != nil {
-			return err
-		}
-	} else if err != nil {
+	}
+
+	// a subscriber waiting for its producer has joined too
+	if err != nil && !errors.Is(err, router.ErrPaddingDestination) {
 		return err
 	}
 
 	session.SetRouter(r)
 	session.SetNamespace(ns)
 
-	return nil
+	return err
 }
 
+// Join runs the join middlewares then the publish or play ones around
+// the join of the session to its router.
 func (s *serv) Join(ctx context.Context, session router.Session) error {
-	//	h := func(ctx context.Context, req middleware.Request) (interface{}, error) {
-	err := s.join(session)
-	if err != nil {
-		return err
+	ns, _ := s.NSManager.GetOrNewNamespaceByDomain(s.ctx, session.PeerParams().Domain)
+	if ns == nil {
+		return router.ErrNSNotFound
 	}
 
-	// 	return nil, nil
-	// }
+	operation := middleware.OperationPlay
+	if session.PeerParams().Producer {
+		operation = middleware.OperationPublish
+	}
 
-	// if next := s.middleware.Match("join"); len(next) > 0 {
-	// 	_, err := middleware.Chain(next...)(h)(ctx, middleware.Request{
-	// 		Operation: middleware.OperationJoin,
-	// 		Params:    session,
-	// 	})
-	// 	if err != nil {
-	// 		return err
-	// 	}
-	// }
+	h := middleware.Chain(s.selected(operation)...)(func(ctx context.Context, req middleware.Request) (interface{}, error) {
+		return nil, s.join(ns, session)
+	})
+
+	_, err := middleware.Chain(s.match(middleware.OperationJoin)...)(func(ctx context.Context, req middleware.Request) (interface{}, error) {
+		req.Operation = operation
+		return h(ctx, req)
+	})(ctx, middleware.Request{
+		Operation: middleware.OperationJoin,
+		Namespace: ns.Name(),
+		Params:    session,
+	})
+
+	if err == nil || errors.Is(err, router.ErrPaddingDestination) {
+		go s.waitLeave(ns, session)
+	}
 
-	return nil
+	return err
 }
 
-// func (s *serv) Middleware(m ...middleware.Middleware) ServerOption {
-// 	return func(s *serv) {
-// 		for _, middleware := range m {
-// 			s.middleware.Use(middleware)
-// 		}
-// 	}
-// }
-
-// func (s *serv) Use(selector string, m ...middleware.Middleware) ServerOption {
-// 	return func(s *serv) {
-// 		for _, middleware := range m {
-// 			s.middleware.Add(selector, middleware)
-// 		}
-// 	}
-// }
+// waitLeave runs the leave middlewares once the session ended, the router
+// has already dropped it.
+func (s *serv) waitLeave(ns *router.Namespace, session router.Session) {
+	<-session.Context().Done()
+
+	middleware.Chain(s.match(middleware.OperationLeave)...)(func(ctx context.Context, req middleware.Request) (interface{}, error) {
+		return nil, nil
+	})(s.ctx, middleware.Request{
+		Operation: middleware.OperationLeave,
+		Namespace: ns.Name(),
+		Params:    session,
+	})
+}
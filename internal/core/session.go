@@ -4,9 +4,11 @@ import (
 	"context"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/gogf/gf/util/guid"
+	"github.com/pingostack/neon/internal/core/event"
 	"github.com/pingostack/neon/internal/core/router"
 	"github.com/pingostack/neon/pkg/deliver"
 	"github.com/sirupsen/logrus"
@@ -24,13 +26,16 @@ type SessionImpl struct {
 	frameSource      deliver.FrameSource
 	frameDestination deliver.FrameDestination
 	onceClose        sync.Once
+	createdAt        time.Time
+	err              error
 }
 
 func NewSession(ctx context.Context, params router.PeerParams, logger *logrus.Entry) router.Session {
 	session := &SessionImpl{
-		id:     guid.S(),
-		kv:     &sync.Map{},
-		params: params,
+		id:        guid.S(),
+		kv:        &sync.Map{},
+		params:    params,
+		createdAt: time.Now(),
 	}
 
 	session.logger = logger.WithFields(logrus.Fields{
@@ -46,17 +51,52 @@ func (session *SessionImpl) ID() string {
 	return session.id
 }
 
+func (session *SessionImpl) CreatedAt() time.Time {
+	return session.createdAt
+}
+
 func (session *SessionImpl) RouterID() string {
 	return session.params.RouterID
 }
 
+func (session *SessionImpl) SetRouterID(id string) {
+	session.params.RouterID = id
+}
+
 func (session *SessionImpl) close(e error) {
 	session.onceClose.Do(func() {
+		session.err = e
 		session.cancel()
 		session.logger.WithError(e).Infof("session closed")
+		session.emitClosed(e)
 	})
 }
 
+// emitClosed sends SessionClosed once a session of a namespace is closed.
+func (session *SessionImpl) emitClosed(e error) {
+	ns := session.GetNamespace()
+	if ns == nil || defaultServ == nil {
+		return
+	}
+
+	ev := router.SessionClosed{
+		Namespace: ns.Name(),
+		RouterID:  session.params.RouterID,
+		SessionID: session.id,
+		Err:       e,
+	}
+
+	if err := event.Emit(defaultServ.ee, ev); err != nil {
+		session.logger.WithError(err).Warn("failed to emit session closed")
+	}
+}
+
+// Err is the error the session was finalized with, it is set once its
+// context is done.
+func (session *SessionImpl) Err() error {
+	return session.err
+}
+
 func (session *SessionImpl) Finalize(e error) {
 	session.close(e)
 	session.logger.WithError(e).Infof("session finalized")
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/transcoder"
+	"github.com/sirupsen/logrus"
+)
+
+// TranscoderSettings runs an external command for a codec pair, it reads
+// the frames of InCodec on its stdin and writes the ones of OutCodec on
+// its stdout.
+type TranscoderSettings struct {
+	Name     string   `json:"name" mapstructure:"name"`
+	InCodec  string   `json:"inCodec" mapstructure:"inCodec"`
+	OutCodec string   `json:"outCodec" mapstructure:"outCodec"`
+	Cost     int      `json:"cost" mapstructure:"cost"`
+	Command  string   `json:"command" mapstructure:"command"`
+	Args     []string `json:"args" mapstructure:"args"`
+	Env      []string `json:"env" mapstructure:"env"`
+	// Framing is raw, the default, or lengthPrefixed
+	Framing   string `json:"framing" mapstructure:"framing"`
+	FrameSize int    `json:"frameSize" mapstructure:"frameSize"`
+	// Codec, ClockRate, Channels and PayloadType describe the output,
+	// Codec defaults to OutCodec
+	Codec             string `json:"codec" mapstructure:"codec"`
+	ClockRate         uint32 `json:"clockRate" mapstructure:"clockRate"`
+	Channels          uint8  `json:"channels" mapstructure:"channels"`
+	PayloadType       uint8  `json:"payloadType" mapstructure:"payloadType"`
+	SamplesPerFrame   uint32 `json:"samplesPerFrame" mapstructure:"samplesPerFrame"`
+	QueueSize         int    `json:"queueSize" mapstructure:"queueSize"`
+	RestartDelayMs    int    `json:"restartDelayMs" mapstructure:"restartDelayMs"`
+	MaxRestartDelayMs int    `json:"maxRestartDelayMs" mapstructure:"maxRestartDelayMs"`
+	MaxRestarts       int    `json:"maxRestarts" mapstructure:"maxRestarts"`
+}
+
+// defaultTranscoderCost is the cost of a command without one, above the
+// builtin transcoders.
+const defaultTranscoderCost = 10
+
+// registerTranscoders adds the configured commands to the default
+// registry, an invalid entry is skipped.
+func registerTranscoders(settings []TranscoderSettings, logger *logrus.Entry) {
+	for _, ts := range settings {
+		if err := registerTranscoder(ts, logger); err != nil {
+			logger.WithError(err).Errorf("transcoder %s not registered", ts.Name)
+			continue
+		}
+
+		logger.Infof("transcoder %s registered for %s->%s", ts.Name, ts.InCodec, ts.OutCodec)
+	}
+}
+
+func registerTranscoder(ts TranscoderSettings, logger *logrus.Entry) error {
+	in, out := deliver.ConvCodecType(ts.InCodec), deliver.ConvCodecType(ts.OutCodec)
+	if in == deliver.CodecTypeNone || out == deliver.CodecTypeNone {
+		return fmt.Errorf("unknown codec pair %s->%s", ts.InCodec, ts.OutCodec)
+	}
+
+	cfg := transcoder.ProcessConfig{
+		Name:            ts.Name,
+		Command:         ts.Command,
+		Args:            ts.Args,
+		Env:             ts.Env,
+		FrameSize:       ts.FrameSize,
+		Codec:           ts.Codec,
+		ClockRate:       ts.ClockRate,
+		Channels:        ts.Channels,
+		PayloadType:     ts.PayloadType,
+		SamplesPerFrame: ts.SamplesPerFrame,
+		QueueSize:       ts.QueueSize,
+		RestartDelay:    time.Duration(ts.RestartDelayMs) * time.Millisecond,
+		MaxRestartDelay: time.Duration(ts.MaxRestartDelayMs) * time.Millisecond,
+		MaxRestarts:     ts.MaxRestarts,
+		Logger:          logger,
+	}
+
+	switch strings.ToLower(ts.Framing) {
+	case "", "raw":
+		cfg.Framing = transcoder.FramingRaw
+	case "lengthprefixed":
+		cfg.Framing = transcoder.FramingLengthPrefixed
+	default:
+		return fmt.Errorf("unknown framing %s", ts.Framing)
+	}
+
+	if cfg.Codec == "" {
+		cfg.Codec = ts.OutCodec
+	}
+
+	cost := ts.Cost
+	if cost <= 0 {
+		cost = defaultTranscoderCost
+	}
+
+	return transcoder.RegisterProcess(transcoder.DefaultRegistry, in, out, cost, cfg)
+}
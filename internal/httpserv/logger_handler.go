@@ -1,18 +1,28 @@
 package httpserv
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 
 	"github.com/pingostack/neon/pkg/logger"
 )
 
+// BodyStreamer is implemented by the handlers of requests whose body is a
+// stream read for the life of the connection, e.g. a tunnel, the logger
+// does not read it.
+type BodyStreamer interface {
+	StreamsBody(r *http.Request) bool
+}
+
 type loggerWriter struct {
-	w      http.ResponseWriter
-	status int
-	buf    bytes.Buffer
+	w        http.ResponseWriter
+	status   int
+	buf      bytes.Buffer
+	hijacked bool
 }
 
 func (w *loggerWriter) Header() http.Header {
@@ -32,7 +42,35 @@ func (w *loggerWriter) WriteHeader(statusCode int) {
 	w.w.WriteHeader(statusCode)
 }
 
+// Flush and Hijack pass through, streaming and tunnelling handlers need
+// the underlying writer.
+func (w *loggerWriter) Flush() {
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *loggerWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer is not a hijacker")
+	}
+
+	w.hijacked = true
+
+	return hj.Hijack()
+}
+
+// Unwrap gives the underlying writer to http.ResponseController.
+func (w *loggerWriter) Unwrap() http.ResponseWriter {
+	return w.w
+}
+
 func (w *loggerWriter) dump() string {
+	if w.hijacked {
+		return "(connection hijacked)"
+	}
+
 	var buf bytes.Buffer
 	fmt.Fprintf(&buf, "HTTP/1.1 %d %s\n", w.status, http.StatusText(w.status))
 	w.Header().Write(&buf)
@@ -52,7 +90,7 @@ type loggerHandler struct {
 func (h *loggerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.logger.Debugf("[conn %v] %s %s", r.RemoteAddr, r.Method, r.URL)
 
-	bytes, _ := httputil.DumpRequest(r, true)
+	bytes, _ := httputil.DumpRequest(r, h.dumpsBody(r))
 	h.logger.Debugf("[conn %v] request: %s", r.RemoteAddr, string(bytes))
 
 	lw := &loggerWriter{
@@ -63,3 +101,17 @@ func (h *loggerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	h.logger.Debugf("[conn %v] response: %s", r.RemoteAddr, lw.dump())
 }
+
+// dumpsBody tells whether the body of r can be read before it is served,
+// a body of unknown length or streamed to the handler can not.
+func (h *loggerHandler) dumpsBody(r *http.Request) bool {
+	if r.ContentLength < 0 {
+		return false
+	}
+
+	if bs, ok := h.Handler.(BodyStreamer); ok && bs.StreamsBody(r) {
+		return false
+	}
+
+	return true
+}
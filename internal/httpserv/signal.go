@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -168,6 +169,26 @@ func (ss *SignalServer) AllowHeaders() []string {
 	return ss.params.AllowHeaders
 }
 
+// OriginAllowed tells whether a request from origin is allowed, a request
+// without one is not from a browser.
+func (ss *SignalServer) OriginAllowed(origin string) bool {
+	if origin == "" {
+		return true
+	}
+
+	if ss.params.AllowOriginHook != "" {
+		return ss.allowOriginHook(origin)
+	}
+
+	for _, allowed := range ss.params.AllowOrigin {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (ss *SignalServer) AllowOrigin() []string {
 	return ss.params.AllowOrigin
 }
@@ -10,6 +10,12 @@ type EnableMetaData interface {
 	Metadata() *Metadata
 }
 
+// EnableMute is implemented by the sources able to stop forwarding a
+// media, the frames of a muted media are expected to stop.
+type EnableMute interface {
+	Muted() (audio, video bool)
+}
+
 type FrameDestinationReceiver interface {
 	OnFrame(frame Frame, attr Attributes)
 	OnMetaData(metadata *Metadata)
@@ -0,0 +1,134 @@
+package deliver
+
+import "github.com/pion/rtp"
+
+// IsKeyFrame reports whether the video frame starts a keyframe, either as
+// told by the source or by looking at its RTP payload.
+func IsKeyFrame(frame Frame) bool {
+	if info, ok := frame.AdditionalInfo.(*VideoFrameSpecificInfo); ok && info != nil && info.IsKeyFrame {
+		return true
+	}
+
+	if frame.PacketType != PacketTypeRtp {
+		return false
+	}
+
+	pkt, ok := frame.RawPacket.(*rtp.Packet)
+	if !ok {
+		return false
+	}
+
+	return IsRtpKeyFrame(frame.Codec, pkt.Payload)
+}
+
+// IsRtpKeyFrame reports whether an RTP payload of codec carries the start
+// of a keyframe or the parameter sets preceding it.
+func IsRtpKeyFrame(codec CodecType, payload []byte) bool {
+	if len(payload) == 0 {
+		return false
+	}
+
+	switch codec {
+	case CodecTypeH264:
+		return isH264KeyFrame(payload)
+	case CodecTypeH265:
+		return isH265KeyFrame(payload)
+	case CodecTypeVP8:
+		return isVP8KeyFrame(payload)
+	case CodecTypeVP9:
+		// not inter-picture predicted and start of a frame
+		return payload[0]&0x40 == 0 && payload[0]&0x08 != 0
+	case CodecTypeAV1:
+		// N, first packet of a coded video sequence
+		return payload[0]&0x08 != 0
+	}
+
+	return false
+}
+
+func isH264KeyNal(nalType byte) bool {
+	return nalType == 5 || nalType == 7
+}
+
+func isH264KeyFrame(payload []byte) bool {
+	nalType := payload[0] & 0x1f
+	switch {
+	case nalType >= 1 && nalType <= 23:
+		return isH264KeyNal(nalType)
+	case nalType == 24: // STAP-A
+		for off := 1; off+2 < len(payload); {
+			size := int(payload[off])<<8 | int(payload[off+1])
+			if isH264KeyNal(payload[off+2] & 0x1f) {
+				return true
+			}
+			off += 2 + size
+		}
+	case nalType == 28: // FU-A
+		return len(payload) > 1 && payload[1]&0x80 != 0 && isH264KeyNal(payload[1]&0x1f)
+	}
+
+	return false
+}
+
+func isH265KeyNal(nalType byte) bool {
+	return (nalType >= 16 && nalType <= 21) || nalType == 32 || nalType == 33
+}
+
+func isH265KeyFrame(payload []byte) bool {
+	if len(payload) < 2 {
+		return false
+	}
+
+	nalType := (payload[0] >> 1) & 0x3f
+	switch {
+	case nalType == 48: // AP
+		for off := 2; off+2 < len(payload); {
+			size := int(payload[off])<<8 | int(payload[off+1])
+			if isH265KeyNal((payload[off+2] >> 1) & 0x3f) {
+				return true
+			}
+			off += 2 + size
+		}
+	case nalType == 49: // FU
+		return len(payload) > 2 && payload[2]&0x80 != 0 && isH265KeyNal(payload[2]&0x3f)
+	default:
+		return isH265KeyNal(nalType)
+	}
+
+	return false
+}
+
+func isVP8KeyFrame(payload []byte) bool {
+	b0 := payload[0]
+	// start of a partition 0
+	if b0&0x10 == 0 || b0&0x07 != 0 {
+		return false
+	}
+
+	idx := 1
+	if b0&0x80 != 0 {
+		if len(payload) <= idx {
+			return false
+		}
+		x := payload[idx]
+		idx++
+		if x&0x80 != 0 {
+			if len(payload) <= idx {
+				return false
+			}
+			if payload[idx]&0x80 != 0 {
+				idx += 2
+			} else {
+				idx++
+			}
+		}
+		if x&0x40 != 0 {
+			idx++
+		}
+		if x&0x30 != 0 {
+			idx++
+		}
+	}
+
+	return len(payload) > idx && payload[idx]&0x01 == 0
+}
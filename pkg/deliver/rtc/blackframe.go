@@ -0,0 +1,181 @@
+package rtc
+
+// An H264 black picture, what a muted video track sends as keepalive. The
+// top left macroblock is I_PCM with black samples, the others are
+// Intra_16x16 DC predicted from it without residual, so that the picture
+// takes a few hundred bytes and fits in a single STAP-A packet.
+
+const (
+	blackFrameWidthMbs  = 20 // 320 pixels
+	blackFrameHeightMbs = 15 // 240 pixels
+
+	nalSPS   = 0x67
+	nalPPS   = 0x68
+	nalIDR   = 0x65
+	nalSTAPA = 0x78
+
+	pcmLuma   = 0x10
+	pcmChroma = 0x80
+)
+
+type bitWriter struct {
+	buf  []byte
+	nbit int
+}
+
+func (w *bitWriter) bit(b uint) {
+	if w.nbit%8 == 0 {
+		w.buf = append(w.buf, 0)
+	}
+
+	if b != 0 {
+		w.buf[len(w.buf)-1] |= 0x80 >> (w.nbit % 8)
+	}
+	w.nbit++
+}
+
+func (w *bitWriter) bits(v uint, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.bit(v >> i & 1)
+	}
+}
+
+// ue writes an Exp-Golomb code.
+func (w *bitWriter) ue(v uint) {
+	v++
+	n := 0
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+
+	w.bits(0, n)
+	w.bits(v, n+1)
+}
+
+func (w *bitWriter) align() {
+	for w.nbit%8 != 0 {
+		w.bit(0)
+	}
+}
+
+// nal ends the rbsp and escapes it into a nal unit.
+func (w *bitWriter) nal(header byte) []byte {
+	w.bit(1)
+	w.align()
+
+	nal := []byte{header}
+	zeros := 0
+	for _, b := range w.buf {
+		if zeros == 2 && b <= 3 {
+			nal = append(nal, 3)
+			zeros = 0
+		}
+
+		nal = append(nal, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+
+	return nal
+}
+
+func blackFrameSPS() []byte {
+	w := &bitWriter{}
+	w.bits(66, 8)   // profile_idc, baseline
+	w.bits(0xc0, 8) // constraint_set0 and set1, constrained baseline
+	w.bits(11, 8)   // level_idc 1.1
+	w.ue(0)         // seq_parameter_set_id
+	w.ue(0)         // log2_max_frame_num_minus4
+	w.ue(2)         // pic_order_cnt_type
+	w.ue(1)         // max_num_ref_frames
+	w.bit(0)        // gaps_in_frame_num_value_allowed_flag
+	w.ue(blackFrameWidthMbs - 1)
+	w.ue(blackFrameHeightMbs - 1)
+	w.bit(1) // frame_mbs_only_flag
+	w.bit(1) // direct_8x8_inference_flag
+	w.bit(0) // frame_cropping_flag
+	w.bit(0) // vui_parameters_present_flag
+
+	return w.nal(nalSPS)
+}
+
+func blackFramePPS() []byte {
+	w := &bitWriter{}
+	w.ue(0)      // pic_parameter_set_id
+	w.ue(0)      // seq_parameter_set_id
+	w.bit(0)     // entropy_coding_mode_flag, cavlc
+	w.bit(0)     // bottom_field_pic_order_in_frame_present_flag
+	w.ue(0)      // num_slice_groups_minus1
+	w.ue(0)      // num_ref_idx_l0_default_active_minus1
+	w.ue(0)      // num_ref_idx_l1_default_active_minus1
+	w.bit(0)     // weighted_pred_flag
+	w.bits(0, 2) // weighted_bipred_idc
+	w.ue(0)      // pic_init_qp_minus26, se(0)
+	w.ue(0)      // pic_init_qs_minus26, se(0)
+	w.ue(0)      // chroma_qp_index_offset, se(0)
+	w.bit(1)     // deblocking_filter_control_present_flag
+	w.bit(0)     // constrained_intra_pred_flag
+	w.bit(0)     // redundant_pic_cnt_present_flag
+
+	return w.nal(nalPPS)
+}
+
+// blackFrameIDR is the slice of the picture, consecutive pictures need
+// different idrPicIDs.
+func blackFrameIDR(idrPicID uint) []byte {
+	w := &bitWriter{}
+	w.ue(0)        // first_mb_in_slice
+	w.ue(7)        // slice_type, I
+	w.ue(0)        // pic_parameter_set_id
+	w.bits(0, 4)   // frame_num
+	w.ue(idrPicID) // idr_pic_id
+	w.bit(0)       // no_output_of_prior_pics_flag
+	w.bit(0)       // long_term_reference_flag
+	w.ue(0)        // slice_qp_delta, se(0)
+	w.ue(1)        // disable_deblocking_filter_idc
+
+	for y := 0; y < blackFrameHeightMbs; y++ {
+		for x := 0; x < blackFrameWidthMbs; x++ {
+			if x == 0 && y == 0 {
+				w.ue(25) // mb_type I_PCM
+				w.align()
+				for i := 0; i < 256; i++ {
+					w.bits(pcmLuma, 8)
+				}
+				for i := 0; i < 128; i++ {
+					w.bits(pcmChroma, 8)
+				}
+				continue
+			}
+
+			w.ue(3) // mb_type I_16x16_2_0_0, DC prediction without residual
+			w.ue(0) // intra_chroma_pred_mode, DC
+			w.ue(0) // mb_qp_delta, se(0)
+
+			// the coeff_token of the empty DC block, its table depends on
+			// the coefficients of the neighbours: 16 for the I_PCM one
+			if (x == 1 && y == 0) || (x == 0 && y == 1) {
+				w.bits(0x3, 6)
+			} else {
+				w.bit(1)
+			}
+		}
+	}
+
+	return w.nal(nalIDR)
+}
+
+// blackFramePayload returns the STAP-A payload of a black picture with
+// its parameter sets.
+func blackFramePayload(idrPicID uint) []byte {
+	payload := []byte{nalSTAPA}
+	for _, nal := range [][]byte{blackFrameSPS(), blackFramePPS(), blackFrameIDR(idrPicID)} {
+		payload = append(payload, byte(len(nal)>>8), byte(len(nal)))
+		payload = append(payload, nal...)
+	}
+
+	return payload
+}
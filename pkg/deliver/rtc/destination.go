@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/metrics"
 	"github.com/pingostack/neon/pkg/rtclib"
 	"github.com/pingostack/neon/pkg/rtclib/sdpassistor"
 	"github.com/pion/rtcp"
@@ -26,6 +27,11 @@ type FrameDestination struct {
 	videoTrack              *rtclib.TrackLocl
 	onceClose               sync.Once
 	chSourceCompletePromise chan error
+	audioMute               muter
+	videoMute               muter
+	lock                    sync.Mutex
+	metadata                string
+	onMetadata              func(md deliver.Metadata)
 }
 
 func NewFrameDestination(ctx context.Context, streamFactory rtclib.StreamFactory, preferTCP bool, logger *logrus.Entry) (fd *FrameDestination, err error) {
@@ -90,6 +96,12 @@ func (fd *FrameDestination) SetRemoteDescription(remoteSdp webrtc.SessionDescrip
 	return nil
 }
 
+// PrepareOffer lets the destination make the offer, it receives the
+// source as is and offers the tracks of the source.
+func (fd *FrameDestination) PrepareOffer() {
+	fd.FrameDestination = deliver.NewFrameDestinationImpl(fd.ctx, deliver.FormatSettings{})
+}
+
 func (fd *FrameDestination) CreateOffer(options *webrtc.OfferOptions) (webrtc.SessionDescription, error) {
 	return fd.LocalStream.CreateOffer(options)
 }
@@ -162,6 +174,76 @@ func (fd *FrameDestination) OnSource(src deliver.FrameSource) (err error) {
 	return nil
 }
 
+// OnMetaData keeps the metadata of the source, its changes are reported
+// to the OnMetadata callback.
+func (fd *FrameDestination) OnMetaData(metadata *deliver.Metadata) {
+	fd.FrameDestination.OnMetaData(metadata)
+
+	md := metadata.String()
+	fd.lock.Lock()
+	changed := fd.metadata != "" && fd.metadata != md
+	fd.metadata = md
+	f := fd.onMetadata
+	fd.lock.Unlock()
+
+	if changed && f != nil {
+		f(*metadata)
+	}
+}
+
+// OnMetadata calls f when the metadata of the source change, e.g. its
+// producer was replaced by one with other tracks.
+func (fd *FrameDestination) OnMetadata(f func(md deliver.Metadata)) {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	fd.onMetadata = f
+}
+
+// Renegotiate adds the tracks of md the destination lacks and returns the
+// offer for them, nil when none is missing. The answer of the peer is
+// given to SetRenegotiationAnswer.
+func (fd *FrameDestination) Renegotiate(ctx context.Context, md deliver.Metadata) (*webrtc.SessionDescription, error) {
+	added := false
+	if md.Audio != nil && fd.audioTrack == nil {
+		if err := fd.AddAudioTrack(md.Audio); err != nil {
+			return nil, errors.Wrap(err, "failed to add audio track")
+		}
+		added = true
+	}
+
+	if md.Video != nil && fd.videoTrack == nil {
+		if err := fd.AddVideoTrack(md.Video); err != nil {
+			return nil, errors.Wrap(err, "failed to add video track")
+		}
+		added = true
+	}
+
+	if !added {
+		return nil, nil
+	}
+
+	if _, err := fd.CreateOffer(nil); err != nil {
+		return nil, errors.Wrap(err, "failed to create offer")
+	}
+
+	lsdp, err := fd.LocalStream.GatheringCompleteLocalSdp(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get completed sdp")
+	}
+
+	return &lsdp, nil
+}
+
+// SetRenegotiationAnswer sets the answer of the peer to the offer of
+// Renegotiate.
+func (fd *FrameDestination) SetRenegotiationAnswer(sdp string) error {
+	return fd.LocalStream.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeAnswer,
+		SDP:  sdp,
+	})
+}
+
 func (fd *FrameDestination) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -173,15 +255,18 @@ func (fd *FrameDestination) OnFrame(frame deliver.Frame, attr deliver.Attributes
 		return
 	}
 
-	var track *rtclib.TrackLocl
+	var (
+		track *rtclib.TrackLocl
+		mute  *muter
+	)
 	if frame.Codec.IsAudio() {
-		track = fd.audioTrack
+		track, mute = fd.audioTrack, &fd.audioMute
 		if track == nil {
 			fd.logger.WithField("codec", frame.Codec).Error("audio track not found")
 			return
 		}
 	} else if frame.Codec.IsVideo() {
-		track = fd.videoTrack
+		track, mute = fd.videoTrack, &fd.videoMute
 		if track == nil {
 			fd.logger.WithField("codec", frame.Codec).Error("video track not found")
 			return
@@ -197,12 +282,25 @@ func (fd *FrameDestination) OnFrame(frame deliver.Frame, attr deliver.Attributes
 		return
 	}
 
+	if packet = mute.filter(frame.Codec, packet); packet == nil {
+		return
+	}
+
 	err := track.WriteRTP(packet)
 	if err != nil {
 		fd.logger.WithError(err).Error("failed to write rtp packet")
 	}
 }
 
+// Mute stops forwarding the audio or video of the source to the
+// subscriber, with a keepalive in their place if asked.
+func (fd *FrameDestination) Mute(audio, video, keepalive bool) {
+	fd.audioMute.set(audio, keepalive)
+	if fd.videoMute.set(video, keepalive) {
+		fd.sendPLI()
+	}
+}
+
 func (fd *FrameDestination) loopReadRTCP(track *rtclib.TrackLocl) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -237,10 +335,14 @@ func (fd *FrameDestination) loopReadRTCP(track *rtclib.TrackLocl) {
 					switch p := pkt.(type) {
 					case *rtcp.PictureLossIndication:
 						fd.logger.WithField("ssrc", p.MediaSSRC).WithField("attri", a).Debug("received pli")
+						metrics.Feedback(metrics.FeedbackPLI, metrics.DirectionReceived)
 						fd.sendPLI()
 					case *rtcp.FullIntraRequest:
 						fd.logger.WithField("ssrc", p.MediaSSRC).WithField("attri", a).Debug("received fir")
+						metrics.Feedback(metrics.FeedbackFIR, metrics.DirectionReceived)
 						fd.sendFIR()
+					case *rtcp.TransportLayerNack:
+						metrics.Feedback(metrics.FeedbackNACK, metrics.DirectionReceived)
 					default:
 						//	fd.logger.WithField("pkt-type", reflect.TypeOf(pkt)).Debug("received rtcp")
 					}
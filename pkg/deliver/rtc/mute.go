@@ -0,0 +1,119 @@
+package rtc
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pion/rtp"
+)
+
+// blackFrameInterval is the interval of the black pictures of a muted
+// video track.
+const blackFrameInterval = time.Second
+
+var (
+	// opusSilence is a 20ms silent opus frame
+	opusSilence = []byte{0xf8, 0xff, 0xfe}
+
+	blackFrames = [2][]byte{blackFramePayload(0), blackFramePayload(1)}
+)
+
+// muter stops forwarding the packets of a muted track. A keepalive
+// replaces them when asked and the codec has one: silence for opus and
+// G.711, black pictures for H264. The sequence numbers of the packets
+// forwarded stay continuous, receivers do not see the muted packets as
+// lost.
+type muter struct {
+	lock      sync.Mutex
+	muted     bool
+	keepalive bool
+	// delta is added to the sequence numbers, minus the packets dropped
+	delta       uint16
+	lastBlack   time.Time
+	blackFrames uint
+}
+
+// set mutes or unmutes the track, it returns whether it was unmuted.
+func (m *muter) set(muted, keepalive bool) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	unmuted := m.muted && !muted
+	m.muted, m.keepalive = muted, keepalive
+	if muted {
+		m.lastBlack = time.Time{}
+	}
+
+	return unmuted
+}
+
+func (m *muter) isMuted() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.muted
+}
+
+// filter returns the packet to forward in place of pkt, nil to drop it.
+// pkt may be delivered to other destinations and is not modified.
+func (m *muter) filter(codec deliver.CodecType, pkt *rtp.Packet) *rtp.Packet {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.muted {
+		if m.delta == 0 {
+			return pkt
+		}
+
+		out := *pkt
+		out.SequenceNumber += m.delta
+		return &out
+	}
+
+	var payload []byte
+	if m.keepalive {
+		payload = m.keepalivePayload(codec, pkt)
+	}
+
+	if payload == nil {
+		m.delta--
+		return nil
+	}
+
+	out := &rtp.Packet{
+		Header:  pkt.Header,
+		Payload: payload,
+	}
+	out.Padding = false
+	out.SequenceNumber += m.delta
+	if codec.IsVideo() {
+		out.Marker = true
+	}
+
+	return out
+}
+
+func (m *muter) keepalivePayload(codec deliver.CodecType, pkt *rtp.Packet) []byte {
+	switch codec {
+	case deliver.CodecTypeOpus:
+		return opusSilence
+	case deliver.CodecTypePCMU:
+		return bytes.Repeat([]byte{0xff}, len(pkt.Payload))
+	case deliver.CodecTypePCMA:
+		return bytes.Repeat([]byte{0xd5}, len(pkt.Payload))
+	case deliver.CodecTypeH264:
+		// a picture in place of a packet every blackFrameInterval, the
+		// other packets are dropped
+		if time.Since(m.lastBlack) < blackFrameInterval {
+			return nil
+		}
+
+		m.lastBlack = time.Now()
+		m.blackFrames++
+		return blackFrames[m.blackFrames%2]
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package rtc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pion/rtp"
+)
+
+func packet(seq uint16) *rtp.Packet {
+	return &rtp.Packet{
+		Header:  rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 960},
+		Payload: []byte{1, 2, 3, 4},
+	}
+}
+
+// forward filters n packets numbered from first and returns the sequence
+// numbers and payloads of the packets forwarded.
+func forward(t *testing.T, m *muter, codec deliver.CodecType, first uint16, n int) ([]uint16, [][]byte) {
+	var (
+		seqs     []uint16
+		payloads [][]byte
+	)
+
+	for i := 0; i < n; i++ {
+		seq := first + uint16(i)
+		pkt := packet(seq)
+		out := m.filter(codec, pkt)
+		if pkt.SequenceNumber != seq || !bytes.Equal(pkt.Payload, []byte{1, 2, 3, 4}) {
+			t.Fatalf("filter modified packet %d", seq)
+		}
+
+		if out != nil {
+			seqs = append(seqs, out.SequenceNumber)
+			payloads = append(payloads, out.Payload)
+		}
+	}
+
+	return seqs, payloads
+}
+
+func continuous(seqs []uint16, first uint16) bool {
+	for i, seq := range seqs {
+		if seq != first+uint16(i) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestMuterSet(t *testing.T) {
+	m := &muter{}
+	if m.set(false, false) {
+		t.Error("unmuting an unmuted track reported unmuted")
+	}
+
+	if m.set(true, false) || !m.isMuted() {
+		t.Error("track not muted")
+	}
+
+	if !m.set(false, false) || m.isMuted() {
+		t.Error("track not unmuted")
+	}
+}
+
+func TestMuterPassThrough(t *testing.T) {
+	m := &muter{}
+	pkt := packet(10)
+	if out := m.filter(deliver.CodecTypeOpus, pkt); out != pkt {
+		t.Error("unmuted packet copied")
+	}
+}
+
+func TestMuterDrops(t *testing.T) {
+	m := &muter{}
+	seqs, _ := forward(t, m, deliver.CodecTypeOpus, 10, 3)
+
+	m.set(true, false)
+	if muted, _ := forward(t, m, deliver.CodecTypeOpus, 13, 8); len(muted) != 0 {
+		t.Fatalf("muted track forwarded %v", muted)
+	}
+
+	m.set(false, false)
+	unmuted, _ := forward(t, m, deliver.CodecTypeOpus, 21, 3)
+
+	// the sequence numbers go on where they stopped, without a gap
+	if seqs = append(seqs, unmuted...); len(seqs) != 6 || !continuous(seqs, 10) {
+		t.Errorf("sequence numbers = %v, want 10 to 15", seqs)
+	}
+}
+
+func TestMuterSequenceWraps(t *testing.T) {
+	m := &muter{}
+	seqs, _ := forward(t, m, deliver.CodecTypeOpus, 0xfff0, 4)
+
+	m.set(true, false)
+	forward(t, m, deliver.CodecTypeOpus, 0xfff4, 10)
+	m.set(false, false)
+
+	unmuted, _ := forward(t, m, deliver.CodecTypeOpus, 0xfffe, 4)
+	if seqs = append(seqs, unmuted...); len(seqs) != 8 || !continuous(seqs, 0xfff0) {
+		t.Errorf("sequence numbers = %v, want 0xfff0 to 0xfff7", seqs)
+	}
+}
+
+func TestMuterAudioKeepalive(t *testing.T) {
+	tests := []struct {
+		codec   deliver.CodecType
+		payload []byte
+	}{
+		{deliver.CodecTypeOpus, opusSilence},
+		{deliver.CodecTypePCMU, []byte{0xff, 0xff, 0xff, 0xff}},
+		{deliver.CodecTypePCMA, []byte{0xd5, 0xd5, 0xd5, 0xd5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.codec.String(), func(t *testing.T) {
+			m := &muter{}
+			m.set(true, true)
+
+			seqs, payloads := forward(t, m, tt.codec, 10, 5)
+			if len(seqs) != 5 || !continuous(seqs, 10) {
+				t.Fatalf("sequence numbers = %v, want 10 to 14", seqs)
+			}
+
+			for _, p := range payloads {
+				if !bytes.Equal(p, tt.payload) {
+					t.Fatalf("payload = %x, want %x", p, tt.payload)
+				}
+			}
+		})
+	}
+}
+
+func TestMuterBlackFrames(t *testing.T) {
+	m := &muter{}
+	m.set(true, true)
+
+	// one picture in place of the packets of a second
+	seqs, payloads := forward(t, m, deliver.CodecTypeH264, 10, 31)
+	if len(seqs) != 1 || seqs[0] != 10 {
+		t.Fatalf("sequence numbers = %v, want [10]", seqs)
+	}
+
+	if !bytes.Equal(payloads[0], blackFrames[1]) {
+		t.Errorf("payload is not a black picture")
+	}
+
+	m.set(false, false)
+	if seqs, _ := forward(t, m, deliver.CodecTypeH264, 41, 2); !continuous(seqs, 11) {
+		t.Errorf("sequence numbers = %v, want [11 12]", seqs)
+	}
+}
+
+func TestMuterNoKeepalive(t *testing.T) {
+	m := &muter{}
+	m.set(true, true)
+
+	if seqs, _ := forward(t, m, deliver.CodecTypeVP8, 10, 11); len(seqs) != 0 {
+		t.Errorf("VP8 keepalive forwarded %v", seqs)
+	}
+}
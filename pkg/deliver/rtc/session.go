@@ -6,13 +6,25 @@ import (
 
 	"github.com/pingostack/neon/internal/core"
 	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/deliver"
 	"github.com/pingostack/neon/pkg/rtclib"
 	"github.com/pingostack/neon/pkg/rtclib/sdpassistor"
+	"github.com/pingostack/neon/pkg/rtclib/transport"
 	"github.com/pion/webrtc/v4"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+var (
+	ErrNoOffer         = errors.New("no offer to answer")
+	ErrAlreadyAnswered = errors.New("offer already answered")
+	ErrAnswerTimeout   = errors.New("answer timeout")
+	// ErrLayerSelectionUnsupported is returned when capping a subscriber,
+	// its bitrate is capped by selecting a lower simulcast or svc layer
+	// and the sources forward a single one
+	ErrLayerSelectionUnsupported = errors.New("layer selection unsupported")
+)
+
 type ServSession struct {
 	router.Session
 	pm     router.PeerParams
@@ -21,6 +33,8 @@ type ServSession struct {
 	dest   *FrameDestination
 	src    *FrameSource
 	sf     rtclib.StreamFactory
+	// answered is closed once the offer of SubscribeOffer is answered
+	answered chan struct{}
 }
 
 func NewServSession(ctx context.Context, sf rtclib.StreamFactory, pm router.PeerParams, logger *logrus.Entry) *ServSession {
@@ -85,6 +99,7 @@ func (s *ServSession) Publish(keyFrameInterval time.Duration, sdpOffer string) (
 
 	err = session.Join()
 	if err != nil {
+		session.Finalize(err)
 		logger.WithError(err).Error("join failed")
 		return nil, errors.Wrap(err, "join failed")
 	}
@@ -118,6 +133,7 @@ func (s *ServSession) Subscribe(sdpOffer string, timeout time.Duration) (*webrtc
 	dest, err := NewFrameDestination(s.ctx, s.sf,
 		false, logger)
 	if err != nil {
+		s.Finalize(err)
 		logger.WithError(err).Error("failed to create frame destination")
 		return nil, errors.Wrap(err, "failed create frame destination")
 	}
@@ -127,58 +143,307 @@ func (s *ServSession) Subscribe(sdpOffer string, timeout time.Duration) (*webrtc
 		SDP:  sdpOffer,
 	})
 	if err != nil {
+		dest.Close()
+		s.Finalize(err)
 		logger.WithError(err).Error("failed to set remote description")
 		return nil, errors.Wrap(err, "failed to set remote description")
 	}
 
 	err = s.BindFrameDestination(dest)
 	if err != nil {
+		dest.Close()
+		s.Finalize(err)
 		logger.WithError(err).Error("failed to bind frame destination")
 		return nil, errors.Wrap(err, "failed to bind frame source")
 	}
 
-	err = s.Join()
+	if err = s.join(dest, timeout); err != nil {
+		s.Finalize(err)
+		return nil, err
+	}
+
+	_, err = dest.CreateAnswer(nil)
+	if err != nil {
+		s.Finalize(err)
+		logger.WithError(err).Error("failed to create answer")
+		return nil, errors.Wrap(err, "failed to create answer")
+	}
+
+	lsdp, err := dest.GatheringCompleteLocalSdp(context.Background())
+	if err != nil {
+		s.Finalize(err)
+		logger.WithError(err).Error("failed to get completed sdp")
+		return nil, errors.Wrap(err, "failed to get completed sdp")
+	}
+
+	err = dest.Start()
+	if err != nil {
+		s.Finalize(err)
+		logger.WithError(err).Error("failed to start frame destination")
+		return nil, errors.Wrap(err, "failed to start frame destination")
+	}
+
+	s.dest = dest
+
+	return &lsdp, nil
+}
+
+// join joins the router, waiting up to timeout for its producer. The
+// caller finalizes the session on error.
+func (s *ServSession) join(dest *FrameDestination, timeout time.Duration) error {
+	logger := s.logger
+	err := s.Join()
 	if err != nil {
 		if errors.Is(err, router.ErrPaddingDestination) {
 			select {
 			case <-s.ctx.Done():
-				return nil, errors.Wrap(err, "context done")
+				return errors.Wrap(err, "context done")
 			case err = <-dest.SourceCompletePromise():
 				if err != nil {
 					logger.WithError(err).Error("join failed")
-					return nil, errors.Wrap(err, "join failed")
+					return errors.Wrap(err, "join failed")
 				} else {
 					logger.Info("join success")
 				}
 			case <-time.After(timeout):
 				logger.WithField("timeout", timeout).Error("join timeout")
-				return nil, errors.New("join timeout")
+				return errors.New("join timeout")
 			}
 		} else {
 			logger.WithError(err).Error("join failed")
-			return nil, errors.Wrap(err, "join failed")
+			return errors.Wrap(err, "join failed")
 		}
 	}
 
-	_, err = dest.CreateAnswer(nil)
+	return nil
+}
+
+// SubscribeOffer joins the router like Subscribe for the peers that can
+// not make an offer: the offer of the tracks of the producer is returned
+// and the answer of the peer given to Answer.
+func (s *ServSession) SubscribeOffer(timeout time.Duration) (*webrtc.SessionDescription, error) {
+	logger := s.logger
+
+	s.pm.Producer = false
+	s.Session = core.NewSession(s.ctx, s.pm, logger)
+
+	dest, err := NewFrameDestination(s.ctx, s.sf,
+		false, logger)
 	if err != nil {
-		logger.WithError(err).Error("failed to create answer")
-		return nil, errors.Wrap(err, "failed to create answer")
+		s.Finalize(err)
+		logger.WithError(err).Error("failed to create frame destination")
+		return nil, errors.Wrap(err, "failed create frame destination")
+	}
+
+	dest.PrepareOffer()
+
+	err = s.BindFrameDestination(dest)
+	if err != nil {
+		dest.Close()
+		s.Finalize(err)
+		logger.WithError(err).Error("failed to bind frame destination")
+		return nil, errors.Wrap(err, "failed to bind frame destination")
+	}
+
+	if err = s.join(dest, timeout); err != nil {
+		s.Finalize(err)
+		return nil, err
+	}
+
+	_, err = dest.CreateOffer(nil)
+	if err != nil {
+		s.Finalize(err)
+		logger.WithError(err).Error("failed to create offer")
+		return nil, errors.Wrap(err, "failed to create offer")
 	}
 
 	lsdp, err := dest.GatheringCompleteLocalSdp(context.Background())
 	if err != nil {
+		s.Finalize(err)
 		logger.WithError(err).Error("failed to get completed sdp")
 		return nil, errors.Wrap(err, "failed to get completed sdp")
 	}
 
-	err = dest.Start()
+	s.dest = dest
+	s.answered = make(chan struct{})
+	go s.waitAnswer(timeout)
+
+	return &lsdp, nil
+}
+
+// waitAnswer finalizes the session when its offer is not answered within
+// the timeout.
+func (s *ServSession) waitAnswer(timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-s.Context().Done():
+	case <-s.answered:
+	case <-timer.C:
+		s.logger.WithField("timeout", timeout).Error("answer timeout")
+		s.Finalize(ErrAnswerTimeout)
+	}
+}
+
+// Answer sets the answer of the peer to the offer of SubscribeOffer.
+func (s *ServSession) Answer(sdpAnswer string) error {
+	dest := s.dest
+	if dest == nil || dest.LocalSdpType() != webrtc.SDPTypeOffer {
+		return ErrNoOffer
+	}
+
+	if dest.RemoteSdpSetted() {
+		return ErrAlreadyAnswered
+	}
+
+	err := dest.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeAnswer,
+		SDP:  sdpAnswer,
+	})
 	if err != nil {
-		logger.WithError(err).Error("failed to start frame destination")
-		return nil, errors.Wrap(err, "failed to start frame destination")
+		s.logger.WithError(err).Error("failed to set remote description")
+		return errors.Wrap(err, "failed to set remote description")
 	}
 
-	s.dest = dest
+	if err = dest.Start(); err != nil {
+		s.logger.WithError(err).Error("failed to start frame destination")
+		return errors.Wrap(err, "failed to start frame destination")
+	}
 
-	return &lsdp, nil
+	close(s.answered)
+
+	return nil
+}
+
+func (s *ServSession) transport() *transport.Transport {
+	if s.src != nil {
+		return s.src.RemoteStream.Transport
+	}
+
+	if s.dest != nil {
+		return s.dest.LocalStream.Transport
+	}
+
+	return nil
+}
+
+// Patch applies a trickle-ice-sdpfrag of the peer. Its candidates are
+// added, unless its credentials changed: ICE is restarted and the
+// fragment of the new local credentials and candidates returned.
+func (s *ServSession) Patch(ctx context.Context, frag *sdpassistor.ICEFragment) (string, error) {
+	t := s.transport()
+	if t == nil {
+		return "", errors.New("session not negotiated")
+	}
+
+	var answer string
+	if frag.Ufrag != "" && t.ICECredentialChanged(frag.Ufrag, frag.Pwd) {
+		lsdp, err := t.RestartICE(ctx, frag.Ufrag, frag.Pwd)
+		if err != nil {
+			s.logger.WithError(err).Error("failed to restart ice")
+			return "", errors.Wrap(err, "failed to restart ice")
+		}
+
+		answer, err = sdpassistor.MarshalICEFragment(lsdp)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to marshal ice fragment")
+		}
+	}
+
+	for _, c := range frag.Candidates {
+		if err := t.AddRemoteCandidate(c); err != nil {
+			s.logger.WithError(err).Errorf("failed to add remote candidate %s", c.Candidate)
+		}
+	}
+
+	return answer, nil
+}
+
+// Mute stops forwarding the audio or video of the session: a publisher
+// stops feeding all its subscribers, a subscriber stops receiving. With
+// keepalive the tracks carry silence and black pictures instead.
+func (s *ServSession) Mute(audio, video, keepalive bool) error {
+	if s.src != nil {
+		s.src.Mute(audio, video, keepalive)
+		return nil
+	}
+
+	if s.dest != nil {
+		s.dest.Mute(audio, video, keepalive)
+		return nil
+	}
+
+	return errors.New("session not negotiated")
+}
+
+// SetMaxBitrate caps the bitrate of a publisher, in bits per second, 0
+// lifts the cap.
+func (s *ServSession) SetMaxBitrate(bitrate uint64) error {
+	if s.src != nil {
+		return s.src.SetMaxBitrate(bitrate)
+	}
+
+	if s.dest != nil {
+		return ErrLayerSelectionUnsupported
+	}
+
+	return errors.New("session not negotiated")
+}
+
+// OnICECandidate calls f with the local candidates gathered once the
+// description was returned, e.g. after an ICE restart.
+func (s *ServSession) OnICECandidate(f func(c webrtc.ICECandidateInit)) {
+	if t := s.transport(); t != nil {
+		t.OnICECandidate(f)
+	}
+}
+
+// AddRemoteCandidate adds a candidate trickled by the peer.
+func (s *ServSession) AddRemoteCandidate(c webrtc.ICECandidateInit) error {
+	t := s.transport()
+	if t == nil {
+		return errors.New("session not negotiated")
+	}
+
+	return t.AddRemoteCandidate(c)
+}
+
+// OnMetadata calls f when the media of the producer of a subscriber
+// change.
+func (s *ServSession) OnMetadata(f func(md deliver.Metadata)) {
+	if s.dest != nil {
+		s.dest.OnMetadata(f)
+	}
+}
+
+// Renegotiate returns the offer of the tracks of md a subscriber lacks,
+// nil when it has them all.
+func (s *ServSession) Renegotiate(md deliver.Metadata) (*webrtc.SessionDescription, error) {
+	if s.dest == nil {
+		return nil, errors.New("session not subscribed")
+	}
+
+	lsdp, err := s.dest.Renegotiate(context.Background(), md)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to renegotiate")
+		return nil, errors.Wrap(err, "failed to renegotiate")
+	}
+
+	return lsdp, nil
+}
+
+// AnswerRenegotiation sets the answer of the peer to the offer of
+// Renegotiate.
+func (s *ServSession) AnswerRenegotiation(sdpAnswer string) error {
+	if s.dest == nil {
+		return ErrNoOffer
+	}
+
+	if err := s.dest.SetRenegotiationAnswer(sdpAnswer); err != nil {
+		s.logger.WithError(err).Error("failed to set renegotiation answer")
+		return errors.Wrap(err, "failed to set renegotiation answer")
+	}
+
+	return nil
 }
@@ -8,12 +8,23 @@ import (
 	"time"
 
 	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/metrics"
 	"github.com/pingostack/neon/pkg/rtclib"
 	"github.com/pingostack/neon/pkg/rtclib/sdpassistor"
 	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v4"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.uber.org/atomic"
+)
+
+const (
+	// bitrateCapInterval is the interval of the REMB and TMMBR of a
+	// capped publisher, they are repeated like a receiver estimate
+	bitrateCapInterval = time.Second
+	// uncappedBitrate lifts the cap of a publisher, the senders keep the
+	// last bitrate asked
+	uncappedBitrate = 1 << 30
 )
 
 type FrameSource struct {
@@ -29,6 +40,10 @@ type FrameSource struct {
 	videoTrack       *rtclib.TrackRemote
 	audioTrack       *rtclib.TrackRemote
 	onceClose        sync.Once
+	audioMute        muter
+	videoMute        muter
+	maxBitrate       atomic.Uint64
+	onceBitrateCap   sync.Once
 }
 
 func NewFrameSource(ctx context.Context, streamFactory rtclib.StreamFactory, preferTCP bool, keyFrameInterval time.Duration, logger *logrus.Entry) (fs *FrameSource, err error) {
@@ -202,6 +217,8 @@ func (fs *FrameSource) sendPLI() {
 		return
 	}
 
+	metrics.Feedback(metrics.FeedbackPLI, metrics.DirectionSent)
+
 	fs.logger.WithField("track", fs.videoTrack.SSRC()).Debug("send pli")
 }
 
@@ -262,8 +279,14 @@ func (fs *FrameSource) loopReadRTP(track *rtclib.TrackRemote) {
 			var codec deliver.CodecType
 			if track.IsAudio() {
 				codec = deliver.ConvCodecType(fs.metadata.Audio.Codec)
+				rtpPacket = fs.audioMute.filter(codec, rtpPacket)
 			} else if track.IsVideo() {
 				codec = deliver.ConvCodecType(fs.metadata.Video.Codec)
+				rtpPacket = fs.videoMute.filter(codec, rtpPacket)
+			}
+
+			if rtpPacket == nil {
+				continue
 			}
 
 			var additionalInfo deliver.FrameSpecificInfo
@@ -312,6 +335,92 @@ func (fs *FrameSource) OnFeedback(feedback deliver.FeedbackMsg) {
 
 }
 
+// Mute stops forwarding the audio or video of the publisher to all its
+// subscribers, with a keepalive in their place if asked.
+func (fs *FrameSource) Mute(audio, video, keepalive bool) {
+	fs.audioMute.set(audio, keepalive)
+	if fs.videoMute.set(video, keepalive) {
+		fs.sendPLI()
+	}
+}
+
+// Muted returns whether the audio and video of the publisher are muted.
+func (fs *FrameSource) Muted() (audio, video bool) {
+	return fs.audioMute.isMuted(), fs.videoMute.isMuted()
+}
+
+// SetMaxBitrate caps the bitrate of the publisher through REMB and TMMBR,
+// 0 lifts the cap.
+func (fs *FrameSource) SetMaxBitrate(bitrate uint64) error {
+	fs.maxBitrate.Store(bitrate)
+	fs.onceBitrateCap.Do(func() {
+		go fs.loopBitrateCap()
+	})
+
+	if bitrate == 0 {
+		bitrate = uncappedBitrate
+	}
+
+	return fs.sendBitrateCap(bitrate)
+}
+
+func (fs *FrameSource) loopBitrateCap() {
+	ticker := time.NewTicker(bitrateCapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fs.ctx.Done():
+			return
+		case <-ticker.C:
+			if bitrate := fs.maxBitrate.Load(); bitrate > 0 {
+				fs.sendBitrateCap(bitrate)
+			}
+		}
+	}
+}
+
+func (fs *FrameSource) sendBitrateCap(bitrate uint64) error {
+	var ssrcs []uint32
+	for _, track := range []*rtclib.TrackRemote{fs.audioTrack, fs.videoTrack} {
+		if track != nil {
+			ssrcs = append(ssrcs, uint32(track.SSRC()))
+		}
+	}
+
+	// the tracks are not gathered yet, the loop sends the cap later
+	if len(ssrcs) == 0 {
+		return nil
+	}
+
+	tmmbr := &rtclib.TMMBR{}
+	for _, ssrc := range ssrcs {
+		tmmbr.Entries = append(tmmbr.Entries, rtclib.TMMBREntry{
+			SSRC:    ssrc,
+			Bitrate: bitrate,
+		})
+	}
+
+	err := fs.RemoteStream.PeerConnection.WriteRTCP([]rtcp.Packet{
+		&rtcp.ReceiverEstimatedMaximumBitrate{
+			Bitrate: float32(bitrate),
+			SSRCs:   ssrcs,
+		},
+		tmmbr,
+	})
+	if err != nil {
+		fs.logger.WithError(err).Error("failed to send bitrate cap")
+		return errors.Wrap(err, "failed to send bitrate cap")
+	}
+
+	metrics.Feedback(metrics.FeedbackREMB, metrics.DirectionSent)
+	metrics.Feedback(metrics.FeedbackTMMBR, metrics.DirectionSent)
+
+	fs.logger.WithField("bitrate", bitrate).Debug("send bitrate cap")
+
+	return nil
+}
+
 func (fs *FrameSource) close() {
 	fs.onceClose.Do(func() {
 		fs.cancel()
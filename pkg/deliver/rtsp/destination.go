@@ -0,0 +1,185 @@
+package rtsp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	proto_rtsp "github.com/pingostack/neon/protocols/rtsp"
+	"github.com/pion/rtp"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// PacketWriter sends the RTP packets of a track to an RTSP client,
+// *proto_rtsp.Serv implements it over the interleaved channels.
+type PacketWriter interface {
+	WriteRTP(kind proto_rtsp.TrackKind, pkt []byte) error
+}
+
+type FrameDestination struct {
+	deliver.FrameDestination
+	ctx                     context.Context
+	cancel                  context.CancelFunc
+	logger                  *logrus.Entry
+	lock                    sync.RWMutex
+	writer                  PacketWriter
+	metadata                deliver.Metadata
+	onceClose               sync.Once
+	chSourceCompletePromise chan error
+}
+
+func NewFrameDestination(ctx context.Context, logger *logrus.Entry) *FrameDestination {
+	if logger == nil {
+		logger = logrus.WithField("obj", "rtsp-frame-destination")
+	} else {
+		logger = logger.WithField("obj", "rtsp-frame-destination")
+	}
+
+	fd := &FrameDestination{
+		chSourceCompletePromise: make(chan error, 1),
+		logger:                  logger,
+	}
+
+	fd.ctx, fd.cancel = context.WithCancel(ctx)
+
+	fd.FrameDestination = deliver.NewFrameDestinationImpl(fd.ctx, deliver.FormatSettings{
+		PacketType: deliver.PacketTypeRtp,
+	})
+
+	return fd
+}
+
+func (fd *FrameDestination) OnSource(src deliver.FrameSource) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			fd.logger.WithError(err).Error("OnSource panic")
+		}
+
+		fd.chSourceCompletePromise <- err
+	}()
+
+	fd.lock.Lock()
+	fd.metadata = *src.Metadata()
+	fd.lock.Unlock()
+
+	return fd.FrameDestination.OnSource(src)
+}
+
+func (fd *FrameDestination) SourceCompletePromise() <-chan error {
+	return fd.chSourceCompletePromise
+}
+
+// SessionDescription describes the source for a DESCRIBE answer.
+func (fd *FrameDestination) SessionDescription() (string, error) {
+	fd.lock.RLock()
+	metadata := fd.metadata
+	fd.lock.RUnlock()
+
+	if !metadata.HasAudio() && !metadata.HasVideo() {
+		return "", errors.New("source has no media")
+	}
+
+	return NewSessionDescription(metadata)
+}
+
+// Play starts writing the frames to the client, a keyframe is requested
+// so that it can start decoding at once.
+func (fd *FrameDestination) Play(writer PacketWriter) {
+	fd.lock.Lock()
+	fd.writer = writer
+	fd.lock.Unlock()
+
+	fd.RequestKeyFrame()
+}
+
+// RequestKeyFrame asks the source for a keyframe, it does nothing if the
+// source has no video.
+func (fd *FrameDestination) RequestKeyFrame() {
+	fd.lock.RLock()
+	hasVideo := fd.metadata.HasVideo()
+	fd.lock.RUnlock()
+
+	if hasVideo {
+		fd.DeliverFeedback(deliver.FeedbackMsg{
+			Type: deliver.FeedbackTypeVideo,
+			Cmd:  deliver.FeedbackCmdPLI,
+		})
+	}
+}
+
+func (fd *FrameDestination) Pause() {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+	fd.writer = nil
+}
+
+func (fd *FrameDestination) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	defer func() {
+		if r := recover(); r != nil {
+			fd.logger.WithField("error", r).Error("OnFrame panic")
+		}
+	}()
+
+	if frame.PacketType != deliver.PacketTypeRtp {
+		return
+	}
+
+	packet, ok := frame.RawPacket.(*rtp.Packet)
+	if !ok {
+		fd.logger.WithField("packet", frame.RawPacket).Error("invalid packet")
+		return
+	}
+
+	fd.lock.RLock()
+	writer := fd.writer
+	metadata := fd.metadata
+	fd.lock.RUnlock()
+
+	if writer == nil {
+		return
+	}
+
+	var kind proto_rtsp.TrackKind
+	var payloadType uint8
+	if frame.Codec.IsAudio() && metadata.HasAudio() {
+		kind, payloadType = proto_rtsp.TrackKindAudio, metadata.Audio.RtpPayloadType
+	} else if frame.Codec.IsVideo() && metadata.HasVideo() {
+		kind, payloadType = proto_rtsp.TrackKindVideo, metadata.Video.RtpPayloadType
+	} else {
+		return
+	}
+
+	// the packet is shared by every destination, rewrite a copy of the
+	// header only, extensions negotiated by WebRTC mean nothing here.
+	out := *packet
+	out.PayloadType = payloadType
+	out.Extension = false
+	out.Extensions = nil
+	out.Padding = false
+	out.PaddingSize = 0
+
+	buf, err := out.Marshal()
+	if err != nil {
+		fd.logger.WithError(err).Error("failed to marshal rtp packet")
+		return
+	}
+
+	if err := writer.WriteRTP(kind, buf); err != nil && !errors.Is(err, proto_rtsp.ErrNotPlaying) {
+		fd.logger.WithError(err).Debug("failed to write rtp packet")
+	}
+}
+
+func (fd *FrameDestination) close() {
+	fd.onceClose.Do(func() {
+		fd.cancel()
+		fd.FrameDestination.Close()
+		fd.logger.Debug("FrameDestination closed")
+	})
+}
+
+func (fd *FrameDestination) Close() {
+	fd.close()
+}
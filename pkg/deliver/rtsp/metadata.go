@@ -0,0 +1,57 @@
+package rtsp
+
+import (
+	"strings"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	proto_rtsp "github.com/pingostack/neon/protocols/rtsp"
+)
+
+func convCodecType(codec string) deliver.CodecType {
+	switch strings.ToUpper(codec) {
+	case "MPEG4-GENERIC", "MP4A-LATM":
+		return deliver.CodecTypeAAC
+	}
+
+	return deliver.ConvCodecType(codec)
+}
+
+func convAudioMetadata(track *proto_rtsp.TrackRemote) *deliver.AudioMetadata {
+	if track == nil {
+		return nil
+	}
+
+	channels := track.Channels
+	if channels == 0 {
+		channels = 1
+	}
+
+	return &deliver.AudioMetadata{
+		Codec:          track.Codec,
+		CodecType:      convCodecType(track.Codec),
+		RtpPayloadType: track.PayloadType,
+		SampleRate:     track.ClockRate,
+		Channels:       channels,
+	}
+}
+
+func convVideoMetadata(track *proto_rtsp.TrackRemote) *deliver.VideoMetadata {
+	if track == nil {
+		return nil
+	}
+
+	return &deliver.VideoMetadata{
+		Codec:          track.Codec,
+		CodecType:      convCodecType(track.Codec),
+		RtpPayloadType: track.PayloadType,
+		ClockRate:      track.ClockRate,
+	}
+}
+
+func convMetadata(audio, video *proto_rtsp.TrackRemote) deliver.Metadata {
+	return deliver.Metadata{
+		Audio:      convAudioMetadata(audio),
+		Video:      convVideoMetadata(video),
+		PacketType: deliver.PacketTypeRtp,
+	}
+}
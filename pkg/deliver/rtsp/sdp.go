@@ -0,0 +1,77 @@
+package rtsp
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pion/sdp/v3"
+)
+
+// NewSessionDescription builds the SDP of a DESCRIBE answer, one media
+// per track with a trackID control relative to the request url.
+func NewSessionDescription(metadata deliver.Metadata) (string, error) {
+	sd := sdp.SessionDescription{
+		Origin: sdp.Origin{
+			Username:       "-",
+			SessionID:      0,
+			SessionVersion: 0,
+			NetworkType:    "IN",
+			AddressType:    "IP4",
+			UnicastAddress: "0.0.0.0",
+		},
+		SessionName: "Neon",
+		ConnectionInformation: &sdp.ConnectionInformation{
+			NetworkType: "IN",
+			AddressType: "IP4",
+			Address:     &sdp.Address{Address: "0.0.0.0"},
+		},
+		TimeDescriptions: []sdp.TimeDescription{{}},
+		Attributes: []sdp.Attribute{
+			{Key: "control", Value: "*"},
+		},
+	}
+
+	trackID := 0
+	if metadata.HasVideo() {
+		v := metadata.Video
+		md := newMediaDescription("video", v.RtpPayloadType, trackID)
+		md.WithValueAttribute("rtpmap", fmt.Sprintf("%d %s/%d", v.RtpPayloadType, v.Codec, v.ClockRate))
+		if v.CodecType == deliver.CodecTypeH264 {
+			md.WithValueAttribute("fmtp", fmt.Sprintf("%d packetization-mode=1", v.RtpPayloadType))
+		}
+		sd.MediaDescriptions = append(sd.MediaDescriptions, md)
+		trackID++
+	}
+
+	if metadata.HasAudio() {
+		a := metadata.Audio
+		md := newMediaDescription("audio", a.RtpPayloadType, trackID)
+		rtpmap := fmt.Sprintf("%d %s/%d", a.RtpPayloadType, a.Codec, a.SampleRate)
+		if a.Channels > 1 {
+			rtpmap += "/" + strconv.Itoa(int(a.Channels))
+		}
+		md.WithValueAttribute("rtpmap", rtpmap)
+		sd.MediaDescriptions = append(sd.MediaDescriptions, md)
+	}
+
+	buf, err := sd.Marshal()
+	if err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+func newMediaDescription(media string, payloadType uint8, trackID int) *sdp.MediaDescription {
+	md := &sdp.MediaDescription{
+		MediaName: sdp.MediaName{
+			Media:   media,
+			Port:    sdp.RangedPort{Value: 0},
+			Protos:  []string{"RTP", "AVP"},
+			Formats: []string{strconv.Itoa(int(payloadType))},
+		},
+	}
+
+	return md.WithValueAttribute("control", "trackID="+strconv.Itoa(trackID))
+}
@@ -0,0 +1,108 @@
+package rtsp
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	proto_rtsp "github.com/pingostack/neon/protocols/rtsp"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrNoPacket fails a pull whose stream sent nothing after its PLAY.
+var ErrNoPacket = errors.New("rtsp pull received no packet")
+
+// PullSession relays a remote RTSP stream, typically an IP camera, as the
+// producer of a router.
+type PullSession struct {
+	router.Session
+	pm     router.PeerParams
+	ctx    context.Context
+	logger *logrus.Entry
+	opts   proto_rtsp.CliSessionOptions
+	src    *FrameSource
+}
+
+func NewPullSession(ctx context.Context, opts proto_rtsp.CliSessionOptions, pm router.PeerParams, logger *logrus.Entry) *PullSession {
+	if logger == nil {
+		logger = logrus.NewEntry(logrus.StandardLogger())
+	}
+
+	s := &PullSession{
+		ctx:  ctx,
+		pm:   pm,
+		opts: opts,
+		logger: logger.WithFields(logrus.Fields{
+			"session-type": "rtsp-pull-session",
+			"url":          opts.Url,
+		}),
+	}
+
+	return s
+}
+
+// Pull joins the router once the stream flows, its PLAY succeeded and its
+// first packet arrived within timeout. A server may accept the PLAY of a
+// stream it does not deliver.
+func (s *PullSession) Pull(timeout time.Duration) error {
+	logger := s.logger
+	deadline := time.Now().Add(timeout)
+
+	src, err := NewFrameSource(s.ctx, s.opts, logger)
+	if err != nil {
+		logger.WithError(err).Error("failed to create frame source")
+		return errors.Wrap(err, "failed to create frame source")
+	}
+
+	err = src.Start(timeout)
+	if err != nil {
+		logger.WithError(err).Error("failed to start frame source")
+		return errors.Wrap(err, "failed to start frame source")
+	}
+
+	select {
+	case <-src.Flowing():
+	case <-src.Context().Done():
+		return errors.Wrap(proto_rtsp.ErrCliSessionClosed, "frame source closed before its first packet")
+	case <-time.After(time.Until(deadline)):
+		src.Close()
+		logger.Error("no packet received")
+		return ErrNoPacket
+	}
+
+	logger.WithField("metadata", src.Metadata().String()).Debug("frame source metadata")
+
+	s.pm.Producer = true
+	s.pm.HasAudio = src.Metadata().HasAudio()
+	s.pm.HasVideo = src.Metadata().HasVideo()
+	s.pm.HasDataChannel = false
+
+	s.Session = core.NewSession(s.ctx, s.pm, logger)
+	session := s.Session
+
+	err = session.BindFrameSource(src)
+	if err != nil {
+		src.Close()
+		logger.WithError(err).Error("failed to bind frame source")
+		return errors.Wrap(err, "failed to bind frame source")
+	}
+
+	err = session.Join()
+	if err != nil {
+		src.Close()
+		logger.WithError(err).Error("join failed")
+		return errors.Wrap(err, "join failed")
+	}
+
+	s.src = src
+
+	return nil
+}
+
+func (s *PullSession) Close() {
+	if s.src != nil {
+		s.src.Close()
+	}
+}
@@ -0,0 +1,234 @@
+package rtsp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	proto_rtsp "github.com/pingostack/neon/protocols/rtsp"
+	"github.com/pion/rtp"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type FrameSource struct {
+	deliver.FrameSource
+	ctx        context.Context
+	cancel     context.CancelFunc
+	cli        *proto_rtsp.CliSession
+	logger     *logrus.Entry
+	lock       sync.RWMutex
+	metadata   deliver.Metadata
+	audioTrack *proto_rtsp.TrackRemote
+	videoTrack *proto_rtsp.TrackRemote
+	chReady    chan struct{}
+	onceReady  sync.Once
+	chFlowing  chan struct{}
+	onceFlow   sync.Once
+	onceClose  sync.Once
+}
+
+func newFrameSource(ctx context.Context, logger *logrus.Entry) *FrameSource {
+	if logger == nil {
+		logger = logrus.WithField("obj", "rtsp-frame-source")
+	} else {
+		logger = logger.WithField("obj", "rtsp-frame-source")
+	}
+
+	fs := &FrameSource{
+		logger:    logger,
+		chReady:   make(chan struct{}),
+		chFlowing: make(chan struct{}),
+	}
+
+	fs.ctx, fs.cancel = context.WithCancel(ctx)
+
+	fs.FrameSource = deliver.NewFrameSourceImpl(fs.ctx, deliver.Metadata{
+		PacketType: deliver.PacketTypeRtp,
+	})
+
+	return fs
+}
+
+// NewFrameSource pulls the stream of an RTSP server.
+func NewFrameSource(ctx context.Context, opts proto_rtsp.CliSessionOptions, logger *logrus.Entry) (fs *FrameSource, err error) {
+	fs = newFrameSource(ctx, logger)
+
+	opts.Listener = fs
+	if opts.Logger == nil {
+		opts.Logger = logger
+	}
+
+	fs.cli, err = proto_rtsp.NewCliSession(fs.ctx, opts)
+	if err != nil {
+		fs.cancel()
+		return nil, errors.Wrap(err, "failed to create rtsp client session")
+	}
+
+	return fs, nil
+}
+
+// NewRecordFrameSource delivers the tracks announced by a client
+// publishing to the RTSP server.
+func NewRecordFrameSource(ctx context.Context, tracks []*proto_rtsp.TrackRemote, logger *logrus.Entry) (*FrameSource, error) {
+	fs := newFrameSource(ctx, logger)
+	if err := fs.OnTracksReady(tracks); err != nil {
+		fs.close()
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+// Start pulls the stream in background and waits for the first
+// successful PLAY, the tracks are known once it returns. It returns the
+// error of the last attempt when the PLAY does not succeed in time.
+func (fs *FrameSource) Start(timeout time.Duration) error {
+	if fs.cli == nil {
+		return nil
+	}
+
+	fs.cli.Start()
+
+	go func() {
+		<-fs.cli.Context().Done()
+		if err := fs.cli.Err(); err != nil {
+			fs.logger.WithError(err).Error("rtsp pull failed")
+		}
+		fs.close()
+	}()
+
+	select {
+	case <-fs.chReady:
+		return nil
+	case <-fs.ctx.Done():
+		if err := fs.cli.Err(); err != nil {
+			return err
+		}
+		return proto_rtsp.ErrCliSessionClosed
+	case <-time.After(timeout):
+		fs.close()
+		if err := fs.cli.Err(); err != nil {
+			return errors.Wrapf(err, "rtsp pull %s timeout", fs.cli.Url())
+		}
+		return fmt.Errorf("rtsp pull %s timeout", fs.cli.Url())
+	}
+}
+
+func (fs *FrameSource) OnTrackRemote(track *proto_rtsp.TrackRemote) error {
+	codec := convCodecType(track.Codec)
+	if (track.IsAudio() && !codec.IsAudio()) || (track.IsVideo() && !codec.IsVideo()) {
+		return fmt.Errorf("codec %s not supported", track.Codec)
+	}
+
+	return nil
+}
+
+func (fs *FrameSource) OnTransport(t *proto_rtsp.Transport) error {
+	fs.logger.WithField("transport", t.String()).Debug("rtsp transport")
+	return nil
+}
+
+func (fs *FrameSource) OnTracksReady(tracks []*proto_rtsp.TrackRemote) error {
+	var audioTrack, videoTrack *proto_rtsp.TrackRemote
+	for _, track := range tracks {
+		if track.IsAudio() && audioTrack == nil {
+			audioTrack = track
+		} else if track.IsVideo() && videoTrack == nil {
+			videoTrack = track
+		}
+	}
+
+	metadata := convMetadata(audioTrack, videoTrack)
+
+	fs.lock.Lock()
+	changed := fs.metadata.String() != metadata.String()
+	fs.metadata = metadata
+	fs.audioTrack = audioTrack
+	fs.videoTrack = videoTrack
+	fs.lock.Unlock()
+
+	if audioTrack != nil {
+		codec := metadata.Audio.CodecType
+		sampleRate := metadata.Audio.SampleRate
+		audioTrack.OnRTP(func(pkt *rtp.Packet) {
+			fs.deliverRTP(pkt, codec, &deliver.AudioFrameSpecificInfo{
+				SampleRate: sampleRate,
+			})
+		})
+	}
+
+	if videoTrack != nil {
+		codec := metadata.Video.CodecType
+		videoTrack.OnRTP(func(pkt *rtp.Packet) {
+			fs.deliverRTP(pkt, codec, &deliver.VideoFrameSpecificInfo{})
+		})
+	}
+
+	if changed {
+		fs.logger.WithField("metadata", metadata.String()).Info("rtsp metadata")
+		if err := fs.FrameSource.DeliverMetaData(metadata); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OnPlay makes Start return, the media flows.
+func (fs *FrameSource) OnPlay() {
+	fs.onceReady.Do(func() {
+		close(fs.chReady)
+	})
+}
+
+func (fs *FrameSource) deliverRTP(pkt *rtp.Packet, codec deliver.CodecType, additionalInfo deliver.FrameSpecificInfo) {
+	frame := deliver.Frame{
+		Codec:          codec,
+		PacketType:     deliver.PacketTypeRtp,
+		Length:         len(pkt.Payload),
+		TimeStamp:      pkt.Timestamp,
+		AdditionalInfo: additionalInfo,
+		RawPacket:      pkt,
+	}
+
+	fs.onceFlow.Do(func() {
+		close(fs.chFlowing)
+	})
+
+	fs.DeliverFrame(frame, nil)
+}
+
+// Flowing is closed with the first packet of the stream.
+func (fs *FrameSource) Flowing() <-chan struct{} {
+	return fs.chFlowing
+}
+
+func (fs *FrameSource) Metadata() *deliver.Metadata {
+	fs.lock.RLock()
+	defer fs.lock.RUnlock()
+
+	md := fs.metadata
+	return &md
+}
+
+// OnFeedback is a no-op, RTSP gives no way to request a keyframe.
+func (fs *FrameSource) OnFeedback(feedback deliver.FeedbackMsg) {
+}
+
+func (fs *FrameSource) close() {
+	fs.onceClose.Do(func() {
+		fs.cancel()
+		if fs.cli != nil {
+			fs.cli.Close()
+		}
+		fs.FrameSource.Close()
+		fs.logger.Debug("FrameSource closed")
+	})
+}
+
+func (fs *FrameSource) Close() {
+	fs.close()
+}
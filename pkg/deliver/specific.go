@@ -296,12 +296,23 @@ func (md *Metadata) FormatName() string {
 }
 
 func (md *Metadata) ToFormatSettings() FormatSettings {
-	return FormatSettings{
-		AudioCandidates: []AudioMetadata{*md.Audio},
-		VideoCandidates: []VideoMetadata{*md.Video},
-		DataCandidates:  []DataMetadata{*md.Data},
-		PacketType:      md.PacketType,
+	settings := FormatSettings{
+		PacketType: md.PacketType,
 	}
+
+	if md.Audio != nil {
+		settings.AudioCandidates = []AudioMetadata{*md.Audio}
+	}
+
+	if md.Video != nil {
+		settings.VideoCandidates = []VideoMetadata{*md.Video}
+	}
+
+	if md.Data != nil {
+		settings.DataCandidates = []DataMetadata{*md.Data}
+	}
+
+	return settings
 }
 
 type FeedbackType int
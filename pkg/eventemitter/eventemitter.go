@@ -6,17 +6,81 @@ import (
 	"sync"
 
 	"github.com/pingostack/neon/pkg/logger"
+	"github.com/pingostack/neon/pkg/metrics"
 	"github.com/pkg/errors"
 	"go.uber.org/atomic"
 )
 
 type eventID int
 
+// EventID names the id type of events in other packages.
+type EventID = eventID
+
 type eventFunc func(data interface{}) error
 
+var (
+	ErrQueueFull = errors.New("event queue full")
+	ErrClosed    = errors.New("event emitter closed")
+)
+
+// Dispatch is how the listeners of an event are called.
+type Dispatch int
+
+const (
+	// DispatchAsync queues the event, the listeners are called one event
+	// at a time by the goroutine of the emitter.
+	DispatchAsync Dispatch = iota
+	// DispatchSync calls the listeners in the goroutine emitting the
+	// event, EmitEvent returns the first error of a listener.
+	DispatchSync
+)
+
+func (d Dispatch) String() string {
+	if d == DispatchSync {
+		return "sync"
+	}
+
+	return "async"
+}
+
+// OverflowPolicy is what EmitEvent does with an asynchronous event when
+// the queue of the emitter is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDrop drops the event and returns ErrQueueFull.
+	OverflowDrop OverflowPolicy = iota
+	// OverflowBlock waits for the queue to have room, a listener must not
+	// emit such an event on its own emitter.
+	OverflowBlock
+	// OverflowUnbounded queues the event past the size of the queue, for
+	// the events that must not be lost.
+	OverflowUnbounded
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowUnbounded:
+		return "unbounded"
+	}
+
+	return "drop"
+}
+
+// EventOptions are the options of an event id, see SetEventOptions.
+type EventOptions struct {
+	Dispatch Dispatch
+	Overflow OverflowPolicy
+}
+
 type EventEmitter interface {
 	AddEvent(eventID eventID, f eventFunc)
 	EmitEvent(eventID eventID, data interface{}) error
+	// On adds a listener like AddEvent and returns its handle.
+	On(eventID eventID, f eventFunc) *Listener
+	SetEventOptions(eventID eventID, opts EventOptions)
 }
 
 type Event struct {
@@ -28,10 +92,43 @@ func (e Event) String() string {
 	return fmt.Sprintf("{eventID: %d, data: %+v}", e.Signal, e.Data)
 }
 
+// Listener is the handle of a listener, removing it stops the calls
+// including those of the events already queued.
+type Listener struct {
+	m       *EventEmitterImpl
+	eventID eventID
+	f       eventFunc
+	removed atomic.Bool
+}
+
+func (l *Listener) Remove() {
+	if l.removed.Swap(true) {
+		return
+	}
+
+	l.m.removeListener(l)
+}
+
+type EventEmitterOpt func(m *EventEmitterImpl)
+
+// WithOverflowPolicy sets the policy of the events without options, drop
+// by default.
+func WithOverflowPolicy(p OverflowPolicy) EventEmitterOpt {
+	return func(m *EventEmitterImpl) {
+		m.overflow = p
+	}
+}
+
 type EventEmitterImpl struct {
 	oneventLock sync.RWMutex
-	eventCh     chan Event
-	listeners   map[eventID][]eventFunc
+	listeners   map[eventID][]*Listener
+	options     map[eventID]EventOptions
+	overflow    OverflowPolicy
+	queueLock   sync.Mutex
+	queueCond   *sync.Cond
+	queue       []Event
+	size        int
+	closed      bool
 	logger      logger.Logger
 	ctx         context.Context
 	cancel      context.CancelFunc
@@ -45,46 +142,93 @@ func GenEventID() eventID {
 	return eventID(signalCounter.Inc())
 }
 
-func NewEventEmitter(ctx context.Context, size int, logger logger.Logger) EventEmitter {
+func NewEventEmitter(ctx context.Context, size int, logger logger.Logger, opts ...EventEmitterOpt) EventEmitter {
 	m := &EventEmitterImpl{
-		eventCh:   make(chan Event, size),
-		listeners: make(map[eventID][]eventFunc),
+		listeners: make(map[eventID][]*Listener),
+		options:   make(map[eventID]EventOptions),
+		size:      size,
 		logger:    logger,
 	}
 
+	m.queueCond = sync.NewCond(&m.queueLock)
 	m.ctx, m.cancel = context.WithCancel(ctx)
 
+	for _, opt := range opts {
+		opt(m)
+	}
+
 	go m.run()
 
 	return m
 }
 
+// SetEventOptions sets how the events of eventID are dispatched and what
+// is done with them when the queue is full.
+func (m *EventEmitterImpl) SetEventOptions(eventID eventID, opts EventOptions) {
+	m.oneventLock.Lock()
+	defer m.oneventLock.Unlock()
+
+	m.options[eventID] = opts
+}
+
+func (m *EventEmitterImpl) eventOptions(eventID eventID) EventOptions {
+	m.oneventLock.RLock()
+	defer m.oneventLock.RUnlock()
+
+	opts, found := m.options[eventID]
+	if !found {
+		opts.Overflow = m.overflow
+	}
+
+	return opts
+}
+
 func (m *EventEmitterImpl) EmitEvent(eventID eventID, data interface{}) error {
-	defer func() {
-		if r := recover(); r != nil {
-			if m.logger != nil {
-				m.logger.Errorf("EventEmitter panic: %v", r)
-			}
-		}
-	}()
+	opts := m.eventOptions(eventID)
+	metrics.EventsEmitted.WithLabelValues(opts.Dispatch.String()).Inc()
+
+	if opts.Dispatch == DispatchSync {
+		return m.SyncEmitEvent(eventID, data)
+	}
 
 	e := Event{
 		Signal: eventID,
 		Data:   data,
 	}
 
-	select {
-	case m.eventCh <- e:
-	default:
-		if m.logger != nil {
-			m.logger.Warnf("Event queue full, Event: %s", e)
+	m.queueLock.Lock()
+	defer m.queueLock.Unlock()
+
+	if len(m.queue) >= m.size && !m.closed {
+		metrics.EventQueueOverflows.WithLabelValues(opts.Overflow.String()).Inc()
+
+		switch opts.Overflow {
+		case OverflowBlock:
+			for len(m.queue) >= m.size && !m.closed {
+				m.queueCond.Wait()
+			}
+		case OverflowUnbounded:
+		default:
+			if m.logger != nil {
+				m.logger.Warnf("Event queue full, Event: %s", e)
+			}
+			return ErrQueueFull
 		}
-		return fmt.Errorf("Event queue full")
 	}
 
+	if m.closed {
+		return ErrClosed
+	}
+
+	m.queue = append(m.queue, e)
+	metrics.EventQueueLength.Inc()
+	m.queueCond.Broadcast()
+
 	return nil
 }
 
+// SyncEmitEvent calls the listeners of eventID in the calling goroutine,
+// whatever the options of the event, and stops at the first error.
 func (m *EventEmitterImpl) SyncEmitEvent(eventID eventID, data interface{}) error {
 	m.oneventLock.RLock()
 	listeners, found := m.listeners[eventID]
@@ -94,8 +238,8 @@ func (m *EventEmitterImpl) SyncEmitEvent(eventID eventID, data interface{}) erro
 		return nil
 	}
 
-	for _, f := range listeners {
-		if err := f(data); err != nil {
+	for _, l := range listeners {
+		if err := m.call(l, data); err != nil {
 			return errors.Wrap(err, "SyncEmitEvent")
 		}
 	}
@@ -103,57 +247,137 @@ func (m *EventEmitterImpl) SyncEmitEvent(eventID eventID, data interface{}) erro
 	return nil
 }
 
+// call runs a listener, a panic is logged and does not reach the other
+// listeners or the emitter.
+func (m *EventEmitterImpl) call(l *Listener, data interface{}) (err error) {
+	if l.removed.Load() {
+		return nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			metrics.EventListenerPanics.Inc()
+			if m.logger != nil {
+				m.logger.Errorf("EventEmitter listener of event %d panic: %v", l.eventID, r)
+			}
+		}
+	}()
+
+	return l.f(data)
+}
+
+func (m *EventEmitterImpl) next() (Event, bool) {
+	m.queueLock.Lock()
+	defer m.queueLock.Unlock()
+
+	for len(m.queue) == 0 && !m.closed {
+		m.queueCond.Wait()
+	}
+
+	if m.closed {
+		return Event{}, false
+	}
+
+	e := m.queue[0]
+	m.queue[0] = Event{}
+	m.queue = m.queue[1:]
+	if len(m.queue) == 0 {
+		m.queue = nil
+	}
+	metrics.EventQueueLength.Dec()
+	m.queueCond.Broadcast()
+
+	return e, true
+}
+
 func (m *EventEmitterImpl) run() {
+	go func() {
+		<-m.ctx.Done()
+
+		m.queueLock.Lock()
+		m.closed = true
+		metrics.EventQueueLength.Sub(float64(len(m.queue)))
+		m.queue = nil
+		m.queueCond.Broadcast()
+		m.queueLock.Unlock()
+	}()
+
 	defer func() {
 		if m.logger != nil {
 			m.logger.Debug("EventEmitter stopped")
 		}
-		close(m.eventCh)
 	}()
 
 	for {
-		select {
-		case <-m.ctx.Done():
+		e, ok := m.next()
+		if !ok {
 			return
+		}
 
-		case e, ok := <-m.eventCh:
-			if !ok {
-				return
-			}
-
-			m.oneventLock.RLock()
-			listeners, found := m.listeners[e.Signal]
-			m.oneventLock.RUnlock()
+		m.oneventLock.RLock()
+		listeners, found := m.listeners[e.Signal]
+		m.oneventLock.RUnlock()
 
-			if !found {
-				continue
-			}
+		if !found {
+			continue
+		}
 
-			for _, f := range listeners {
-				f(e.Data)
-			}
+		for _, l := range listeners {
+			m.call(l, e.Data)
 		}
 	}
 }
 
 func (m *EventEmitterImpl) AddEvent(eventID eventID, f eventFunc) {
+	m.On(eventID, f)
+}
+
+func (m *EventEmitterImpl) On(eventID eventID, f eventFunc) *Listener {
+	l := &Listener{
+		m:       m,
+		eventID: eventID,
+		f:       f,
+	}
+
 	m.oneventLock.Lock()
 	defer m.oneventLock.Unlock()
 
-	listeners, found := m.listeners[eventID]
-	if !found {
-		listeners = make([]eventFunc, 0)
+	// the slices are copied on write, the emitting goroutines iterate
+	// over them without the lock
+	listeners := m.listeners[eventID]
+	m.listeners[eventID] = append(listeners[:len(listeners):len(listeners)], l)
+
+	return l
+}
+
+func (m *EventEmitterImpl) removeListener(l *Listener) {
+	m.oneventLock.Lock()
+	defer m.oneventLock.Unlock()
+
+	listeners := m.listeners[l.eventID]
+	kept := make([]*Listener, 0, len(listeners))
+	for _, other := range listeners {
+		if other != l {
+			kept = append(kept, other)
+		}
 	}
 
-	listeners = append(listeners, f)
+	if len(kept) == 0 {
+		delete(m.listeners, l.eventID)
+		return
+	}
 
-	m.listeners[eventID] = listeners
+	m.listeners[l.eventID] = kept
 }
 
 func (m *EventEmitterImpl) Remove(eventID eventID) {
 	m.oneventLock.Lock()
 	defer m.oneventLock.Unlock()
 
+	for _, l := range m.listeners[eventID] {
+		l.removed.Store(true)
+	}
+
 	delete(m.listeners, eventID)
 }
 
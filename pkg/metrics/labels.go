@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	LabelNamespace = "namespace"
+	LabelRouter    = "router"
+	LabelCodec     = "codec"
+
+	// OverflowValue replaces the values of a label past its limit.
+	OverflowValue = "other"
+
+	DefaultMaxLabelValues = 100
+)
+
+// DefaultLabels are the labels filled when none are configured.
+var DefaultLabels = []string{LabelNamespace, LabelRouter, LabelCodec}
+
+// labelValues bounds the values of one label, the values in use are
+// counted so that a value released by all its users frees its slot.
+type labelValues struct {
+	enabled bool
+	values  map[string]int
+}
+
+type labelSet struct {
+	lock      sync.Mutex
+	maxValues int
+	labels    map[string]*labelValues
+}
+
+var labels = newLabelSet(DefaultLabels, DefaultMaxLabelValues)
+
+func newLabelSet(enabled []string, maxValues int) *labelSet {
+	if maxValues <= 0 {
+		maxValues = DefaultMaxLabelValues
+	}
+
+	ls := &labelSet{
+		maxValues: maxValues,
+		labels:    make(map[string]*labelValues),
+	}
+
+	for _, name := range []string{LabelNamespace, LabelRouter, LabelCodec} {
+		ls.labels[name] = &labelValues{values: make(map[string]int)}
+	}
+
+	for _, name := range enabled {
+		if lv, ok := ls.labels[strings.ToLower(name)]; ok {
+			lv.enabled = true
+		}
+	}
+
+	return ls
+}
+
+// Configure sets the labels filled in and the number of values each may
+// take, a disabled label is left empty and the values past the limit are
+// reported as OverflowValue. It applies to the series created afterwards.
+func Configure(enabled []string, maxValues int) {
+	if len(enabled) == 0 {
+		enabled = DefaultLabels
+	}
+
+	ls := newLabelSet(enabled, maxValues)
+
+	labels.lock.Lock()
+	labels.maxValues = ls.maxValues
+	labels.labels = ls.labels
+	labels.lock.Unlock()
+}
+
+// acquire returns the value to report for a label, release must be
+// called with the same value once it is no longer used.
+func (ls *labelSet) acquire(name, value string) string {
+	return ls.lookup(name, value, true)
+}
+
+// lookup returns the value to report for a label, taking a reference on
+// it when ref is set.
+func (ls *labelSet) lookup(name, value string, ref bool) string {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+
+	lv := ls.labels[name]
+	if lv == nil || !lv.enabled {
+		return ""
+	}
+
+	n, ok := lv.values[value]
+	if !ok && len(lv.values) >= ls.maxValues {
+		return OverflowValue
+	}
+
+	if ref || !ok {
+		lv.values[value] = n + 1
+	}
+
+	return value
+}
+
+func (ls *labelSet) release(name, value string) {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+
+	lv := ls.labels[name]
+	if lv == nil {
+		return
+	}
+
+	if n, ok := lv.values[value]; ok {
+		if n <= 1 {
+			delete(lv.values, value)
+		} else {
+			lv.values[value] = n - 1
+		}
+	}
+}
+
+// Label returns the value to report for a label kept for the process
+// lifetime, such as the name of a namespace.
+func Label(name, value string) string {
+	return labels.lookup(name, value, false)
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "neon"
+
+// Registry holds every neon metric, it is what the metrics endpoint
+// serves.
+var Registry = prometheus.NewRegistry()
+
+var (
+	Frames = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "frames_total",
+		Help:      "Frames delivered by routers.",
+	}, []string{LabelNamespace, LabelRouter, LabelCodec})
+
+	FrameBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "frame_bytes_total",
+		Help:      "Bytes of the frames delivered by routers.",
+	}, []string{LabelNamespace, LabelRouter, LabelCodec})
+
+	FramesDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "frames_dropped_total",
+		Help:      "Frames received by routers and not delivered.",
+	}, []string{LabelNamespace, LabelRouter, LabelCodec})
+
+	ICEConnections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ice_connections_total",
+		Help:      "Outcomes of WebRTC connections: connected, failed_short or failed_long.",
+	}, []string{"outcome"})
+
+	ICEConnectSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ice_connect_seconds",
+		Help:      "Time from the start of ICE checks to the first connection.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 20},
+	})
+
+	RTCPFeedback = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rtcp_feedback_total",
+		Help:      "PLI, FIR, NACK, REMB and TMMBR packets received from subscribers or sent to publishers.",
+	}, []string{"type", "direction"})
+
+	EventsEmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_emitted_total",
+		Help:      "Events emitted by event emitters, by dispatch: sync or async.",
+	}, []string{"dispatch"})
+
+	EventQueueLength = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_queue_length",
+		Help:      "Events queued by the event emitters and not dispatched yet.",
+	})
+
+	EventQueueOverflows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_queue_overflows_total",
+		Help:      "Events emitted while an event emitter queue was full, by overflow policy: drop, block or unbounded.",
+	}, []string{"policy"})
+
+	EventListenerPanics = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_listener_panics_total",
+		Help:      "Panics recovered from event listeners.",
+	})
+)
+
+const (
+	OutcomeConnected   = "connected"
+	OutcomeFailedShort = "failed_short"
+	OutcomeFailedLong  = "failed_long"
+
+	FeedbackPLI   = "pli"
+	FeedbackFIR   = "fir"
+	FeedbackNACK  = "nack"
+	FeedbackREMB  = "remb"
+	FeedbackTMMBR = "tmmbr"
+
+	DirectionReceived = "received"
+	DirectionSent     = "sent"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Frames,
+		FrameBytes,
+		FramesDropped,
+		ICEConnections,
+		ICEConnectSeconds,
+		RTCPFeedback,
+		EventsEmitted,
+		EventQueueLength,
+		EventQueueOverflows,
+		EventListenerPanics,
+	)
+}
+
+// ICEConnected counts a connection that came up after connecting, zero
+// when the start of the checks is unknown.
+func ICEConnected(connecting time.Duration) {
+	ICEConnections.WithLabelValues(OutcomeConnected).Inc()
+	if connecting > 0 {
+		ICEConnectSeconds.Observe(connecting.Seconds())
+	}
+}
+
+// ICEFailed counts a failed connection, short ones failed before the
+// short connection threshold.
+func ICEFailed(short bool) {
+	if short {
+		ICEConnections.WithLabelValues(OutcomeFailedShort).Inc()
+	} else {
+		ICEConnections.WithLabelValues(OutcomeFailedLong).Inc()
+	}
+}
+
+func Feedback(kind, direction string) {
+	RTCPFeedback.WithLabelValues(kind, direction).Inc()
+}
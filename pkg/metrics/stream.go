@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pion/rtp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Stream counts the frames of a router by codec.
+type Stream struct {
+	namespace string
+	router    string
+	routerID  string
+	lock      sync.Mutex
+	codecs    map[deliver.CodecType]*streamCounters
+	closed    bool
+}
+
+type streamCounters struct {
+	codec   string
+	frames  prometheus.Counter
+	bytes   prometheus.Counter
+	dropped prometheus.Counter
+}
+
+func NewStream(namespace, routerID string) *Stream {
+	return &Stream{
+		namespace: Label(LabelNamespace, namespace),
+		router:    labels.acquire(LabelRouter, routerID),
+		routerID:  routerID,
+		codecs:    make(map[deliver.CodecType]*streamCounters),
+	}
+}
+
+func (s *Stream) counters(codec deliver.CodecType) *streamCounters {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if c, ok := s.codecs[codec]; ok {
+		return c
+	}
+
+	name := Label(LabelCodec, codec.String())
+	c := &streamCounters{
+		codec:   name,
+		frames:  Frames.WithLabelValues(s.namespace, s.router, name),
+		bytes:   FrameBytes.WithLabelValues(s.namespace, s.router, name),
+		dropped: FramesDropped.WithLabelValues(s.namespace, s.router, name),
+	}
+
+	if !s.closed {
+		s.codecs[codec] = c
+	}
+
+	return c
+}
+
+// FrameSize returns the size of a frame on the wire, the marshalled size
+// of an rtp packet or the length of the payload otherwise.
+func FrameSize(frame deliver.Frame) int {
+	if pkt, ok := frame.RawPacket.(*rtp.Packet); ok {
+		return pkt.MarshalSize()
+	}
+
+	if frame.Length > 0 {
+		return frame.Length
+	}
+
+	return len(frame.Payload)
+}
+
+func (s *Stream) OnFrame(frame deliver.Frame) {
+	c := s.counters(frame.Codec)
+	c.frames.Inc()
+	c.bytes.Add(float64(FrameSize(frame)))
+}
+
+func (s *Stream) OnDrop(frame deliver.Frame) {
+	s.counters(frame.Codec).dropped.Inc()
+}
+
+// Close removes the series of the router, unless they are shared with
+// other routers because the router label is disabled or overflowed.
+func (s *Stream) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+
+	if s.router == s.routerID {
+		for _, c := range s.codecs {
+			Frames.DeleteLabelValues(s.namespace, s.router, c.codec)
+			FrameBytes.DeleteLabelValues(s.namespace, s.router, c.codec)
+			FramesDropped.DeleteLabelValues(s.namespace, s.router, c.codec)
+		}
+		labels.release(LabelRouter, s.routerID)
+	}
+
+	s.codecs = nil
+}
@@ -16,4 +16,6 @@ var (
 	ErrNoRtxPayload    = errors.New("no rtx payload type found")
 	ErrNoCodecForPT    = errors.New("no codec for payload type")
 	ErrInvalidFmtp     = errors.New("invalid fmtp")
+
+	ErrICERestartUnsupported = errors.New("ICE restart unsupported")
 )
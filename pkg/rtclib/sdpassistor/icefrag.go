@@ -0,0 +1,138 @@
+package sdpassistor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingostack/neon/pkg/rtclib/rtcerror"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+	"github.com/pkg/errors"
+)
+
+// ICEFragment is a trickle-ice-sdpfrag body (RFC 8840), the ICE
+// credentials and candidates of a peer.
+type ICEFragment struct {
+	Ufrag           string
+	Pwd             string
+	Candidates      []webrtc.ICECandidateInit
+	EndOfCandidates bool
+}
+
+// ParseICEFragment parses a trickle-ice-sdpfrag, the candidates keep the
+// mid and index of their media section.
+func ParseICEFragment(frag string) (*ICEFragment, error) {
+	f := &ICEFragment{}
+	var (
+		mid   *string
+		index *uint16
+		media int
+	)
+
+	for _, line := range strings.Split(frag, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if len(line) < 2 || line[1] != '=' {
+			return nil, errors.Wrap(rtcerror.ErrSdpUnmarshal, fmt.Sprintf("invalid line %q", line))
+		}
+
+		if line[0] == 'm' {
+			i := uint16(media)
+			index, mid = &i, nil
+			media++
+			continue
+		}
+
+		if line[0] != 'a' {
+			continue
+		}
+
+		key, value, _ := strings.Cut(line[2:], ":")
+		switch key {
+		case "ice-ufrag":
+			if f.Ufrag == "" {
+				f.Ufrag = value
+			}
+		case "ice-pwd":
+			if f.Pwd == "" {
+				f.Pwd = value
+			}
+		case "mid":
+			m := value
+			mid = &m
+		case sdp.AttrKeyCandidate:
+			f.Candidates = append(f.Candidates, webrtc.ICECandidateInit{
+				Candidate:     "candidate:" + value,
+				SDPMid:        mid,
+				SDPMLineIndex: index,
+			})
+		case sdp.AttrKeyEndOfCandidates:
+			f.EndOfCandidates = true
+		}
+	}
+
+	if (f.Ufrag == "") != (f.Pwd == "") {
+		return nil, errors.Wrap(rtcerror.ErrSdpUnmarshal, "ice-ufrag and ice-pwd go together")
+	}
+
+	return f, nil
+}
+
+// MarshalICEFragment returns the trickle-ice-sdpfrag of a description,
+// the credentials and candidates of each of its media sections.
+func MarshalICEFragment(sd webrtc.SessionDescription) (string, error) {
+	parsed, err := sd.Unmarshal()
+	if err != nil {
+		return "", errors.Wrap(rtcerror.ErrSdpUnmarshal, err.Error())
+	}
+
+	var b strings.Builder
+	for _, attr := range parsed.Attributes {
+		switch attr.Key {
+		case "ice-lite", "ice-options", "ice-ufrag", "ice-pwd", "group":
+			b.WriteString("a=" + attr.String() + "\r\n")
+		}
+	}
+
+	for _, md := range parsed.MediaDescriptions {
+		b.WriteString("m=" + md.MediaName.String() + "\r\n")
+		for _, attr := range md.Attributes {
+			switch attr.Key {
+			case "mid", "ice-ufrag", "ice-pwd", sdp.AttrKeyCandidate, sdp.AttrKeyEndOfCandidates:
+				b.WriteString("a=" + attr.String() + "\r\n")
+			}
+		}
+	}
+
+	return b.String(), nil
+}
+
+// ReplaceICECredential sets the credentials of a description and removes
+// its candidates, what a remote peer restarting ICE sends.
+func ReplaceICECredential(parsed *sdp.SessionDescription, ufrag, pwd string) {
+	replace := func(attrs []sdp.Attribute) []sdp.Attribute {
+		var result []sdp.Attribute
+		for _, attr := range attrs {
+			switch attr.Key {
+			case "ice-ufrag":
+				attr.Value = ufrag
+			case "ice-pwd":
+				attr.Value = pwd
+			case sdp.AttrKeyCandidate, sdp.AttrKeyEndOfCandidates:
+				continue
+			}
+
+			result = append(result, attr)
+		}
+
+		return result
+	}
+
+	parsed.Attributes = replace(parsed.Attributes)
+	for _, md := range parsed.MediaDescriptions {
+		md.Attributes = replace(md.Attributes)
+	}
+}
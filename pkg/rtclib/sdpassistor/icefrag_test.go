@@ -0,0 +1,99 @@
+package sdpassistor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pingostack/neon/pkg/rtclib/rtcerror"
+	"github.com/pion/webrtc/v4"
+)
+
+const testFragment = "a=ice-ufrag:EsAw\r\n" +
+	"a=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1\r\n" +
+	"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+	"a=mid:0\r\n" +
+	"a=candidate:1 1 udp 2130706431 10.0.0.1 5000 typ host\r\n" +
+	"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+	"a=mid:1\r\n" +
+	"a=candidate:2 1 udp 2130706431 10.0.0.1 5002 typ host\r\n" +
+	"a=end-of-candidates\r\n"
+
+func TestParseICEFragment(t *testing.T) {
+	f, err := ParseICEFragment(testFragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Ufrag != "EsAw" || f.Pwd != "P2uYro0UCOQ4zxjKXaWCBui1" || !f.EndOfCandidates {
+		t.Errorf("fragment = %+v", f)
+	}
+
+	if len(f.Candidates) != 2 {
+		t.Fatalf("candidates = %d, want 2", len(f.Candidates))
+	}
+
+	for i, c := range f.Candidates {
+		if c.SDPMid == nil || *c.SDPMid != []string{"0", "1"}[i] {
+			t.Errorf("candidate %d mid = %v", i, c.SDPMid)
+		}
+
+		if c.SDPMLineIndex == nil || *c.SDPMLineIndex != uint16(i) {
+			t.Errorf("candidate %d index = %v, want %d", i, c.SDPMLineIndex, i)
+		}
+	}
+
+	if want := "candidate:2 1 udp 2130706431 10.0.0.1 5002 typ host"; f.Candidates[1].Candidate != want {
+		t.Errorf("candidate = %q, want %q", f.Candidates[1].Candidate, want)
+	}
+}
+
+func TestParseICEFragmentInvalid(t *testing.T) {
+	for name, frag := range map[string]string{
+		"bad line":   "a=ice-ufrag:EsAw\r\nnot a line\r\n",
+		"ufrag only": "a=ice-ufrag:EsAw\r\n",
+		"pwd only":   "a=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1\r\n",
+	} {
+		if _, err := ParseICEFragment(frag); !errors.Is(err, rtcerror.ErrSdpUnmarshal) {
+			t.Errorf("%s: err = %v, want %v", name, err, rtcerror.ErrSdpUnmarshal)
+		}
+	}
+}
+
+func TestMarshalICEFragment(t *testing.T) {
+	sd := webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP: "v=0\r\n" +
+			"o=- 1 2 IN IP4 127.0.0.1\r\n" +
+			"s=-\r\n" +
+			"t=0 0\r\n" +
+			"a=group:BUNDLE 0 1\r\n" +
+			"a=ice-ufrag:EsAw\r\n" +
+			"a=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1\r\n" +
+			"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+			"c=IN IP4 0.0.0.0\r\n" +
+			"a=mid:0\r\n" +
+			"a=rtpmap:111 opus/48000/2\r\n" +
+			"a=candidate:1 1 udp 2130706431 10.0.0.1 5000 typ host\r\n" +
+			"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+			"c=IN IP4 0.0.0.0\r\n" +
+			"a=mid:1\r\n" +
+			"a=rtpmap:96 VP8/90000\r\n" +
+			"a=candidate:2 1 udp 2130706431 10.0.0.1 5002 typ host\r\n" +
+			"a=end-of-candidates\r\n",
+	}
+
+	frag, err := MarshalICEFragment(sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "a=group:BUNDLE 0 1\r\n" + testFragment
+	if frag != want {
+		t.Fatalf("fragment = %q, want %q", frag, want)
+	}
+
+	f, err := ParseICEFragment(frag)
+	if err != nil || len(f.Candidates) != 2 || f.Ufrag != "EsAw" {
+		t.Errorf("parsed back = %+v, %v", f, err)
+	}
+}
@@ -0,0 +1,105 @@
+package rtclib
+
+import (
+	"encoding/binary"
+
+	"github.com/pion/rtcp"
+	"github.com/pkg/errors"
+)
+
+const (
+	formatTMMBR   uint8 = 3
+	tmmbrFCILen         = 8
+	tmmbrHeadLen        = 12
+	tmmbrMaxExp         = 63
+	tmmbrMantissa       = 17
+)
+
+var ErrTMMBRPacket = errors.New("invalid tmmbr packet")
+
+// TMMBREntry asks the sender of SSRC to send at most Bitrate bits per
+// second, Overhead is its per packet overhead in bytes.
+type TMMBREntry struct {
+	SSRC     uint32
+	Bitrate  uint64
+	Overhead uint16
+}
+
+// TMMBR is a Temporary Maximum Media Stream Bit Rate Request of RFC 5104,
+// pion/rtcp has no type for it.
+type TMMBR struct {
+	SenderSSRC uint32
+	Entries    []TMMBREntry
+}
+
+func (p *TMMBR) DestinationSSRC() []uint32 {
+	ssrcs := make([]uint32, 0, len(p.Entries))
+	for _, e := range p.Entries {
+		ssrcs = append(ssrcs, e.SSRC)
+	}
+
+	return ssrcs
+}
+
+func (p *TMMBR) MarshalSize() int {
+	return tmmbrHeadLen + tmmbrFCILen*len(p.Entries)
+}
+
+func (p *TMMBR) Marshal() ([]byte, error) {
+	size := p.MarshalSize()
+	h := rtcp.Header{
+		Count:  formatTMMBR,
+		Type:   rtcp.TypeTransportSpecificFeedback,
+		Length: uint16(size/4 - 1),
+	}
+
+	hb, err := h.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, size)
+	copy(buf, hb)
+	binary.BigEndian.PutUint32(buf[4:], p.SenderSSRC)
+	// the media ssrc is unused, the entries name the ssrcs
+
+	for i, e := range p.Entries {
+		mantissa, exp := e.Bitrate, uint64(0)
+		for mantissa >= 1<<tmmbrMantissa && exp < tmmbrMaxExp {
+			mantissa >>= 1
+			exp++
+		}
+
+		fci := buf[tmmbrHeadLen+i*tmmbrFCILen:]
+		binary.BigEndian.PutUint32(fci, e.SSRC)
+		binary.BigEndian.PutUint32(fci[4:], uint32(exp<<26|mantissa<<9|uint64(e.Overhead&0x1ff)))
+	}
+
+	return buf, nil
+}
+
+func (p *TMMBR) Unmarshal(rawPacket []byte) error {
+	var h rtcp.Header
+	if err := h.Unmarshal(rawPacket); err != nil {
+		return err
+	}
+
+	size := (int(h.Length) + 1) * 4
+	if h.Type != rtcp.TypeTransportSpecificFeedback || h.Count != formatTMMBR ||
+		size < tmmbrHeadLen || size > len(rawPacket) || (size-tmmbrHeadLen)%tmmbrFCILen != 0 {
+		return ErrTMMBRPacket
+	}
+
+	p.SenderSSRC = binary.BigEndian.Uint32(rawPacket[4:])
+	p.Entries = nil
+	for fci := rawPacket[tmmbrHeadLen:size]; len(fci) > 0; fci = fci[tmmbrFCILen:] {
+		v := binary.BigEndian.Uint32(fci[4:])
+		p.Entries = append(p.Entries, TMMBREntry{
+			SSRC:     binary.BigEndian.Uint32(fci),
+			Bitrate:  uint64(v>>9&(1<<tmmbrMantissa-1)) << (v >> 26),
+			Overhead: uint16(v & 0x1ff),
+		})
+	}
+
+	return nil
+}
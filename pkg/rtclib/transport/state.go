@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"time"
+)
+
+// CandidatePair is the ICE candidate pair carrying the media.
+type CandidatePair struct {
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+}
+
+// State is a snapshot of the transport, for diagnostics.
+type State struct {
+	ConnectionState    string         `json:"connectionState"`
+	ICEConnectionState string         `json:"iceConnectionState"`
+	ICEGatheringState  string         `json:"iceGatheringState"`
+	DTLSState          string         `json:"dtlsState"`
+	SelectedPair       *CandidatePair `json:"selectedPair,omitempty"`
+	PreferTCP          bool           `json:"preferTcp"`
+	ConnectedAt        *time.Time     `json:"connectedAt,omitempty"`
+	FirstConnectedAt   *time.Time     `json:"firstConnectedAt,omitempty"`
+}
+
+// TransportState returns the connection, ICE and DTLS states and the
+// selected candidate pair once connected.
+func (t *Transport) TransportState() State {
+	state := State{
+		ConnectionState:    t.PeerConnection.ConnectionState().String(),
+		ICEConnectionState: t.PeerConnection.ICEConnectionState().String(),
+		ICEGatheringState:  t.PeerConnection.ICEGatheringState().String(),
+		DTLSState:          "new",
+		PreferTCP:          t.preferTCP.Load(),
+	}
+
+	if sctp := t.PeerConnection.SCTP(); sctp != nil {
+		if dtls := sctp.Transport(); dtls != nil {
+			state.DTLSState = dtls.State().String()
+		}
+	}
+
+	if pair, err := t.getSelectedPair(); err == nil && pair != nil {
+		state.SelectedPair = &CandidatePair{
+			Local:  pair.Local.String(),
+			Remote: pair.Remote.String(),
+		}
+	}
+
+	t.lock.RLock()
+	if !t.connectedAt.IsZero() {
+		connectedAt := t.connectedAt
+		state.ConnectedAt = &connectedAt
+	}
+	if !t.firstConnectedAt.IsZero() {
+		firstConnectedAt := t.firstConnectedAt
+		state.FirstConnectedAt = &firstConnectedAt
+	}
+	t.lock.RUnlock()
+
+	return state
+}
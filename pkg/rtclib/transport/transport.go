@@ -12,6 +12,7 @@ import (
 	lksdp "github.com/livekit/protocol/sdp"
 	"github.com/pingostack/neon/pkg/eventemitter"
 	"github.com/pingostack/neon/pkg/logger"
+	"github.com/pingostack/neon/pkg/metrics"
 	"github.com/pingostack/neon/pkg/rtclib/config"
 	"github.com/pingostack/neon/pkg/rtclib/rtcerror"
 	"github.com/pingostack/neon/pkg/rtclib/sdpassistor"
@@ -90,6 +91,19 @@ func NewTransport(opts ...TransportOpt) (*Transport, error) {
 		return nil, errors.Wrap(err, "invalid transport")
 	}
 
+	// a candidate lost is a connection that may never come up, these
+	// events are queued whatever the length of the queue
+	for _, signal := range []eventemitter.EventID{
+		signalLocalICECandidate,
+		signalRemoteICECandidate,
+		signalICEGatheringComplete,
+		signalCloseTransport,
+	} {
+		t.eventemitter.SetEventOptions(signal, eventemitter.EventOptions{
+			Overflow: eventemitter.OverflowUnbounded,
+		})
+	}
+
 	t.eventemitter.AddEvent(signalLocalICECandidate, t.handleLocalICECandidate)
 	t.eventemitter.AddEvent(signalRemoteICECandidate, t.handleRemoteICECandidate)
 	t.eventemitter.AddEvent(signalICEGatheringComplete, t.handleICEGatheringComplete)
@@ -137,6 +151,7 @@ func NewTransport(opts ...TransportOpt) (*Transport, error) {
 			t.clearConnTimer()
 			first := t.setConnectedAt(time.Now())
 			if first {
+				metrics.ICEConnected(t.connectingDuration())
 				if t.onInitialConnected != nil {
 					t.onInitialConnected()
 				}
@@ -227,6 +242,19 @@ func (t *Transport) setConnectedAt(at time.Time) bool {
 	return true
 }
 
+// connectingDuration returns the time from the start of ICE checks to the
+// first connection, zero if either is unknown.
+func (t *Transport) connectingDuration() time.Duration {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.iceStartedAt.IsZero() || t.firstConnectedAt.IsZero() {
+		return 0
+	}
+
+	return t.firstConnectedAt.Sub(t.iceStartedAt)
+}
+
 func (t *Transport) handleConnectionFailed(forceShortConn bool) {
 	isShort := forceShortConn
 	if !isShort {
@@ -244,6 +272,8 @@ func (t *Transport) handleConnectionFailed(forceShortConn bool) {
 		t.logger.Infof("Force short connection detected")
 	}
 
+	metrics.ICEFailed(isShort)
+
 	if t.onFailed != nil {
 		t.onFailed(isShort)
 	}
@@ -479,6 +509,73 @@ func (t *Transport) UpdateICECredential(sdp *webrtc.SessionDescription) (bool, e
 	return resetICE, nil
 }
 
+// ICECredentialChanged tells if ufrag and pwd are not the credentials of
+// the last remote description, i.e. the remote peer restarts ICE.
+func (t *Transport) ICECredentialChanged(ufrag, pwd string) bool {
+	return t.currentOfferIceCredential != "" && t.currentOfferIceCredential != fmt.Sprintf("%s:%s", ufrag, pwd)
+}
+
+// AddRemoteCandidate adds a candidate trickled by the remote peer, it is
+// kept until the remote description is set.
+func (t *Transport) AddRemoteCandidate(c webrtc.ICECandidateInit) error {
+	return t.eventemitter.EmitEvent(signalRemoteICECandidate, &c)
+}
+
+// RestartICE restarts ICE with the new credentials of the remote peer
+// and returns the local description once its candidates are gathered. A
+// remote offer is set again with them and answered. When the local
+// description is the offer, e.g. a session offered by the server, a new
+// offer restarts ICE and the last answer is set again with them.
+func (t *Transport) RestartICE(ctx context.Context, ufrag, pwd string) (lsdp webrtc.SessionDescription, err error) {
+	rsdp := t.PeerConnection.RemoteDescription()
+	if rsdp == nil {
+		err = errors.Wrap(rtcerror.ErrICERestartUnsupported, "no remote description")
+		return
+	}
+
+	parsed, err := rsdp.Unmarshal()
+	if err != nil {
+		err = errors.Wrap(rtcerror.ErrSdpUnmarshal, err.Error())
+		return
+	}
+
+	sdpassistor.ReplaceICECredential(parsed, ufrag, pwd)
+	b, err := parsed.Marshal()
+	if err != nil {
+		err = errors.Wrap(err, "failed to marshal sdp")
+		return
+	}
+
+	t.logger.Infof("ICE restart by the remote peer")
+	t.ResetShortConnOnICERestart()
+	t.resetShortConn()
+
+	remote := webrtc.SessionDescription{
+		Type: rsdp.Type,
+		SDP:  string(b),
+	}
+
+	if rsdp.Type == webrtc.SDPTypeOffer {
+		if err = t.SetRemoteDescription(remote); err != nil {
+			return
+		}
+
+		if _, err = t.CreateAnswer(nil); err != nil {
+			return
+		}
+	} else {
+		if _, err = t.CreateOffer(&webrtc.OfferOptions{ICERestart: true}); err != nil {
+			return
+		}
+
+		if err = t.SetRemoteDescription(remote); err != nil {
+			return
+		}
+	}
+
+	return t.GatheringCompleteLocalSdp(ctx)
+}
+
 func (t *Transport) resetShortConn() {
 	t.lock.Lock()
 	defer t.lock.Unlock()
@@ -615,6 +712,8 @@ func (t *Transport) SetRemoteDescription(sd webrtc.SessionDescription) (err erro
 		return
 	}
 
+	t.UpdateICECredential(&sd)
+
 	t.remoteSdpSetted = true
 
 	return
@@ -713,8 +812,8 @@ func (t *Transport) RemoteSdpSetted() bool {
 }
 
 func (t *Transport) GatheringCompleteLocalSdp(ctx context.Context) (lsdp webrtc.SessionDescription, err error) {
-	if !t.localSdpSetted || !t.remoteSdpSetted {
-		err = errors.New("local or remote sdp not set")
+	if !t.localSdpSetted {
+		err = errors.New("local sdp not set")
 		return
 	}
 
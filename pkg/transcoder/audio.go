@@ -0,0 +1,228 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pion/rtp"
+)
+
+// maxPayloadSize bounds the payload of the output packets under the usual
+// MTU, an input packet may become several once upsampled to L16.
+const maxPayloadSize = 1200
+
+// AudioTranscoder converts PCMU, PCMA and L16 audio between each other,
+// resampling and remixing the channels on the way. Video and data frames
+// pass through.
+type AudioTranscoder struct {
+	deliver.MediaFramePipe
+	lock      sync.Mutex
+	opts      options
+	in        pcmFormat
+	out       pcmFormat
+	resampler *resampler
+	started   bool
+	lastInTs  uint32
+	outTs     uint32
+	// lastInSeq and outSeq number the output packets, the losses of the
+	// input stay visible
+	seqStarted bool
+	lastInSeq  uint16
+	outSeq     uint16
+}
+
+func NewAudioTranscoder(ctx context.Context, inCodec, outCodec deliver.CodecType, opts ...Option) (*AudioTranscoder, error) {
+	if !isPCMCodec(inCodec) || !isPCMCodec(outCodec) {
+		return nil, ErrTranscoderNotSupported
+	}
+
+	t := &AudioTranscoder{
+		MediaFramePipe: deliver.NewMediaFramePipe(ctx, deliver.FormatSettings{
+			PacketType: deliver.PacketTypeRtp,
+		}),
+		opts: newOptions(opts...),
+		in:   defaultPCMFormat(inCodec),
+		out:  defaultPCMFormat(outCodec),
+	}
+
+	if t.opts.sampleRate > 0 {
+		t.out.sampleRate = t.opts.sampleRate
+	}
+
+	if t.opts.channels > 0 {
+		t.out.channels = t.opts.channels
+	}
+
+	t.resampler = newResampler(t.in.sampleRate, t.out.sampleRate, t.out.channels)
+
+	return t, nil
+}
+
+func (t *AudioTranscoder) Label() string {
+	return fmt.Sprintf("%s/%d/%d->%s/%d/%d",
+		t.in.codec, t.in.sampleRate, t.in.channels,
+		t.out.codec, t.out.sampleRate, t.out.channels)
+}
+
+// OnMetaData takes the input layout from the source and announces the
+// output one downstream.
+func (t *AudioTranscoder) OnMetaData(metadata *deliver.Metadata) {
+	md := *metadata
+
+	t.lock.Lock()
+	// the audio of another codec passes through as its frames do
+	if md.Audio != nil && md.Audio.CodecType == t.in.codec {
+		in := t.in
+		if md.Audio.SampleRate > 0 {
+			in.sampleRate = int(md.Audio.SampleRate)
+		}
+		if md.Audio.Channels > 0 {
+			in.channels = int(md.Audio.Channels)
+		}
+
+		if in != t.in {
+			t.in = in
+			t.resampler = newResampler(t.in.sampleRate, t.out.sampleRate, t.out.channels)
+			t.started = false
+		}
+
+		md.Audio = &deliver.AudioMetadata{
+			Codec:          t.out.codecName(),
+			CodecType:      t.out.codec,
+			SampleRate:     uint32(t.out.sampleRate),
+			Channels:       uint8(t.out.channels),
+			RtpPayloadType: t.opts.payloadType(t.out.codec),
+		}
+	}
+	t.lock.Unlock()
+
+	t.MediaFramePipe.OnMetaData(&md)
+}
+
+func (t *AudioTranscoder) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	if frame.Codec != t.in.codec {
+		t.MediaFramePipe.OnFrame(frame, attr)
+		return
+	}
+
+	var payload []byte
+	var packet *rtp.Packet
+	switch frame.PacketType {
+	case deliver.PacketTypeRtp:
+		pkt, ok := frame.RawPacket.(*rtp.Packet)
+		if !ok {
+			return
+		}
+		packet, payload = pkt, pkt.Payload
+	case deliver.PacketTypeRaw:
+		payload = frame.Payload
+	default:
+		return
+	}
+
+	t.lock.Lock()
+	samples := t.in.decode(payload)
+	samples = remixChannels(samples, t.in.channels, t.out.channels)
+	samples = t.resampler.process(samples)
+	out := t.out
+	ts := t.timestamp(frame.TimeStamp)
+	payloadType := t.opts.payloadType(out.codec)
+
+	// the samples of a channel per output frame, a raw frame is not split
+	nbSamples := len(samples) / out.channels
+	perPacket := nbSamples
+	if packet != nil {
+		perPacket = maxPayloadSize / (out.sampleSize() * out.channels)
+	}
+
+	count := 0
+	if nbSamples > 0 {
+		count = (nbSamples + perPacket - 1) / perPacket
+	}
+
+	var seq uint16
+	if packet != nil {
+		seq = t.sequenceNumbers(packet.SequenceNumber, count)
+	}
+	t.lock.Unlock()
+
+	for i := 0; i < count; i++ {
+		chunk := samples[i*perPacket*out.channels:]
+		if len(chunk) > perPacket*out.channels {
+			chunk = chunk[:perPacket*out.channels]
+		}
+		chunkTs := ts + uint32(i*perPacket)
+		encoded := out.encode(chunk)
+
+		f := frame
+		f.Codec = out.codec
+		f.Payload = encoded
+		f.Length = len(encoded)
+		f.TimeStamp = chunkTs
+		f.AdditionalInfo = &deliver.AudioFrameSpecificInfo{
+			NbSamples:  uint32(len(chunk) / out.channels),
+			SampleRate: uint32(out.sampleRate),
+			Channels:   uint8(out.channels),
+		}
+
+		if packet != nil {
+			header := packet.Header
+			header.PayloadType = payloadType
+			header.SequenceNumber = seq + uint16(i)
+			header.Timestamp = chunkTs
+			header.Padding = false
+			// the marker starts a talkspurt, it stays on its first packet
+			header.Marker = packet.Marker && i == 0
+			f.RawPacket = &rtp.Packet{
+				Header:  header,
+				Payload: encoded,
+			}
+			f.Payload = nil
+		}
+
+		t.MediaFramePipe.OnFrame(f, attr)
+	}
+}
+
+// sequenceNumbers numbers the count packets made of an input one and
+// returns the first number, the numbers of the input packets lost before
+// it are skipped so that the loss shows downstream.
+func (t *AudioTranscoder) sequenceNumbers(seq uint16, count int) uint16 {
+	var lost uint16
+	if !t.seqStarted {
+		t.seqStarted = true
+		t.outSeq = seq - 1
+		t.lastInSeq = seq
+	} else if delta := seq - t.lastInSeq; delta > 0 && delta < 0x8000 {
+		lost = delta - 1
+		t.lastInSeq = seq
+	}
+
+	first := t.outSeq + lost + 1
+	t.outSeq += lost + uint16(count)
+
+	return first
+}
+
+// timestamp converts an input timestamp to the output clock, the delta
+// since the previous packet is scaled so gaps survive the conversion.
+func (t *AudioTranscoder) timestamp(ts uint32) uint32 {
+	if !t.started {
+		t.started = true
+		t.lastInTs = ts
+		t.outTs = uint32(uint64(ts) * uint64(t.out.sampleRate) / uint64(t.in.sampleRate))
+		return t.outTs
+	}
+
+	delta := int64(int32(ts - t.lastInTs))
+	t.lastInTs = ts
+	t.outTs += uint32(delta * int64(t.out.sampleRate) / int64(t.in.sampleRate))
+
+	return t.outTs
+}
+
+func (t *AudioTranscoder) Close() {
+	t.MediaFramePipe.Close()
+}
@@ -0,0 +1,92 @@
+package transcoder
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+// Chain runs transcoders one after the other, the frames enter the first
+// stage and leave through the pipe fed by the last one. Feedback goes
+// straight to the source.
+type Chain struct {
+	deliver.MediaFramePipe
+	stages []Transcoder
+	sink   *chainSink
+}
+
+// chainSink receives the output of the last stage.
+type chainSink struct {
+	deliver.FrameDestination
+	chain *Chain
+}
+
+func (s *chainSink) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	s.chain.MediaFramePipe.OnFrame(frame, attr)
+}
+
+func (s *chainSink) OnMetaData(metadata *deliver.Metadata) {
+	s.chain.MediaFramePipe.OnMetaData(metadata)
+}
+
+// NewChain links the stages, they are closed if it fails.
+func NewChain(ctx context.Context, stages ...Transcoder) (*Chain, error) {
+	if len(stages) == 0 {
+		return nil, ErrInvalidTranscoder
+	}
+
+	c := &Chain{
+		MediaFramePipe: deliver.NewMediaFramePipe(ctx, deliver.FormatSettings{
+			PacketType: deliver.PacketTypeRtp,
+		}),
+		stages: stages,
+	}
+
+	c.sink = &chainSink{
+		FrameDestination: deliver.NewFrameDestinationImpl(c.MediaFramePipe.Context(), deliver.FormatSettings{}),
+		chain:            c,
+	}
+
+	for i := 0; i < len(stages)-1; i++ {
+		if err := stages[i].AddDestination(stages[i+1]); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	if err := stages[len(stages)-1].AddDestination(c.sink); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Chain) Label() string {
+	labels := make([]string, 0, len(c.stages))
+	for _, s := range c.stages {
+		if l := s.Label(); l != "" {
+			labels = append(labels, l)
+		}
+	}
+
+	return strings.Join(labels, "|")
+}
+
+func (c *Chain) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	c.stages[0].OnFrame(frame, attr)
+}
+
+func (c *Chain) OnMetaData(metadata *deliver.Metadata) {
+	c.stages[0].OnMetaData(metadata)
+}
+
+func (c *Chain) Close() {
+	for _, s := range c.stages {
+		s.Close()
+	}
+
+	c.sink.Close()
+	c.MediaFramePipe.Close()
+}
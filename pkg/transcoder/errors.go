@@ -5,4 +5,10 @@ import "errors"
 var (
 	// ErrTranscoderNotSupported is returned when the transcoder is not supported
 	ErrTranscoderNotSupported = errors.New("transcoder not supported")
+	// ErrInvalidTranscoder is returned when a transcoder registration or
+	// configuration is invalid
+	ErrInvalidTranscoder = errors.New("invalid transcoder")
+	// ErrProcessStopped is returned when an external process transcoder
+	// gave up restarting its command
+	ErrProcessStopped = errors.New("transcoder process stopped")
 )
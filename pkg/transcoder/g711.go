@@ -0,0 +1,107 @@
+package transcoder
+
+// G.711 companding as in the ITU reference, 16-bit linear samples.
+
+const (
+	ulawBias = 0x84
+	ulawClip = 32635
+)
+
+var (
+	ulawTable [256]int16
+	alawTable [256]int16
+)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		ulawTable[i] = ulawToLinear(uint8(i))
+		alawTable[i] = alawToLinear(uint8(i))
+	}
+}
+
+func ulawToLinear(u uint8) int16 {
+	u = ^u
+	t := (int32(u&0x0f)<<3 + ulawBias) << ((u & 0x70) >> 4)
+	if u&0x80 != 0 {
+		return int16(ulawBias - t)
+	}
+
+	return int16(t - ulawBias)
+}
+
+func linearToUlaw(sample int16) uint8 {
+	pcm := int32(sample)
+	sign := uint8(0)
+	if pcm < 0 {
+		pcm = -pcm
+		sign = 0x80
+	}
+
+	if pcm > ulawClip {
+		pcm = ulawClip
+	}
+	pcm += ulawBias
+
+	exponent := uint8(7)
+	for mask := int32(0x4000); pcm&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+
+	mantissa := uint8(pcm>>(exponent+3)) & 0x0f
+
+	return ^(sign | exponent<<4 | mantissa)
+}
+
+func alawToLinear(a uint8) int16 {
+	a ^= 0x55
+
+	t := int32(a&0x0f) << 4
+	seg := (a & 0x70) >> 4
+	switch seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+
+	return int16(-t)
+}
+
+var alawSegEnd = [8]int32{0x1f, 0x3f, 0x7f, 0xff, 0x1ff, 0x3ff, 0x7ff, 0xfff}
+
+func linearToAlaw(sample int16) uint8 {
+	pcm := int32(sample) >> 3
+
+	var mask uint8
+	if pcm >= 0 {
+		mask = 0xd5
+	} else {
+		mask = 0x55
+		pcm = -pcm - 1
+	}
+
+	seg := 0
+	for seg < len(alawSegEnd) && pcm > alawSegEnd[seg] {
+		seg++
+	}
+
+	if seg >= len(alawSegEnd) {
+		return 0x7f ^ mask
+	}
+
+	aval := uint8(seg) << 4
+	if seg < 2 {
+		aval |= uint8(pcm>>1) & 0x0f
+	} else {
+		aval |= uint8(pcm>>seg) & 0x0f
+	}
+
+	return aval ^ mask
+}
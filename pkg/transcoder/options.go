@@ -0,0 +1,64 @@
+package transcoder
+
+import "github.com/pingostack/neon/pkg/deliver"
+
+const defaultL16PayloadType = 97
+
+type options struct {
+	sampleRate   int
+	channels     int
+	payloadTypes map[deliver.CodecType]uint8
+}
+
+type Option func(*options)
+
+// WithSampleRate sets the output sample rate, 8000, 16000 and 48000 are
+// the usual ones.
+func WithSampleRate(sampleRate int) Option {
+	return func(o *options) {
+		o.sampleRate = sampleRate
+	}
+}
+
+// WithChannels sets the number of output channels.
+func WithChannels(channels int) Option {
+	return func(o *options) {
+		o.channels = channels
+	}
+}
+
+// WithPayloadType sets the RTP payload type of the output codec, L16 has
+// no static one.
+func WithPayloadType(codec deliver.CodecType, payloadType uint8) Option {
+	return func(o *options) {
+		o.payloadTypes[codec] = payloadType
+	}
+}
+
+// defaultPayloadTypes are the payload types of the codecs without a
+// WithPayloadType option.
+var defaultPayloadTypes = map[deliver.CodecType]uint8{
+	deliver.CodecTypePCMU:        0,
+	deliver.CodecTypePCMA:        8,
+	deliver.CodecTypePCM_48000_2: defaultL16PayloadType,
+}
+
+func newOptions(opts ...Option) options {
+	o := options{
+		payloadTypes: make(map[deliver.CodecType]uint8),
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+func (o options) payloadType(codec deliver.CodecType) uint8 {
+	if pt, ok := o.payloadTypes[codec]; ok {
+		return pt
+	}
+
+	return defaultPayloadTypes[codec]
+}
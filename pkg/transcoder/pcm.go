@@ -0,0 +1,194 @@
+package transcoder
+
+import (
+	"encoding/binary"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+// pcmFormat is the layout of an uncompressed or G.711 audio stream.
+type pcmFormat struct {
+	codec      deliver.CodecType
+	sampleRate int
+	channels   int
+}
+
+func isPCMCodec(codec deliver.CodecType) bool {
+	return codec == deliver.CodecTypePCMU ||
+		codec == deliver.CodecTypePCMA ||
+		codec == deliver.CodecTypePCM_48000_2
+}
+
+// defaultPCMFormat is the usual layout of codec, G.711 is narrowband
+// mono and L16 follows the codec name.
+func defaultPCMFormat(codec deliver.CodecType) pcmFormat {
+	if codec == deliver.CodecTypePCM_48000_2 {
+		return pcmFormat{codec: codec, sampleRate: 48000, channels: 2}
+	}
+
+	return pcmFormat{codec: codec, sampleRate: 8000, channels: 1}
+}
+
+// codecName is the RTP encoding name of the format.
+func (f pcmFormat) codecName() string {
+	if f.codec == deliver.CodecTypePCM_48000_2 {
+		return "L16"
+	}
+
+	return f.codec.String()
+}
+
+// sampleSize is the number of bytes of a sample of one channel.
+func (f pcmFormat) sampleSize() int {
+	if f.codec == deliver.CodecTypePCM_48000_2 {
+		return 2
+	}
+
+	return 1
+}
+
+// decode returns the interleaved 16-bit samples of payload, L16 is
+// big-endian as it is on the wire.
+func (f pcmFormat) decode(payload []byte) []int16 {
+	switch f.codec {
+	case deliver.CodecTypePCMU:
+		samples := make([]int16, len(payload))
+		for i, b := range payload {
+			samples[i] = ulawTable[b]
+		}
+		return samples
+	case deliver.CodecTypePCMA:
+		samples := make([]int16, len(payload))
+		for i, b := range payload {
+			samples[i] = alawTable[b]
+		}
+		return samples
+	default:
+		samples := make([]int16, len(payload)/2)
+		for i := range samples {
+			samples[i] = int16(binary.BigEndian.Uint16(payload[i*2:]))
+		}
+		return samples
+	}
+}
+
+func (f pcmFormat) encode(samples []int16) []byte {
+	switch f.codec {
+	case deliver.CodecTypePCMU:
+		payload := make([]byte, len(samples))
+		for i, s := range samples {
+			payload[i] = linearToUlaw(s)
+		}
+		return payload
+	case deliver.CodecTypePCMA:
+		payload := make([]byte, len(samples))
+		for i, s := range samples {
+			payload[i] = linearToAlaw(s)
+		}
+		return payload
+	default:
+		payload := make([]byte, len(samples)*2)
+		for i, s := range samples {
+			binary.BigEndian.PutUint16(payload[i*2:], uint16(s))
+		}
+		return payload
+	}
+}
+
+// remixChannels converts interleaved samples from in to out channels,
+// a down-mix to mono averages the channels, an up-mix repeats the last
+// input channel.
+func remixChannels(samples []int16, in, out int) []int16 {
+	if in == out || in <= 0 || out <= 0 {
+		return samples
+	}
+
+	frames := len(samples) / in
+	mixed := make([]int16, frames*out)
+	for i := 0; i < frames; i++ {
+		frame := samples[i*in : (i+1)*in]
+		if out == 1 {
+			var sum int32
+			for _, s := range frame {
+				sum += int32(s)
+			}
+			mixed[i] = int16(sum / int32(in))
+			continue
+		}
+
+		for c := 0; c < out; c++ {
+			if c < in {
+				mixed[i*out+c] = frame[c]
+			} else {
+				mixed[i*out+c] = frame[in-1]
+			}
+		}
+	}
+
+	return mixed
+}
+
+// resampler converts the sample rate by linear interpolation, it keeps
+// the last frame so that packets join without discontinuity.
+type resampler struct {
+	inRate   int
+	outRate  int
+	channels int
+	pos      float64
+	last     []int16
+}
+
+func newResampler(inRate, outRate, channels int) *resampler {
+	return &resampler{
+		inRate:   inRate,
+		outRate:  outRate,
+		channels: channels,
+	}
+}
+
+func (r *resampler) process(samples []int16) []int16 {
+	if r.inRate == r.outRate || r.inRate <= 0 || r.outRate <= 0 {
+		return samples
+	}
+
+	ch := r.channels
+	frames := len(samples) / ch
+	if frames == 0 {
+		return nil
+	}
+
+	if r.last == nil {
+		r.last = make([]int16, ch)
+		copy(r.last, samples[:ch])
+	}
+
+	// frame -1 is the last frame of the previous packet
+	at := func(i, c int) float64 {
+		if i < 0 {
+			return float64(r.last[c])
+		}
+		return float64(samples[i*ch+c])
+	}
+
+	step := float64(r.inRate) / float64(r.outRate)
+	out := make([]int16, 0, (int(float64(frames)/step)+1)*ch)
+	for r.pos < float64(frames-1) {
+		i := int(r.pos)
+		if r.pos < 0 {
+			i = -1
+		}
+		frac := r.pos - float64(i)
+
+		for c := 0; c < ch; c++ {
+			v := at(i, c)*(1-frac) + at(i+1, c)*frac
+			out = append(out, int16(v))
+		}
+
+		r.pos += step
+	}
+
+	r.pos -= float64(frames)
+	copy(r.last, samples[(frames-1)*ch:frames*ch])
+
+	return out
+}
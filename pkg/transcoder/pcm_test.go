@@ -0,0 +1,151 @@
+package transcoder
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+func TestG711Reference(t *testing.T) {
+	ulaw := map[uint8]int16{0xff: 0, 0x80: 32124, 0x00: -32124, 0xfe: 8, 0x7e: -8, 0xef: 132}
+	for code, want := range ulaw {
+		if got := ulawToLinear(code); got != want {
+			t.Errorf("ulaw %#x = %d, want %d", code, got, want)
+		}
+	}
+
+	alaw := map[uint8]int16{0xd5: 8, 0x55: -8, 0xaa: 32256, 0x2a: -32256}
+	for code, want := range alaw {
+		if got := alawToLinear(code); got != want {
+			t.Errorf("alaw %#x = %d, want %d", code, got, want)
+		}
+	}
+}
+
+func TestG711RoundTrip(t *testing.T) {
+	for i := 0; i < 256; i++ {
+		code := uint8(i)
+		// 0x7f is the negative zero of u-law, encoded back as 0xff
+		if code != 0x7f {
+			if got := linearToUlaw(ulawToLinear(code)); got != code {
+				t.Errorf("ulaw %#x decoded and encoded to %#x", code, got)
+			}
+		}
+
+		if got := linearToAlaw(alawToLinear(code)); got != code {
+			t.Errorf("alaw %#x decoded and encoded to %#x", code, got)
+		}
+	}
+}
+
+// TestG711Error bounds the quantization error, it grows with the segment
+// of the sample.
+func TestG711Error(t *testing.T) {
+	for s := math.MinInt16; s <= math.MaxInt16; s++ {
+		sample := int16(s)
+		bound := int(math.Abs(float64(s)))/16 + 16
+		if s > ulawClip || s < -ulawClip {
+			bound += int(math.Abs(float64(s))) - ulawClip
+		}
+
+		if d := int(ulawToLinear(linearToUlaw(sample))) - s; d > bound || -d > bound {
+			t.Fatalf("ulaw error of %d is %d", s, d)
+		}
+
+		if d := int(alawToLinear(linearToAlaw(sample))) - s; d > bound || -d > bound {
+			t.Fatalf("alaw error of %d is %d", s, d)
+		}
+	}
+}
+
+func TestPCMFormatL16(t *testing.T) {
+	f := defaultPCMFormat(deliver.CodecTypePCM_48000_2)
+	samples := []int16{0, 1, -1, math.MaxInt16, math.MinInt16}
+
+	payload := f.encode(samples)
+	if len(payload) != len(samples)*f.sampleSize() || payload[2] != 0x00 || payload[3] != 0x01 {
+		t.Fatalf("payload = %x, want big-endian samples", payload)
+	}
+
+	for i, s := range f.decode(payload) {
+		if s != samples[i] {
+			t.Errorf("sample %d = %d, want %d", i, s, samples[i])
+		}
+	}
+}
+
+func TestRemixChannels(t *testing.T) {
+	mono := remixChannels([]int16{100, 200, -100, -300}, 2, 1)
+	if len(mono) != 2 || mono[0] != 150 || mono[1] != -200 {
+		t.Errorf("down-mix = %v", mono)
+	}
+
+	stereo := remixChannels([]int16{5, -5}, 1, 2)
+	if len(stereo) != 4 || stereo[0] != 5 || stereo[1] != 5 || stereo[2] != -5 || stereo[3] != -5 {
+		t.Errorf("up-mix = %v", stereo)
+	}
+}
+
+// ramp returns count frames of channels counting up from start by step.
+func ramp(start, step, count, channels int) []int16 {
+	samples := make([]int16, 0, count*channels)
+	for i := 0; i < count; i++ {
+		for c := 0; c < channels; c++ {
+			samples = append(samples, int16(start+i*step))
+		}
+	}
+
+	return samples
+}
+
+func TestResamplerUpsample(t *testing.T) {
+	r := newResampler(8000, 16000, 1)
+
+	// a ramp split into packets is interpolated without a step at the
+	// joins
+	var out []int16
+	for p := 0; p < 5; p++ {
+		out = append(out, r.process(ramp(p*160*10, 10, 160, 1))...)
+	}
+
+	if n := len(out); n < 1590 || n > 1600 {
+		t.Fatalf("%d samples out of 800, want about 1600", n)
+	}
+
+	for i := 1; i < len(out); i++ {
+		if d := out[i] - out[i-1]; d != 5 {
+			t.Fatalf("sample %d steps by %d, want 5", i, d)
+		}
+	}
+}
+
+func TestResamplerDownsample(t *testing.T) {
+	r := newResampler(48000, 8000, 2)
+
+	var out []int16
+	for p := 0; p < 10; p++ {
+		out = append(out, r.process(ramp(p*960*6, 6, 960, 2))...)
+	}
+
+	if frames := len(out) / 2; frames < 1595 || frames > 1600 {
+		t.Fatalf("%d frames out of 9600, want about 1600", frames)
+	}
+
+	for i := 2; i < len(out); i += 2 {
+		if out[i] != out[i+1] {
+			t.Fatalf("frame %d has channels %d and %d", i/2, out[i], out[i+1])
+		}
+
+		if d := out[i] - out[i-2]; d != 36 {
+			t.Fatalf("frame %d steps by %d, want 36", i/2, d)
+		}
+	}
+}
+
+func TestResamplerSameRate(t *testing.T) {
+	in := ramp(0, 1, 160, 1)
+	if out := newResampler(8000, 8000, 1).process(in); len(out) != len(in) {
+		t.Errorf("%d samples out of %d", len(out), len(in))
+	}
+}
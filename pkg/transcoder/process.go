@@ -0,0 +1,465 @@
+package transcoder
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pion/rtp"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/atomic"
+)
+
+// Framing is how the frames are delimited on the pipes of the process.
+type Framing int
+
+const (
+	// FramingRaw writes the payloads as they are and reads output frames
+	// of ProcessConfig.FrameSize bytes, suits PCM filters.
+	FramingRaw Framing = iota
+	// FramingLengthPrefixed prefixes every frame with its length as a
+	// 4-byte big-endian integer, in both directions.
+	FramingLengthPrefixed
+)
+
+const (
+	defaultProcessQueueSize       = 64
+	defaultProcessRestartDelay    = time.Second
+	defaultProcessMaxRestartDelay = 30 * time.Second
+	processStableDuration         = time.Minute
+	maxProcessFrameSize           = 1 << 20
+)
+
+// ProcessConfig describes an external command transcoding the frames
+// received on its stdin to its stdout.
+type ProcessConfig struct {
+	Name    string
+	Command string
+	Args    []string
+	Env     []string
+	Framing Framing
+	// FrameSize is the size of an output frame with FramingRaw.
+	FrameSize int
+	// Codec, ClockRate, Channels and PayloadType describe the output.
+	Codec       string
+	ClockRate   uint32
+	Channels    uint8
+	PayloadType uint8
+	// SamplesPerFrame advances the timestamp of every output frame.
+	SamplesPerFrame uint32
+	// QueueSize bounds the frames waiting for the process, the oldest
+	// ones are dropped once it is full.
+	QueueSize int
+	// RestartDelay is the first delay before restarting an exited
+	// command, it doubles up to MaxRestartDelay. MaxRestarts gives up
+	// after that many restarts, 0 retries forever.
+	RestartDelay    time.Duration
+	MaxRestartDelay time.Duration
+	MaxRestarts     int
+	Logger          *logrus.Entry
+}
+
+func (cfg *ProcessConfig) validate() error {
+	if cfg.Command == "" {
+		return fmt.Errorf("%w: empty command", ErrInvalidTranscoder)
+	}
+
+	if cfg.Framing == FramingRaw && cfg.FrameSize <= 0 {
+		return fmt.Errorf("%w: raw framing without frame size", ErrInvalidTranscoder)
+	}
+
+	if cfg.Name == "" {
+		cfg.Name = cfg.Command
+	}
+
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultProcessQueueSize
+	}
+
+	if cfg.RestartDelay <= 0 {
+		cfg.RestartDelay = defaultProcessRestartDelay
+	}
+
+	if cfg.MaxRestartDelay < cfg.RestartDelay {
+		cfg.MaxRestartDelay = defaultProcessMaxRestartDelay
+		if cfg.MaxRestartDelay < cfg.RestartDelay {
+			cfg.MaxRestartDelay = cfg.RestartDelay
+		}
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = logrus.WithField("obj", "transcoder-process")
+	}
+
+	return nil
+}
+
+// NewProcessFactory returns a factory of process transcoders for
+// Registry.Register, a process is started per transcoder.
+func NewProcessFactory(cfg ProcessConfig) Factory {
+	return func(ctx context.Context, inCodec, outCodec deliver.CodecType, opts ...Option) (Transcoder, error) {
+		return NewProcessTranscoder(ctx, inCodec, outCodec, cfg, opts...)
+	}
+}
+
+// RegisterProcess registers an external command for a codec pair.
+func RegisterProcess(r *Registry, inCodec, outCodec deliver.CodecType, cost int, cfg ProcessConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	return r.Register(cfg.Name, inCodec, outCodec, cost, NewProcessFactory(cfg))
+}
+
+// ProcessTranscoder pipes the frames of inCodec through an external
+// command, restarting it when it exits. Other frames pass through.
+type ProcessTranscoder struct {
+	deliver.MediaFramePipe
+	cfg      ProcessConfig
+	inCodec  deliver.CodecType
+	outCodec deliver.CodecType
+	logger   *logrus.Entry
+	queue    chan deliver.Frame
+	dropped  atomic.Uint64
+	lock     sync.Mutex
+	header   rtp.Header
+	rtpOut   bool
+	started  bool
+	closed   atomic.Bool
+}
+
+// NewProcessTranscoder starts the command of cfg, the options override
+// the output it announces and the command is expected to follow them.
+func NewProcessTranscoder(ctx context.Context, inCodec, outCodec deliver.CodecType, cfg ProcessConfig, opts ...Option) (*ProcessTranscoder, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts...)
+	if o.sampleRate > 0 {
+		cfg.ClockRate = uint32(o.sampleRate)
+	}
+
+	if o.channels > 0 {
+		cfg.Channels = uint8(o.channels)
+	}
+
+	if pt, ok := o.payloadTypes[outCodec]; ok {
+		cfg.PayloadType = pt
+	}
+
+	t := &ProcessTranscoder{
+		MediaFramePipe: deliver.NewMediaFramePipe(ctx, deliver.FormatSettings{
+			PacketType: deliver.PacketTypeRtp,
+		}),
+		cfg:      cfg,
+		inCodec:  inCodec,
+		outCodec: outCodec,
+		queue:    make(chan deliver.Frame, cfg.QueueSize),
+	}
+
+	t.logger = cfg.Logger.WithFields(logrus.Fields{
+		"transcoder": cfg.Name,
+		"label":      t.Label(),
+	})
+
+	go t.run()
+
+	return t, nil
+}
+
+func (t *ProcessTranscoder) Label() string {
+	return fmt.Sprintf("%s:%s->%s", t.cfg.Name, t.inCodec, t.outCodec)
+}
+
+// Dropped returns the frames dropped because the process lagged behind.
+func (t *ProcessTranscoder) Dropped() uint64 {
+	return t.dropped.Load()
+}
+
+func (t *ProcessTranscoder) OnMetaData(metadata *deliver.Metadata) {
+	md := *metadata
+	// only the media of the input codec is transcoded
+	if md.Audio != nil && md.Audio.CodecType == t.inCodec {
+		md.Audio = &deliver.AudioMetadata{
+			Codec:          t.cfg.Codec,
+			CodecType:      t.outCodec,
+			SampleRate:     t.cfg.ClockRate,
+			Channels:       t.cfg.Channels,
+			RtpPayloadType: t.cfg.PayloadType,
+		}
+	} else if md.Video != nil && md.Video.CodecType == t.inCodec {
+		video := *md.Video
+		video.Codec = t.cfg.Codec
+		video.CodecType = t.outCodec
+		video.ClockRate = t.cfg.ClockRate
+		video.RtpPayloadType = t.cfg.PayloadType
+		md.Video = &video
+	}
+
+	t.MediaFramePipe.OnMetaData(&md)
+}
+
+// OnFrame queues the frame for the process, it never blocks the source:
+// when the process lags behind the oldest frame is dropped.
+func (t *ProcessTranscoder) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	if frame.Codec != t.inCodec {
+		t.MediaFramePipe.OnFrame(frame, attr)
+		return
+	}
+
+	if t.closed.Load() {
+		return
+	}
+
+	for {
+		select {
+		case t.queue <- frame:
+			return
+		default:
+		}
+
+		select {
+		case <-t.queue:
+			if n := t.dropped.Inc(); n%100 == 1 {
+				t.logger.WithField("dropped", n).Warn("transcoder process lagging, frames dropped")
+			}
+		default:
+		}
+	}
+}
+
+func (t *ProcessTranscoder) run() {
+	ctx := t.MediaFramePipe.Context()
+	delay := t.cfg.RestartDelay
+
+	restarts := 0
+	for {
+		started := time.Now()
+		err := t.runOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// a stable run starts the restarts and their delay over
+		if time.Since(started) > processStableDuration {
+			restarts = 0
+			delay = t.cfg.RestartDelay
+		}
+
+		if t.cfg.MaxRestarts > 0 && restarts >= t.cfg.MaxRestarts {
+			t.logger.WithError(err).Error(ErrProcessStopped.Error())
+			t.Close()
+			return
+		}
+		restarts++
+
+		t.logger.WithError(err).WithField("delay", delay).Warn("transcoder process exited, restarting")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > t.cfg.MaxRestartDelay {
+			delay = t.cfg.MaxRestartDelay
+		}
+	}
+}
+
+func (t *ProcessTranscoder) runOnce(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, t.cfg.Command, t.cfg.Args...)
+	cmd.Env = t.cfg.Env
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	t.logger.WithField("pid", cmd.Process.Pid).Info("transcoder process started")
+
+	done := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		defer stdin.Close()
+		if err := t.writeFrames(stdin, done); err != nil {
+			t.logger.WithError(err).Debug("transcoder process write failed")
+			cmd.Process.Kill()
+		}
+	}()
+
+	var readers sync.WaitGroup
+	readers.Add(2)
+
+	go func() {
+		defer readers.Done()
+		if err := t.readFrames(stdout); err != nil && err != io.EOF {
+			t.logger.WithError(err).Debug("transcoder process read failed")
+			cmd.Process.Kill()
+		}
+	}()
+
+	go func() {
+		defer readers.Done()
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			t.logger.Debug(scanner.Text())
+		}
+	}()
+
+	// Wait closes the pipes, the reads must be over before calling it
+	readers.Wait()
+	close(done)
+	<-writerDone
+
+	return cmd.Wait()
+}
+
+func (t *ProcessTranscoder) writeFrames(w io.Writer, done <-chan struct{}) error {
+	var prefix [4]byte
+	for {
+		var frame deliver.Frame
+		select {
+		case <-done:
+			return nil
+		case frame = <-t.queue:
+		}
+
+		payload := t.payloadOf(frame)
+		if len(payload) == 0 {
+			continue
+		}
+
+		if t.cfg.Framing == FramingLengthPrefixed {
+			binary.BigEndian.PutUint32(prefix[:], uint32(len(payload)))
+			if _, err := w.Write(prefix[:]); err != nil {
+				return err
+			}
+		}
+
+		if _, err := w.Write(payload); err != nil {
+			return err
+		}
+	}
+}
+
+// payloadOf returns the payload of an input frame, keeping its RTP
+// header as the template of the output packets.
+func (t *ProcessTranscoder) payloadOf(frame deliver.Frame) []byte {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if frame.PacketType == deliver.PacketTypeRtp {
+		pkt, ok := frame.RawPacket.(*rtp.Packet)
+		if !ok {
+			return nil
+		}
+
+		if !t.started {
+			t.started = true
+			t.header = pkt.Header
+			t.header.Extension = false
+			t.header.Extensions = nil
+			t.header.Padding = false
+			t.header.PayloadType = t.cfg.PayloadType
+		}
+		t.header.SSRC = pkt.SSRC
+		t.rtpOut = true
+
+		return pkt.Payload
+	}
+
+	t.rtpOut = false
+
+	return frame.Payload
+}
+
+func (t *ProcessTranscoder) readFrames(r io.Reader) error {
+	var prefix [4]byte
+	for {
+		size := t.cfg.FrameSize
+		if t.cfg.Framing == FramingLengthPrefixed {
+			if _, err := io.ReadFull(r, prefix[:]); err != nil {
+				return err
+			}
+
+			size = int(binary.BigEndian.Uint32(prefix[:]))
+			if size > maxProcessFrameSize {
+				return fmt.Errorf("%w: frame of %d bytes", ErrInvalidTranscoder, size)
+			}
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err
+		}
+
+		t.deliver(payload)
+	}
+}
+
+func (t *ProcessTranscoder) deliver(payload []byte) {
+	frame := deliver.Frame{
+		Codec:      t.outCodec,
+		PacketType: deliver.PacketTypeRaw,
+		Payload:    payload,
+		Length:     len(payload),
+	}
+
+	t.lock.Lock()
+	if t.rtpOut {
+		header := t.header
+		t.header.SequenceNumber++
+		t.header.Timestamp += t.cfg.SamplesPerFrame
+
+		frame.PacketType = deliver.PacketTypeRtp
+		frame.TimeStamp = header.Timestamp
+		frame.Payload = nil
+		frame.RawPacket = &rtp.Packet{
+			Header:  header,
+			Payload: payload,
+		}
+	}
+	t.lock.Unlock()
+
+	if t.outCodec.IsAudio() {
+		frame.AdditionalInfo = &deliver.AudioFrameSpecificInfo{
+			NbSamples:  t.cfg.SamplesPerFrame,
+			SampleRate: t.cfg.ClockRate,
+			Channels:   t.cfg.Channels,
+		}
+	} else {
+		frame.AdditionalInfo = &deliver.VideoFrameSpecificInfo{}
+	}
+
+	t.MediaFramePipe.OnFrame(frame, nil)
+}
+
+func (t *ProcessTranscoder) Close() {
+	if t.closed.CompareAndSwap(false, true) {
+		t.MediaFramePipe.Close()
+	}
+}
@@ -0,0 +1,247 @@
+package transcoder
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+// Factory creates a transcoder converting inCodec to outCodec.
+type Factory func(ctx context.Context, inCodec, outCodec deliver.CodecType, opts ...Option) (Transcoder, error)
+
+// Hop is one transcoder of a path.
+type Hop struct {
+	Name     string
+	InCodec  deliver.CodecType
+	OutCodec deliver.CodecType
+	Cost     int
+	factory  Factory
+}
+
+// Registry holds the transcoder factories by codec pair, each one with a
+// cost so that the cheapest path, possibly through several transcoders,
+// can be chosen.
+type Registry struct {
+	lock  sync.RWMutex
+	edges map[deliver.CodecType]map[deliver.CodecType]Hop
+}
+
+// DefaultRegistry is the registry used by NewTranscoder, it knows the
+// builtin transcoders.
+var DefaultRegistry = NewRegistry()
+
+func init() {
+	pcm := []deliver.CodecType{
+		deliver.CodecTypePCMU,
+		deliver.CodecTypePCMA,
+		deliver.CodecTypePCM_48000_2,
+	}
+
+	factory := func(ctx context.Context, inCodec, outCodec deliver.CodecType, opts ...Option) (Transcoder, error) {
+		return NewAudioTranscoder(ctx, inCodec, outCodec, opts...)
+	}
+
+	for _, in := range pcm {
+		for _, out := range pcm {
+			if in != out {
+				DefaultRegistry.Register("pcm", in, out, 1, factory)
+			}
+		}
+	}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		edges: make(map[deliver.CodecType]map[deliver.CodecType]Hop),
+	}
+}
+
+// Register adds or replaces the factory of a codec pair, the cost must be
+// positive.
+func (r *Registry) Register(name string, inCodec, outCodec deliver.CodecType, cost int, factory Factory) error {
+	if inCodec == outCodec {
+		return fmt.Errorf("%w: %s to itself", ErrInvalidTranscoder, inCodec)
+	}
+
+	if cost <= 0 || factory == nil {
+		return fmt.Errorf("%w: %s", ErrInvalidTranscoder, name)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.edges[inCodec] == nil {
+		r.edges[inCodec] = make(map[deliver.CodecType]Hop)
+	}
+
+	r.edges[inCodec][outCodec] = Hop{
+		Name:     name,
+		InCodec:  inCodec,
+		OutCodec: outCodec,
+		Cost:     cost,
+		factory:  factory,
+	}
+
+	return nil
+}
+
+func (r *Registry) Unregister(inCodec, outCodec deliver.CodecType) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.edges[inCodec], outCodec)
+}
+
+type pathNode struct {
+	codec deliver.CodecType
+	cost  int
+	index int
+}
+
+type pathQueue []*pathNode
+
+func (q pathQueue) Len() int            { return len(q) }
+func (q pathQueue) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q pathQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i]; q[i].index = i; q[j].index = j }
+func (q *pathQueue) Push(x interface{}) { n := x.(*pathNode); n.index = len(*q); *q = append(*q, n) }
+func (q *pathQueue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
+
+// Path returns the cheapest chain of transcoders from inCodec to
+// outCodec and its total cost.
+func (r *Registry) Path(inCodec, outCodec deliver.CodecType) ([]Hop, int, error) {
+	if inCodec == outCodec {
+		return nil, 0, nil
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	dist := map[deliver.CodecType]int{inCodec: 0}
+	prev := make(map[deliver.CodecType]Hop)
+	q := &pathQueue{}
+	heap.Push(q, &pathNode{codec: inCodec})
+
+	for q.Len() > 0 {
+		n := heap.Pop(q).(*pathNode)
+		if n.cost > dist[n.codec] {
+			continue
+		}
+
+		if n.codec == outCodec {
+			break
+		}
+
+		for next, hop := range r.edges[n.codec] {
+			cost := n.cost + hop.Cost
+			if d, ok := dist[next]; ok && d <= cost {
+				continue
+			}
+
+			dist[next] = cost
+			prev[next] = hop
+			heap.Push(q, &pathNode{codec: next, cost: cost})
+		}
+	}
+
+	cost, ok := dist[outCodec]
+	if !ok {
+		return nil, 0, ErrTranscoderNotSupported
+	}
+
+	var hops []Hop
+	for codec := outCodec; codec != inCodec; codec = prev[codec].InCodec {
+		hops = append([]Hop{prev[codec]}, hops...)
+	}
+
+	return hops, cost, nil
+}
+
+// Cheapest picks among the candidates the output codec reachable at the
+// lowest cost, candidates equal to inCodec cost nothing.
+func (r *Registry) Cheapest(inCodec deliver.CodecType, candidates []deliver.CodecType) (deliver.CodecType, error) {
+	best, bestCost := deliver.CodecTypeNone, -1
+	for _, out := range candidates {
+		_, cost, err := r.Path(inCodec, out)
+		if err != nil {
+			continue
+		}
+
+		if bestCost < 0 || cost < bestCost {
+			best, bestCost = out, cost
+		}
+	}
+
+	if bestCost < 0 {
+		return deliver.CodecTypeNone, ErrTranscoderNotSupported
+	}
+
+	return best, nil
+}
+
+// NewTranscoder creates the transcoders of the cheapest path, chained if
+// there are several. The options apply to the last one.
+func (r *Registry) NewTranscoder(ctx context.Context, inCodec, outCodec deliver.CodecType, opts ...Option) (Transcoder, error) {
+	if inCodec == outCodec {
+		return NewNoopTranscoder(ctx, inCodec), nil
+	}
+
+	hops, _, err := r.Path(inCodec, outCodec)
+	if err != nil {
+		return nil, err
+	}
+
+	stages := make([]Transcoder, 0, len(hops))
+	for i, hop := range hops {
+		var hopOpts []Option
+		if i == len(hops)-1 {
+			hopOpts = opts
+		}
+
+		t, err := hop.factory(ctx, hop.InCodec, hop.OutCodec, hopOpts...)
+		if err != nil {
+			for _, s := range stages {
+				s.Close()
+			}
+			return nil, fmt.Errorf("transcoder %s %s->%s: %w", hop.Name, hop.InCodec, hop.OutCodec, err)
+		}
+
+		stages = append(stages, t)
+	}
+
+	if len(stages) == 1 {
+		return stages[0], nil
+	}
+
+	return NewChain(ctx, stages...)
+}
+
+// Pairs lists the registered codec pairs, for diagnostics.
+func (r *Registry) Pairs() []Hop {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var hops []Hop
+	for _, outs := range r.edges {
+		for _, hop := range outs {
+			hops = append(hops, hop)
+		}
+	}
+
+	sort.Slice(hops, func(i, j int) bool {
+		if hops[i].InCodec != hops[j].InCodec {
+			return hops[i].InCodec < hops[j].InCodec
+		}
+		return hops[i].OutCodec < hops[j].OutCodec
+	})
+
+	return hops
+}
@@ -14,11 +14,13 @@ type Transcoder interface {
 }
 
 type NoopTranscoder struct {
-	deliver.MediaFramePipeImpl
+	deliver.MediaFramePipe
 }
 
 func NewNoopTranscoder(ctx context.Context, inCodec deliver.CodecType) Transcoder {
-	return &NoopTranscoder{}
+	return &NoopTranscoder{
+		MediaFramePipe: deliver.NewMediaFramePipe(ctx, deliver.FormatSettings{}),
+	}
 }
 
 func (t *NoopTranscoder) Label() string {
@@ -26,5 +28,5 @@ func (t *NoopTranscoder) Label() string {
 }
 
 func (t *NoopTranscoder) Close() {
-	t.MediaFramePipeImpl.Close()
+	t.MediaFramePipe.Close()
 }
@@ -6,10 +6,15 @@ import (
 	"github.com/pingostack/neon/pkg/deliver"
 )
 
-func NewTranscoder(ctx context.Context, inCodec, outCodec deliver.CodecType) (Transcoder, error) {
-	if inCodec == outCodec {
+// NewTranscoder creates the cheapest transcoder path of DefaultRegistry.
+func NewTranscoder(ctx context.Context, inCodec, outCodec deliver.CodecType, opts ...Option) (Transcoder, error) {
+	if inCodec == outCodec && len(opts) == 0 {
 		return NewNoopTranscoder(ctx, inCodec), nil
-	} else {
-		return nil, ErrTranscoderNotSupported
 	}
+
+	if inCodec == outCodec && isPCMCodec(inCodec) {
+		return NewAudioTranscoder(ctx, inCodec, outCodec, opts...)
+	}
+
+	return DefaultRegistry.NewTranscoder(ctx, inCodec, outCodec, opts...)
 }
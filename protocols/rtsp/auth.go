@@ -0,0 +1,215 @@
+package rtsp
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+type AuthScheme int
+
+const (
+	AuthSchemeNone AuthScheme = iota
+	AuthSchemeBasic
+	AuthSchemeDigest
+)
+
+const (
+	DigestAlgorithmMD5    = "MD5"
+	DigestAlgorithmSHA256 = "SHA-256"
+)
+
+var (
+	ErrAuthSchemeNotSupported = errors.New("auth scheme not supported")
+	ErrAuthAlgorithmInvalid   = errors.New("auth algorithm not supported")
+)
+
+func (s AuthScheme) String() string {
+	switch s {
+	case AuthSchemeBasic:
+		return "Basic"
+	case AuthSchemeDigest:
+		return "Digest"
+	}
+
+	return "None"
+}
+
+// AuthChallenge is a parsed WWW-Authenticate header.
+type AuthChallenge struct {
+	Scheme    AuthScheme
+	Realm     string
+	Nonce     string
+	Opaque    string
+	Algorithm string
+	Qop       string
+	Stale     bool
+}
+
+// ParseAuthChallenge parses a WWW-Authenticate header value.
+func ParseAuthChallenge(header string) (*AuthChallenge, error) {
+	scheme, rest := splitAuthScheme(header)
+	c := &AuthChallenge{}
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		c.Scheme = AuthSchemeBasic
+	case "digest":
+		c.Scheme = AuthSchemeDigest
+		c.Algorithm = DigestAlgorithmMD5
+	default:
+		return nil, ErrAuthSchemeNotSupported
+	}
+
+	params := parseAuthParams(rest)
+	c.Realm = params["realm"]
+	c.Nonce = params["nonce"]
+	c.Opaque = params["opaque"]
+	c.Qop = params["qop"]
+	c.Stale = strings.EqualFold(params["stale"], "true")
+	if alg, ok := params["algorithm"]; ok {
+		c.Algorithm = alg
+	}
+
+	return c, nil
+}
+
+// String renders the challenge as a WWW-Authenticate header value.
+func (c *AuthChallenge) String() string {
+	if c.Scheme == AuthSchemeBasic {
+		return fmt.Sprintf(`Basic realm="%s"`, c.Realm)
+	}
+
+	s := fmt.Sprintf(`Digest realm="%s", nonce="%s"`, c.Realm, c.Nonce)
+	if c.Algorithm != "" {
+		s += ", algorithm=" + c.Algorithm
+	}
+
+	if c.Opaque != "" {
+		s += fmt.Sprintf(`, opaque="%s"`, c.Opaque)
+	}
+
+	if c.Stale {
+		s += ", stale=TRUE"
+	}
+
+	return s
+}
+
+// Authorization builds the Authorization header value answering this
+// challenge.
+func (c *AuthChallenge) Authorization(method, uri, user, password string) (string, error) {
+	if c.Scheme == AuthSchemeBasic {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password)), nil
+	}
+
+	h, err := digestHash(c.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	ha1 := hashHex(h, user+":"+c.Realm+":"+password)
+	ha2 := hashHex(h, method+":"+uri)
+
+	s := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s"`, user, c.Realm, c.Nonce, uri)
+
+	qop := ""
+	for _, q := range strings.Split(c.Qop, ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+
+	if qop != "" {
+		cnonce := newNonce()
+		nc := "00000001"
+		response := hashHex(h, ha1+":"+c.Nonce+":"+nc+":"+cnonce+":"+qop+":"+ha2)
+		s += fmt.Sprintf(`, response="%s", qop=%s, nc=%s, cnonce="%s"`, response, qop, nc, cnonce)
+	} else {
+		s += fmt.Sprintf(`, response="%s"`, hashHex(h, ha1+":"+c.Nonce+":"+ha2))
+	}
+
+	if c.Algorithm != "" {
+		s += ", algorithm=" + c.Algorithm
+	}
+
+	if c.Opaque != "" {
+		s += fmt.Sprintf(`, opaque="%s"`, c.Opaque)
+	}
+
+	return s, nil
+}
+
+func splitAuthScheme(header string) (string, string) {
+	header = strings.TrimSpace(header)
+	i := strings.IndexByte(header, ' ')
+	if i < 0 {
+		return header, ""
+	}
+
+	return header[:i], strings.TrimSpace(header[i+1:])
+}
+
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			break
+		}
+
+		key := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = strings.TrimSpace(s[i+1:])
+
+		var val string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				val, s = s[1:], ""
+			} else {
+				val, s = s[1:end+1], s[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				val, s = s, ""
+			} else {
+				val, s = s[:end], s[end+1:]
+			}
+		}
+
+		params[key] = strings.TrimSpace(val)
+	}
+
+	return params
+}
+
+func digestHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToUpper(algorithm) {
+	case "", DigestAlgorithmMD5:
+		return md5.New, nil
+	case DigestAlgorithmSHA256:
+		return sha256.New, nil
+	}
+
+	return nil, ErrAuthAlgorithmInvalid
+}
+
+func hashHex(h func() hash.Hash, s string) string {
+	hh := h()
+	hh.Write([]byte(s))
+	return hex.EncodeToString(hh.Sum(nil))
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
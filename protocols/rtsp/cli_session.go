@@ -1 +1,851 @@
 package rtsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDialTimeout          = 5 * time.Second
+	defaultRequestTimeout       = 5 * time.Second
+	defaultReadTimeout          = 10 * time.Second
+	defaultKeepaliveInterval    = 30 * time.Second
+	defaultReconnectInterval    = 1 * time.Second
+	defaultMaxReconnectInterval = 30 * time.Second
+	defaultUserAgent            = "Neon-RTSP"
+	defaultRtspPort             = "554"
+	cliReadBufferSize           = 64 * 1024
+	stableConnectionDuration    = 30 * time.Second
+	// keepaliveReadMargin is added to two keepalive intervals to bound
+	// the reads on the control connection
+	keepaliveReadMargin = 5 * time.Second
+)
+
+var (
+	ErrCliSessionClosed = errors.New("rtsp client session closed")
+	ErrRequestTimeout   = errors.New("rtsp request timeout")
+	ErrNoTrack          = errors.New("rtsp no track available")
+)
+
+type CliSessionOptions struct {
+	// Url is the rtsp url to pull, it may carry user:password.
+	Url string
+
+	// Transport selects between TCP interleaved and UDP delivery of the
+	// media, TCP is used by default.
+	Transport TransportType
+
+	DialTimeout    time.Duration
+	RequestTimeout time.Duration
+
+	// ReadTimeout closes the connection when nothing is received for
+	// this duration, it triggers a reconnection. It is raised to two
+	// keepalive intervals, the server may send nothing else on the
+	// connection with UDP tracks or a paused stream.
+	ReadTimeout time.Duration
+
+	// KeepaliveInterval defaults to half of the session timeout
+	// announced by the server.
+	KeepaliveInterval time.Duration
+
+	ReconnectInterval    time.Duration
+	MaxReconnectInterval time.Duration
+
+	// MaxReconnects is the number of reconnections before giving up,
+	// 0 means forever and a negative value disables reconnection.
+	MaxReconnects int
+
+	UserAgent string
+	Logger    Logger
+	Listener  IRtspListener
+}
+
+type interleavedChannel struct {
+	track *TrackRemote
+	rtcp  bool
+}
+
+type CliSession struct {
+	ctx            context.Context
+	cancel         context.CancelFunc
+	opts           CliSessionOptions
+	url            string
+	host           string
+	user           string
+	password       string
+	logger         Logger
+	lock           sync.Mutex
+	cli            *Client
+	pending        map[int]chan *Response
+	challenge      *AuthChallenge
+	session        string
+	sessionTimeout time.Duration
+	public         []string
+	tracks         []*TrackRemote
+	channels       map[int]interleavedChannel
+	udpConns       []*net.UDPConn
+	err            error
+}
+
+func NewCliSession(ctx context.Context, opts CliSessionOptions) (*CliSession, error) {
+	cs := &CliSession{
+		opts:     opts,
+		pending:  make(map[int]chan *Response),
+		channels: make(map[int]interleavedChannel),
+	}
+
+	if err := cs.validate(); err != nil {
+		return nil, err
+	}
+
+	cs.ctx, cs.cancel = context.WithCancel(ctx)
+
+	return cs, nil
+}
+
+func (cs *CliSession) validate() error {
+	u, err := url.Parse(cs.opts.Url)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(u.Scheme, "rtsp") {
+		return fmt.Errorf("invalid rtsp url scheme %s", u.Scheme)
+	}
+
+	if u.User != nil {
+		cs.user = u.User.Username()
+		cs.password, _ = u.User.Password()
+		u.User = nil
+	}
+
+	cs.url = u.String()
+	cs.host = u.Host
+	if u.Port() == "" {
+		cs.host = net.JoinHostPort(u.Hostname(), defaultRtspPort)
+	}
+
+	if cs.opts.DialTimeout <= 0 {
+		cs.opts.DialTimeout = defaultDialTimeout
+	}
+
+	if cs.opts.RequestTimeout <= 0 {
+		cs.opts.RequestTimeout = defaultRequestTimeout
+	}
+
+	if cs.opts.ReadTimeout <= 0 {
+		cs.opts.ReadTimeout = defaultReadTimeout
+	}
+
+	if cs.opts.ReconnectInterval <= 0 {
+		cs.opts.ReconnectInterval = defaultReconnectInterval
+	}
+
+	if cs.opts.MaxReconnectInterval < cs.opts.ReconnectInterval {
+		cs.opts.MaxReconnectInterval = defaultMaxReconnectInterval
+	}
+
+	if cs.opts.UserAgent == "" {
+		cs.opts.UserAgent = defaultUserAgent
+	}
+
+	cs.logger = cs.opts.Logger
+	if cs.logger == nil {
+		cs.logger = logrus.WithField("rtsp-client", cs.url)
+	}
+
+	return nil
+}
+
+// Start connects to the server in background, the connection is
+// re-established according to the reconnect options until Close is called.
+func (cs *CliSession) Start() {
+	go cs.run()
+}
+
+func (cs *CliSession) Close() {
+	cs.cancel()
+}
+
+func (cs *CliSession) Context() context.Context {
+	return cs.ctx
+}
+
+// Err returns the error of the last connection, the one which made the
+// session give up once its context is done.
+func (cs *CliSession) Err() error {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	return cs.err
+}
+
+func (cs *CliSession) Url() string {
+	return cs.url
+}
+
+func (cs *CliSession) Tracks() []*TrackRemote {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	tracks := make([]*TrackRemote, len(cs.tracks))
+	copy(tracks, cs.tracks)
+	return tracks
+}
+
+func (cs *CliSession) run() {
+	defer cs.cancel()
+
+	attempts := 0
+	interval := cs.opts.ReconnectInterval
+	for {
+		startAt := time.Now()
+		err := cs.serve()
+		if cs.ctx.Err() != nil {
+			cs.logger.Infof("rtsp client closed")
+			return
+		}
+
+		if time.Since(startAt) > stableConnectionDuration {
+			attempts = 0
+			interval = cs.opts.ReconnectInterval
+		}
+
+		cs.lock.Lock()
+		cs.err = err
+		cs.lock.Unlock()
+
+		attempts++
+		if cs.opts.MaxReconnects < 0 || (cs.opts.MaxReconnects > 0 && attempts > cs.opts.MaxReconnects) {
+			cs.logger.Errorf("rtsp client give up after %d attempts: %v", attempts, err)
+			return
+		}
+
+		cs.logger.Warnf("rtsp client disconnected: %v, reconnect in %s", err, interval)
+
+		select {
+		case <-cs.ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		interval *= 2
+		if interval > cs.opts.MaxReconnectInterval {
+			interval = cs.opts.MaxReconnectInterval
+		}
+	}
+}
+
+func (cs *CliSession) serve() error {
+	conn, err := net.DialTimeout("tcp", cs.host, cs.opts.DialTimeout)
+	if err != nil {
+		return err
+	}
+
+	connCtx, connCancel := context.WithCancel(cs.ctx)
+	defer func() {
+		connCancel()
+		conn.Close()
+		cs.reset()
+	}()
+
+	cli := NewClient(func(data []byte) error {
+		_, err := conn.Write(data)
+		return err
+	})
+	cli.SetUrl(cs.url)
+	cli.OnResponse = cs.handleResponse
+	cli.OnInterleaved = cs.handleInterleaved
+
+	cs.lock.Lock()
+	cs.cli = cli
+	cs.lock.Unlock()
+
+	chReadErr := make(chan error, 1)
+	go func() {
+		chReadErr <- cs.readLoop(conn, cli)
+		connCancel()
+	}()
+
+	if err := cs.handshake(connCtx); err != nil {
+		return err
+	}
+
+	go cs.keepalive(connCtx, conn)
+
+	select {
+	case err := <-chReadErr:
+		return err
+	case <-cs.ctx.Done():
+		cs.teardown()
+		return cs.ctx.Err()
+	}
+}
+
+func (cs *CliSession) reset() {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	for _, c := range cs.udpConns {
+		c.Close()
+	}
+
+	for cseq, ch := range cs.pending {
+		close(ch)
+		delete(cs.pending, cseq)
+	}
+
+	cs.udpConns = nil
+	cs.channels = make(map[int]interleavedChannel)
+	cs.session = ""
+	cs.sessionTimeout = 0
+	cs.cli = nil
+}
+
+func (cs *CliSession) readLoop(conn net.Conn, cli *Client) error {
+	buf := make([]byte, 0, cliReadBufferSize)
+	tmp := make([]byte, cliReadBufferSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(cs.readTimeout()))
+		n, err := conn.Read(tmp)
+		if n > 0 {
+			buf = append(buf, tmp[:n]...)
+			consumed := 0
+			for consumed < len(buf) {
+				offset, ferr := cli.Feed(buf[consumed:])
+				if ferr != nil {
+					return ferr
+				}
+
+				if offset == 0 {
+					break
+				}
+
+				consumed += offset
+			}
+
+			buf = append(buf[:0], buf[consumed:]...)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (cs *CliSession) handleResponse(resp *Response) {
+	cs.lock.Lock()
+	ch, found := cs.pending[resp.CSeq()]
+	if found {
+		delete(cs.pending, resp.CSeq())
+	}
+	cs.lock.Unlock()
+
+	if !found {
+		cs.logger.Debugf("rtsp unexpected response cseq %d", resp.CSeq())
+		return
+	}
+
+	ch <- resp
+}
+
+func (cs *CliSession) handleInterleaved(channel int, payload []byte) {
+	cs.lock.Lock()
+	ic, found := cs.channels[channel]
+	cs.lock.Unlock()
+
+	if !found {
+		return
+	}
+
+	buf := make([]byte, len(payload))
+	copy(buf, payload)
+
+	if ic.rtcp {
+		ic.track.handleRtcp(buf)
+		return
+	}
+
+	if err := ic.track.handleRtp(buf); err != nil {
+		cs.logger.Debugf("rtsp invalid rtp packet on channel %d: %v", channel, err)
+	}
+}
+
+func (cs *CliSession) newRequest(method string) (*Request, error) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	if cs.cli == nil {
+		return nil, ErrCliSessionClosed
+	}
+
+	req := cs.cli.NewRequest(method)
+	req.SetLine("User-Agent", cs.opts.UserAgent)
+	if cs.session != "" {
+		req.SetLine("Session", cs.session)
+	}
+
+	return req, nil
+}
+
+func (cs *CliSession) send(req *Request) (*Response, error) {
+	cseq, _ := strconv.Atoi(req.lines["CSeq"])
+	ch := make(chan *Response, 1)
+
+	cs.lock.Lock()
+	cli := cs.cli
+	if cli == nil {
+		cs.lock.Unlock()
+		return nil, ErrCliSessionClosed
+	}
+	cs.pending[cseq] = ch
+	cs.lock.Unlock()
+
+	cs.logger.Debugf("rtsp request: %s", req.String())
+
+	if err := cli.Write([]byte(req.String())); err != nil {
+		cs.lock.Lock()
+		delete(cs.pending, cseq)
+		cs.lock.Unlock()
+		return nil, err
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return nil, ErrCliSessionClosed
+		}
+
+		return resp, nil
+	case <-time.After(cs.opts.RequestTimeout):
+		cs.lock.Lock()
+		delete(cs.pending, cseq)
+		cs.lock.Unlock()
+		return nil, ErrRequestTimeout
+	case <-cs.ctx.Done():
+		return nil, ErrCliSessionClosed
+	}
+}
+
+// roundTrip sends the request and answers an authentication challenge
+// once if the url carries credentials.
+func (cs *CliSession) roundTrip(req *Request) (*Response, error) {
+	for retried := false; ; retried = true {
+		cs.authorize(req)
+
+		resp, err := cs.send(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Status() != StatusUnauthorized || retried || cs.user == "" {
+			return resp, nil
+		}
+
+		challenge, err := ParseAuthChallenge(resp.WWWAuthenticate())
+		if err != nil {
+			return nil, err
+		}
+
+		cs.lock.Lock()
+		cs.challenge = challenge
+		if cs.cli != nil {
+			req.lines["CSeq"] = cs.cli.nextCSeq()
+		}
+		cs.lock.Unlock()
+	}
+}
+
+func (cs *CliSession) authorize(req *Request) {
+	cs.lock.Lock()
+	challenge := cs.challenge
+	cs.lock.Unlock()
+
+	if challenge == nil {
+		return
+	}
+
+	authorization, err := challenge.Authorization(strings.ToUpper(req.method), req.url, cs.user, cs.password)
+	if err != nil {
+		cs.logger.Errorf("rtsp authorization error: %v", err)
+		return
+	}
+
+	req.SetLine("Authorization", authorization)
+}
+
+func (cs *CliSession) handshake(ctx context.Context) error {
+	req, err := cs.newRequest("OPTIONS")
+	if err != nil {
+		return err
+	}
+
+	resp, err := cs.roundTrip(req)
+	if err != nil {
+		return fmt.Errorf("options failed: %w", err)
+	}
+
+	if resp.Status() == StatusOK {
+		public := resp.Option().Public()
+		for i := range public {
+			public[i] = strings.ToUpper(strings.TrimSpace(public[i]))
+		}
+		cs.public = public
+	}
+
+	tracks, err := cs.describe()
+	if err != nil {
+		return err
+	}
+
+	for i, track := range tracks {
+		if err := cs.setup(ctx, i, track); err != nil {
+			return err
+		}
+	}
+
+	cs.lock.Lock()
+	cs.tracks = tracks
+	cs.lock.Unlock()
+
+	if cs.opts.Listener != nil {
+		if err := cs.opts.Listener.OnTracksReady(tracks); err != nil {
+			return err
+		}
+	}
+
+	if err := cs.play(); err != nil {
+		return err
+	}
+
+	if cs.opts.Listener != nil {
+		cs.opts.Listener.OnPlay()
+	}
+
+	return nil
+}
+
+func (cs *CliSession) describe() ([]*TrackRemote, error) {
+	req, err := cs.newRequest("DESCRIBE")
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetLine("Accept", "application/sdp")
+
+	resp, err := cs.roundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("describe failed: %w", err)
+	}
+
+	if resp.Status() != StatusOK {
+		return nil, fmt.Errorf("describe failed: %d %s", resp.Status(), resp.Status().String())
+	}
+
+	base := resp.Line("content-base")
+	if base == "" {
+		base = resp.Line("content-location")
+	}
+
+	if base == "" {
+		base = cs.url
+	}
+
+	cs.logger.Debugf("rtsp describe: %s", string(resp.Content()))
+
+	all, err := ParseTracks(resp.Content(), base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sdp: %w", err)
+	}
+
+	tracks := make([]*TrackRemote, 0, len(all))
+	for _, track := range all {
+		if cs.opts.Listener != nil {
+			if err := cs.opts.Listener.OnTrackRemote(track); err != nil {
+				cs.logger.Infof("rtsp track %s(%s) skipped: %v", track.Control, track.Codec, err)
+				continue
+			}
+		}
+
+		tracks = append(tracks, track)
+	}
+
+	if len(tracks) == 0 {
+		return nil, ErrNoTrack
+	}
+
+	return tracks, nil
+}
+
+func (cs *CliSession) setup(ctx context.Context, index int, track *TrackRemote) error {
+	transportType := cs.opts.Transport
+	for {
+		resp, rtpConn, rtcpConn, err := cs.setupTransport(index, track, transportType)
+		if err != nil {
+			return err
+		}
+
+		if resp.Status() == StatusUnsupportedTransport && transportType == TransportTypeUdp {
+			cs.logger.Infof("rtsp udp transport refused, fallback to tcp")
+			rtpConn.Close()
+			rtcpConn.Close()
+			transportType = TransportTypeTcp
+			continue
+		}
+
+		if resp.Status() != StatusOK {
+			if rtpConn != nil {
+				rtpConn.Close()
+				rtcpConn.Close()
+			}
+			return fmt.Errorf("setup %s failed: %d %s", track.Control, resp.Status(), resp.Status().String())
+		}
+
+		trans, err := resp.Setup().Transport()
+		if err != nil {
+			return fmt.Errorf("setup %s invalid transport: %w", track.Control, err)
+		}
+
+		cs.lock.Lock()
+		if cs.session == "" {
+			cs.session, cs.sessionTimeout = parseSessionHeader(resp.Session())
+		}
+
+		if transportType == TransportTypeTcp {
+			rtpChannel, rtcpChannel := trans.RtpInterleaved(), trans.RtcpInterleaved()
+			if trans.Type() != TransportTypeTcp {
+				rtpChannel, rtcpChannel = index*2, index*2+1
+			}
+
+			cs.channels[rtpChannel] = interleavedChannel{track: track}
+			cs.channels[rtcpChannel] = interleavedChannel{track: track, rtcp: true}
+		} else {
+			cs.udpConns = append(cs.udpConns, rtpConn, rtcpConn)
+		}
+		cs.lock.Unlock()
+
+		if transportType == TransportTypeUdp {
+			go cs.readUDP(ctx, rtpConn, track, false)
+			go cs.readUDP(ctx, rtcpConn, track, true)
+		}
+
+		track.Transport = trans
+		if cs.opts.Listener != nil {
+			if err := cs.opts.Listener.OnTransport(trans); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func (cs *CliSession) setupTransport(index int, track *TrackRemote, transportType TransportType) (resp *Response, rtpConn, rtcpConn *net.UDPConn, err error) {
+	var trans *Transport
+	if transportType == TransportTypeTcp {
+		trans = NewTcpTransport(RtpProfileAVP, []int{index * 2, index*2 + 1})
+		trans.unicast = true
+	} else {
+		rtpConn, rtcpConn, err = listenUDPPair()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		port := rtpConn.LocalAddr().(*net.UDPAddr).Port
+		trans = NewUdpTransport(RtpProfileAVP, []int{port, port + 1})
+	}
+
+	req, err := cs.newRequest("SETUP")
+	if err != nil {
+		return nil, rtpConn, rtcpConn, err
+	}
+
+	req.SetUrl(track.Control)
+	req.SetLine("Transport", trans.String())
+
+	resp, err = cs.roundTrip(req)
+	if err != nil {
+		if rtpConn != nil {
+			rtpConn.Close()
+			rtcpConn.Close()
+		}
+		return nil, nil, nil, fmt.Errorf("setup %s failed: %w", track.Control, err)
+	}
+
+	return resp, rtpConn, rtcpConn, nil
+}
+
+func (cs *CliSession) play() error {
+	req, err := cs.newRequest("PLAY")
+	if err != nil {
+		return err
+	}
+
+	req.SetLine("Range", "npt=0.000-")
+
+	resp, err := cs.roundTrip(req)
+	if err != nil {
+		return fmt.Errorf("play failed: %w", err)
+	}
+
+	if resp.Status() != StatusOK {
+		return fmt.Errorf("play failed: %d %s", resp.Status(), resp.Status().String())
+	}
+
+	cs.logger.Infof("rtsp playing %s, session %s", cs.url, cs.session)
+
+	return nil
+}
+
+func (cs *CliSession) teardown() {
+	req, err := cs.newRequest("TEARDOWN")
+	if err != nil {
+		return
+	}
+
+	cs.lock.Lock()
+	cli := cs.cli
+	cs.lock.Unlock()
+
+	if cli != nil {
+		cs.authorize(req)
+		cli.Write([]byte(req.String()))
+	}
+}
+
+func (cs *CliSession) keepaliveMethod() string {
+	for _, m := range cs.public {
+		if m == "GET_PARAMETER" {
+			return m
+		}
+	}
+
+	return "OPTIONS"
+}
+
+func (cs *CliSession) keepaliveInterval() time.Duration {
+	interval := cs.opts.KeepaliveInterval
+	if interval <= 0 {
+		cs.lock.Lock()
+		interval = cs.sessionTimeout / 2
+		cs.lock.Unlock()
+	}
+
+	if interval <= 0 {
+		interval = defaultKeepaliveInterval
+	}
+
+	return interval
+}
+
+// readTimeout is the deadline of a read on the control connection, it
+// spans two keepalives whose responses may be all the server sends.
+func (cs *CliSession) readTimeout() time.Duration {
+	timeout := 2*cs.keepaliveInterval() + keepaliveReadMargin
+	if cs.opts.ReadTimeout > timeout {
+		timeout = cs.opts.ReadTimeout
+	}
+
+	return timeout
+}
+
+func (cs *CliSession) keepalive(ctx context.Context, conn net.Conn) {
+	ticker := time.NewTicker(cs.keepaliveInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			req, err := cs.newRequest(cs.keepaliveMethod())
+			if err != nil {
+				return
+			}
+
+			if _, err := cs.roundTrip(req); err != nil {
+				cs.logger.Warnf("rtsp keepalive failed: %v", err)
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (cs *CliSession) readUDP(ctx context.Context, conn *net.UDPConn, track *TrackRemote, rtcp bool) {
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				cs.logger.Debugf("rtsp udp read error: %v", err)
+			}
+			return
+		}
+
+		pkt := make([]byte, n)
+		copy(pkt, buf[:n])
+
+		if rtcp {
+			track.handleRtcp(pkt)
+		} else if err := track.handleRtp(pkt); err != nil {
+			cs.logger.Debugf("rtsp invalid rtp packet: %v", err)
+		}
+	}
+}
+
+func listenUDPPair() (*net.UDPConn, *net.UDPConn, error) {
+	var lastErr error
+	for i := 0; i < 16; i++ {
+		rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		port := rtpConn.LocalAddr().(*net.UDPAddr).Port
+		if port%2 != 0 {
+			rtpConn.Close()
+			continue
+		}
+
+		rtcpConn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port + 1})
+		if err != nil {
+			lastErr = err
+			rtpConn.Close()
+			continue
+		}
+
+		return rtpConn, rtcpConn, nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no udp port pair available")
+	}
+
+	return nil, nil, lastErr
+}
+
+func parseSessionHeader(s string) (string, time.Duration) {
+	parts := strings.Split(s, ";")
+	id := strings.TrimSpace(parts[0])
+
+	var timeout time.Duration
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) == 2 && strings.EqualFold(kv[0], "timeout") {
+			if seconds, err := strconv.Atoi(kv[1]); err == nil {
+				timeout = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	return id, timeout
+}
@@ -0,0 +1,241 @@
+package rtsp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// standInServer is a minimal RTSP server publishing one H264 track, it
+// sends its RTP packets over UDP once played.
+type standInServer struct {
+	t        *testing.T
+	ln       net.Listener
+	lock     sync.Mutex
+	conns    int
+	requests map[string]int
+	done     chan struct{}
+}
+
+func newStandInServer(t *testing.T) *standInServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &standInServer{
+		t:        t,
+		ln:       ln,
+		requests: make(map[string]int),
+		done:     make(chan struct{}),
+	}
+
+	go s.accept()
+	t.Cleanup(s.close)
+
+	return s
+}
+
+func (s *standInServer) url() string {
+	return "rtsp://" + s.ln.Addr().String() + "/live/test"
+}
+
+func (s *standInServer) close() {
+	close(s.done)
+	s.ln.Close()
+}
+
+func (s *standInServer) count(method string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests[method]
+}
+
+func (s *standInServer) connections() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.conns
+}
+
+func (s *standInServer) accept() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.lock.Lock()
+		s.conns++
+		s.lock.Unlock()
+
+		go s.serve(c)
+	}
+}
+
+func (s *standInServer) serve(c net.Conn) {
+	defer c.Close()
+
+	var clientPort int
+	r := bufio.NewReader(c)
+	for {
+		var method, url, cseq, transport string
+		for {
+			l, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			l = strings.TrimRight(l, "\r\n")
+			if l == "" {
+				break
+			}
+
+			lower := strings.ToLower(l)
+			switch {
+			case method == "":
+				f := strings.Fields(l)
+				method, url = f[0], f[1]
+			case strings.HasPrefix(lower, "cseq:"):
+				cseq = strings.TrimSpace(l[5:])
+			case strings.HasPrefix(lower, "transport:"):
+				transport = strings.TrimSpace(l[10:])
+			}
+		}
+
+		s.lock.Lock()
+		s.requests[method]++
+		s.lock.Unlock()
+
+		extra, body := "", ""
+		switch method {
+		case "OPTIONS":
+			extra = "Public: OPTIONS, DESCRIBE, SETUP, PLAY, GET_PARAMETER, TEARDOWN\r\n"
+		case "DESCRIBE":
+			body = "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=test\r\nt=0 0\r\n" +
+				"m=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\na=control:trackID=0\r\n"
+			extra = "Content-Type: application/sdp\r\nContent-Base: " + url + "/\r\n"
+		case "SETUP":
+			for _, p := range strings.Split(transport, ";") {
+				if strings.HasPrefix(p, "client_port=") {
+					clientPort, _ = strconv.Atoi(strings.SplitN(p[len("client_port="):], "-", 2)[0])
+				}
+			}
+			extra = "Transport: " + transport + ";server_port=7000-7001\r\nSession: 1234;timeout=60\r\n"
+		case "PLAY":
+			extra = "Session: 1234\r\n"
+			go s.sendRTP(clientPort)
+		}
+
+		fmt.Fprintf(c, "RTSP/1.0 200 OK\r\nCSeq: %s\r\n%sContent-Length: %d\r\n\r\n%s", cseq, extra, len(body), body)
+	}
+}
+
+func (s *standInServer) sendRTP(port int) {
+	conn, err := net.Dial("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		s.t.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	pkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:     2,
+			PayloadType: 96,
+			SSRC:        1,
+		},
+		Payload: []byte{0x65, 0x00},
+	}
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			pkt.SequenceNumber++
+			pkt.Timestamp += 1800
+			b, _ := pkt.Marshal()
+			conn.Write(b)
+		}
+	}
+}
+
+type testListener struct {
+	packets atomic.Int64
+	played  chan struct{}
+}
+
+func (l *testListener) OnTrackRemote(track *TrackRemote) error { return nil }
+
+func (l *testListener) OnTransport(t *Transport) error { return nil }
+
+func (l *testListener) OnTracksReady(tracks []*TrackRemote) error {
+	for _, track := range tracks {
+		track.OnRTP(func(pkt *rtp.Packet) {
+			l.packets.Add(1)
+		})
+	}
+
+	return nil
+}
+
+func (l *testListener) OnPlay() {
+	close(l.played)
+}
+
+func TestCliSessionUDPOutlastsReadTimeout(t *testing.T) {
+	srv := newStandInServer(t)
+	listener := &testListener{played: make(chan struct{})}
+
+	readTimeout := 200 * time.Millisecond
+	cs, err := NewCliSession(context.Background(), CliSessionOptions{
+		Url:               srv.url(),
+		Transport:         TransportTypeUdp,
+		ReadTimeout:       readTimeout,
+		KeepaliveInterval: 300 * time.Millisecond,
+		MaxReconnects:     -1,
+		Listener:          listener,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs.Start()
+	defer cs.Close()
+
+	select {
+	case <-listener.played:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not played")
+	}
+
+	time.Sleep(5 * readTimeout)
+
+	if cs.Context().Err() != nil {
+		t.Fatalf("session closed: %v", cs.Err())
+	}
+
+	if n := srv.connections(); n != 1 {
+		t.Errorf("connections = %d, want 1", n)
+	}
+
+	if n := srv.count("GET_PARAMETER"); n == 0 {
+		t.Error("no keepalive sent")
+	}
+
+	if listener.packets.Load() == 0 {
+		t.Error("no rtp packet received")
+	}
+}
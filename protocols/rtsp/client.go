@@ -1,18 +1,24 @@
 package rtsp
 
 import (
+	"bytes"
 	"strconv"
 
 	goPool "github.com/panjf2000/gnet/pkg/pool/goroutine"
 	"github.com/sirupsen/logrus"
 )
 
+type ResponseHandler func(resp *Response)
+type InterleavedHandler func(channel int, payload []byte)
+
 type Client struct {
-	state       State
-	cseqCounter int
-	pool        *goPool.Pool
-	Url         string
-	Write       WriteHandler
+	state         State
+	cseqCounter   int
+	pool          *goPool.Pool
+	Url           string
+	Write         WriteHandler
+	OnResponse    ResponseHandler
+	OnInterleaved InterleavedHandler
 }
 
 func NewClient(write WriteHandler) *Client {
@@ -34,7 +40,16 @@ func (c *Client) State() State {
 }
 
 func (c *Client) decodeRtpRtcp(buf []byte) (int, error) {
-	return 0, nil
+	channel, payload, endOffset := UnmarshalInterleaved(buf)
+	if endOffset == 0 {
+		return 0, nil
+	}
+
+	if c.OnInterleaved != nil {
+		c.OnInterleaved(channel, payload)
+	}
+
+	return endOffset, nil
 }
 
 func (c *Client) Feed(buf []byte) (int, error) {
@@ -47,15 +62,22 @@ func (c *Client) Feed(buf []byte) (int, error) {
 	var err error
 	var endOffset int
 	if buf[0] != '$' {
-		_, endOffset, err = UnmarshalResponse(buf)
-		if err != nil {
+		if !bytes.HasPrefix(buf, []byte("RTSP/")) {
+			// requests sent by the server (e.g. GET_PARAMETER pings) are
+			// consumed without answering
+			_, endOffset, err = UnmarshalRequest(buf)
+			return endOffset, err
+		}
+
+		var resp *Response
+		resp, endOffset, err = UnmarshalResponse(buf)
+		if err != nil || resp == nil {
 			return endOffset, err
 		}
 
-		// err = c.responseProcess(resp)
-		// if err != nil {
-		// 	return endOffset, err
-		// }
+		if c.OnResponse != nil {
+			c.OnResponse(resp)
+		}
 	} else {
 		endOffset, err = c.decodeRtpRtcp(buf)
 		if err != nil {
@@ -73,9 +95,14 @@ func (c *Client) nextCSeq() string {
 }
 
 func (c *Client) NewRequest(method string) *Request {
+	url := c.Url
+	if url == "" {
+		url = "*"
+	}
+
 	req := &Request{
 		method:  method,
-		url:     "*",
+		url:     url,
 		version: "RTSP/1.0",
 		lines: HeaderLines{
 			"CSeq": c.nextCSeq(),
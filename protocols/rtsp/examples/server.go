@@ -59,6 +59,15 @@ func (ts *TestServer) OnStream(serv *rtsp.Serv) error {
 	return nil
 }
 
+func (ts *TestServer) OnTeardown(serv *rtsp.Serv) {
+	fmt.Println("teardown")
+}
+
+func (ts *TestServer) OnAuthenticate(serv *rtsp.Serv, req *rtsp.Request, user string, authErr error) error {
+	fmt.Println("authenticate", req.Method(), user, authErr)
+	return nil
+}
+
 func (ts *TestServer) NewOrGet() rtsp.IServSession {
 	return &TestSession{
 		ServSession: rtsp.NewServSession(ts),
@@ -84,6 +93,14 @@ func main() {
 		Logger:           log,
 		Multicore:        true,
 		NumEventLoop:     0,
+		Auth: rtsp.AuthProviders{
+			"*": &rtsp.Authenticator{
+				Scheme:      rtsp.AuthSchemeDigest,
+				Realm:       "neon",
+				Methods:     []rtsp.MethodEnum{rtsp.DescribeMethod, rtsp.AnnounceMethod},
+				Credentials: rtsp.StaticCredentials{"admin": "admin"},
+			},
+		},
 	})
 	if err != nil {
 		panic(err)
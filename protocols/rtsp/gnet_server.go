@@ -3,10 +3,15 @@ package rtsp
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/panjf2000/gnet"
 )
 
+// idleCheckInterval is how often the idle connections are reaped.
+const idleCheckInterval = time.Second
+
 type servConn struct {
 	*Serv
 	c gnet.Conn
@@ -18,6 +23,8 @@ type Server struct {
 	provider      ISessionProvider
 	opt           Options
 	addr          string
+	lock          sync.Mutex
+	conns         map[gnet.Conn]*servConn
 }
 
 func NewServer(eventListener IServerEventListener, provider ISessionProvider, addr string, opt Options) (*Server, error) {
@@ -26,6 +33,7 @@ func NewServer(eventListener IServerEventListener, provider ISessionProvider, ad
 		provider:      provider,
 		opt:           opt,
 		addr:          addr,
+		conns:         make(map[gnet.Conn]*servConn),
 	}
 
 	if opt.Logger == nil {
@@ -36,7 +44,14 @@ func NewServer(eventListener IServerEventListener, provider ISessionProvider, ad
 }
 
 func (s *Server) Run() error {
+	tcpNoDelay := gnet.TCPDelay
+	if s.opt.TCPNoDelay {
+		tcpNoDelay = gnet.TCPNoDelay
+	}
+
 	opt := gnet.Options{
+		TCPNoDelay:       tcpNoDelay,
+		LockOSThread:     s.opt.LockOSThread,
 		ReusePort:        s.opt.ReusePort,
 		ReuseAddr:        s.opt.ReuseAddr,
 		TCPKeepAlive:     s.opt.TCPKeepAlive,
@@ -46,6 +61,7 @@ func (s *Server) Run() error {
 		Multicore:        s.opt.Multicore,
 		NumEventLoop:     s.opt.NumEventLoop,
 		Codec:            s,
+		Ticker:           true,
 	}
 
 	s.opt.Logger.Infof("server is running on %s", s.addr)
@@ -77,6 +93,9 @@ func (s *Server) OnOpened(c gnet.Conn) (out []byte, action gnet.Action) {
 		Serv: NewServ(session, ServOptions{
 			Logger:      session.Logger(),
 			IdleTimeout: s.opt.IdleTimeout,
+			Auth:        s.opt.Auth,
+			RemoteAddr:  c.RemoteAddr(),
+			LocalAddr:   c.LocalAddr(),
 			Write: func(data []byte) error {
 				return c.AsyncWrite(data)
 			},
@@ -87,10 +106,27 @@ func (s *Server) OnOpened(c gnet.Conn) (out []byte, action gnet.Action) {
 	session.AddParams(s, sc)
 	c.SetContext(session)
 
+	s.lock.Lock()
+	s.conns[c] = sc
+	s.lock.Unlock()
+
+	if s.eventListener != nil {
+		s.eventListener.OnConnect(session)
+	}
+
 	return
 }
 
 func (s *Server) OnClosed(c gnet.Conn, err error) (action gnet.Action) {
+	s.lock.Lock()
+	delete(s.conns, c)
+	s.lock.Unlock()
+
+	if sc, err := s.getServConn(c); err == nil {
+		sc.Serv.Close()
+		sc.Session().DeleteParams(s)
+	}
+
 	if s.eventListener != nil {
 		ss, err := s.getServSession(c)
 		if err == nil {
@@ -101,6 +137,30 @@ func (s *Server) OnClosed(c gnet.Conn, err error) (action gnet.Action) {
 	return
 }
 
+// Tick closes the connections idle for longer than their session timeout,
+// their sessions are released by OnClosed.
+func (s *Server) Tick() (delay time.Duration, action gnet.Action) {
+	now := time.Now()
+
+	var expired []*servConn
+	s.lock.Lock()
+	for _, sc := range s.conns {
+		if sc.Expired(now) {
+			expired = append(expired, sc)
+		}
+	}
+	s.lock.Unlock()
+
+	for _, sc := range expired {
+		s.opt.Logger.Infof("rtsp connection %s expired, last active %s, closing", sc.c.RemoteAddr(), sc.LastActive().Format(time.RFC3339))
+		if err := sc.c.Close(); err != nil {
+			s.opt.Logger.Errorf("close idle connection error: %v", err)
+		}
+	}
+
+	return idleCheckInterval, gnet.None
+}
+
 func (s *Server) Encode(c gnet.Conn, buf []byte) ([]byte, error) {
 	return buf, nil
 }
@@ -112,16 +172,24 @@ func (s *Server) Decode(c gnet.Conn) ([]byte, error) {
 		return nil, err
 	}
 
-	offset, err := sc.Serv.Feed(c.Read())
-	if offset > 0 && offset < c.BufferLength() {
-		c.ShiftN(offset)
-	} else if offset >= c.BufferLength() {
-		c.ResetBuffer()
-	}
+	// gnet decodes once per read event, feed every complete message of
+	// the buffer here.
+	for c.BufferLength() > 0 {
+		offset, err := sc.Serv.Feed(c.Read())
+		if err != nil {
+			s.opt.Logger.Errorf("serv feed error: %v", err)
+			return nil, err
+		}
 
-	if err != nil {
-		s.opt.Logger.Errorf("serv feed error: %v", err)
-		return nil, err
+		if offset == 0 {
+			break
+		}
+
+		if offset < c.BufferLength() {
+			c.ShiftN(offset)
+		} else {
+			c.ResetBuffer()
+		}
 	}
 
 	return nil, nil
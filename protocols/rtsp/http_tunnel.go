@@ -0,0 +1,357 @@
+package rtsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tunnelContentType  = "application/x-rtsp-tunnelled"
+	tunnelCookieHeader = "x-sessioncookie"
+	tunnelPairTimeout  = 10 * time.Second
+	tunnelReadSize     = 4096
+)
+
+var (
+	ErrTunnelCookie   = errors.New("rtsp tunnel without x-sessioncookie")
+	ErrTunnelExists   = errors.New("rtsp tunnel cookie already in use")
+	ErrTunnelNotFound = errors.New("rtsp tunnel not found")
+)
+
+// tunnel is an RTSP connection over HTTP, the GET connection carries the
+// responses and the media to the client, the POST connection carries the
+// base64 encoded requests of the client.
+type tunnel struct {
+	*Serv
+	cookie    string
+	lock      sync.Mutex
+	get       net.Conn
+	getRW     *bufio.ReadWriter
+	post      net.Conn
+	created   time.Time
+	onceClose sync.Once
+}
+
+func (t *tunnel) write(data []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, err := t.getRW.Write(data); err != nil {
+		return err
+	}
+
+	return t.getRW.Flush()
+}
+
+func (t *tunnel) setPost(c net.Conn) net.Conn {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	old := t.post
+	t.post = c
+	return old
+}
+
+func (t *tunnel) paired() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.post != nil
+}
+
+func (t *tunnel) close() {
+	t.onceClose.Do(func() {
+		t.Serv.Close()
+
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		t.get.Close()
+		if t.post != nil {
+			t.post.Close()
+		}
+	})
+}
+
+// HTTPTunnel serves RTSP over HTTP as QuickTime tunnels it, a GET and a
+// POST request paired by their x-sessioncookie header. The decoded byte
+// stream is fed to the same Serv as a plain TCP connection.
+type HTTPTunnel struct {
+	ctx           context.Context
+	eventListener IServerEventListener
+	provider      ISessionProvider
+	opt           Options
+	lock          sync.Mutex
+	tunnels       map[string]*tunnel
+}
+
+func NewHTTPTunnel(ctx context.Context, eventListener IServerEventListener, provider ISessionProvider, opt Options) (*HTTPTunnel, error) {
+	if opt.Logger == nil {
+		return nil, fmt.Errorf("logger is nil")
+	}
+
+	t := &HTTPTunnel{
+		ctx:           ctx,
+		eventListener: eventListener,
+		provider:      provider,
+		opt:           opt,
+		tunnels:       make(map[string]*tunnel),
+	}
+
+	go t.reap()
+
+	return t, nil
+}
+
+// StreamsBody tells the http server that the body of a tunnel is the
+// stream of the rtsp requests of its client, it must not be read ahead.
+func (h *HTTPTunnel) StreamsBody(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), tunnelContentType)
+}
+
+func (h *HTTPTunnel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cookie := r.Header.Get(tunnelCookieHeader)
+	if cookie == "" {
+		h.opt.Logger.Warnf("rtsp tunnel %s %s from %s: %s", r.Method, r.URL, r.RemoteAddr, ErrTunnelCookie.Error())
+		http.Error(w, ErrTunnelCookie.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.handleGet(w, r, cookie)
+	case http.MethodPost:
+		h.handlePost(w, r, cookie)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func hijack(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http connection can not be hijacked")
+	}
+
+	return hj.Hijack()
+}
+
+// handleGet opens the tunnel, the connection is answered once and then
+// only carries RTSP messages to the client.
+func (h *HTTPTunnel) handleGet(w http.ResponseWriter, r *http.Request, cookie string) {
+	h.lock.Lock()
+	_, found := h.tunnels[cookie]
+	h.lock.Unlock()
+	if found {
+		http.Error(w, ErrTunnelExists.Error(), http.StatusConflict)
+		return
+	}
+
+	c, rw, err := hijack(w)
+	if err != nil {
+		h.opt.Logger.Errorf("rtsp tunnel hijack error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session := h.provider.NewOrGet()
+	t := &tunnel{
+		cookie:  cookie,
+		get:     c,
+		getRW:   rw,
+		created: time.Now(),
+	}
+
+	t.Serv = NewServ(session, ServOptions{
+		Logger:      session.Logger(),
+		IdleTimeout: h.opt.IdleTimeout,
+		Auth:        h.opt.Auth,
+		RemoteAddr:  c.RemoteAddr(),
+		LocalAddr:   c.LocalAddr(),
+		Write:       t.write,
+	})
+
+	h.lock.Lock()
+	if _, found := h.tunnels[cookie]; found {
+		h.lock.Unlock()
+		c.Close()
+		return
+	}
+	h.tunnels[cookie] = t
+	h.lock.Unlock()
+
+	session.AddParams(h, t)
+
+	resp := strings.Join([]string{
+		"HTTP/1.0 200 OK",
+		"Server: Neon-RTSP",
+		"Connection: close",
+		"Date: " + time.Now().UTC().Format(http.TimeFormat),
+		"Cache-Control: no-store",
+		"Pragma: no-cache",
+		"Content-Type: " + tunnelContentType,
+	}, "\r\n") + "\r\n\r\n"
+
+	if err := t.write([]byte(resp)); err != nil {
+		h.opt.Logger.Errorf("rtsp tunnel write error: %v", err)
+		h.remove(t)
+		return
+	}
+
+	if h.eventListener != nil {
+		h.eventListener.OnConnect(session)
+	}
+
+	h.opt.Logger.Debugf("rtsp tunnel %s opened by %s", cookie, c.RemoteAddr())
+
+	// the client sends nothing more on the GET connection, a read only
+	// ends when it is gone.
+	go func() {
+		io.Copy(io.Discard, rw)
+		h.remove(t)
+	}()
+}
+
+// handlePost feeds the requests of the client to the tunnel of the
+// cookie, a client may open a new POST connection at any time.
+func (h *HTTPTunnel) handlePost(w http.ResponseWriter, r *http.Request, cookie string) {
+	h.lock.Lock()
+	t, found := h.tunnels[cookie]
+	h.lock.Unlock()
+	if !found {
+		h.opt.Logger.Warnf("rtsp tunnel %s: %s", cookie, ErrTunnelNotFound.Error())
+		http.Error(w, ErrTunnelNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	c, rw, err := hijack(w)
+	if err != nil {
+		h.opt.Logger.Errorf("rtsp tunnel hijack error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer c.Close()
+
+	if old := t.setPost(c); old != nil {
+		old.Close()
+	}
+
+	if err := h.feed(t, rw.Reader); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		h.opt.Logger.Warnf("rtsp tunnel %s post error: %v", cookie, err)
+		h.remove(t)
+	}
+}
+
+// feed decodes the base64 stream of the POST connection, each message
+// is encoded on its own so only complete quanta are decoded.
+func (h *HTTPTunnel) feed(t *tunnel, r io.Reader) error {
+	var encoded, decoded []byte
+	buf := make([]byte, tunnelReadSize)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				encoded = append(encoded, b)
+			}
+		}
+
+		if quanta := len(encoded) / 4 * 4; quanta > 0 {
+			out := make([]byte, base64.StdEncoding.DecodedLen(quanta))
+			m, derr := base64.StdEncoding.Decode(out, encoded[:quanta])
+			if derr != nil {
+				return derr
+			}
+
+			decoded = append(decoded, out[:m]...)
+			encoded = append(encoded[:0], encoded[quanta:]...)
+		}
+
+		for len(decoded) > 0 {
+			offset, ferr := t.Feed(decoded)
+			if ferr != nil {
+				return ferr
+			}
+
+			if offset == 0 {
+				break
+			}
+
+			decoded = decoded[offset:]
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (h *HTTPTunnel) remove(t *tunnel) {
+	h.lock.Lock()
+	if h.tunnels[t.cookie] != t {
+		h.lock.Unlock()
+		return
+	}
+	delete(h.tunnels, t.cookie)
+	h.lock.Unlock()
+
+	t.close()
+	t.Session().DeleteParams(h)
+
+	h.opt.Logger.Debugf("rtsp tunnel %s closed", t.cookie)
+
+	if h.eventListener != nil {
+		h.eventListener.OnDisconnect(t.Session())
+	}
+}
+
+// reap closes the tunnels idle for longer than their session timeout,
+// and those whose POST connection never came.
+func (h *HTTPTunnel) reap() {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			h.Close()
+			return
+		case now := <-ticker.C:
+			var expired []*tunnel
+			h.lock.Lock()
+			for _, t := range h.tunnels {
+				if t.Expired(now) || (!t.paired() && now.Sub(t.created) > tunnelPairTimeout) {
+					expired = append(expired, t)
+				}
+			}
+			h.lock.Unlock()
+
+			for _, t := range expired {
+				h.opt.Logger.Infof("rtsp tunnel %s expired, last active %s, closing", t.cookie, t.LastActive().Format(time.RFC3339))
+				h.remove(t)
+			}
+		}
+	}
+}
+
+// Close closes every tunnel, the HTTP server does not track hijacked
+// connections.
+func (h *HTTPTunnel) Close() {
+	h.lock.Lock()
+	tunnels := make([]*tunnel, 0, len(h.tunnels))
+	for _, t := range h.tunnels {
+		tunnels = append(tunnels, t)
+	}
+	h.lock.Unlock()
+
+	for _, t := range tunnels {
+		h.remove(t)
+	}
+}
@@ -0,0 +1,39 @@
+package rtsp
+
+import "encoding/binary"
+
+const (
+	interleavedMagic      = '$'
+	interleavedHeaderSize = 4
+)
+
+// UnmarshalInterleaved decodes an RTP/RTCP packet embedded in the RTSP
+// stream ($ + channel + 2 bytes length). It returns a zero endOffset when
+// the buffer doesn't hold a complete packet yet.
+func UnmarshalInterleaved(buf []byte) (channel int, payload []byte, endOffset int) {
+	if len(buf) < interleavedHeaderSize || buf[0] != interleavedMagic {
+		return 0, nil, 0
+	}
+
+	length := int(binary.BigEndian.Uint16(buf[2:4]))
+	if len(buf) < interleavedHeaderSize+length {
+		return 0, nil, 0
+	}
+
+	channel = int(buf[1])
+	payload = buf[interleavedHeaderSize : interleavedHeaderSize+length]
+
+	return channel, payload, interleavedHeaderSize + length
+}
+
+// MarshalInterleaved wraps an RTP/RTCP packet for delivery over the RTSP
+// connection.
+func MarshalInterleaved(channel int, payload []byte) []byte {
+	buf := make([]byte, interleavedHeaderSize+len(payload))
+	buf[0] = interleavedMagic
+	buf[1] = byte(channel)
+	binary.BigEndian.PutUint16(buf[2:4], uint16(len(payload)))
+	copy(buf[interleavedHeaderSize:], payload)
+
+	return buf
+}
@@ -48,4 +48,8 @@ type Options struct {
 
 	// IdleTimeout is the maximum duration for the connection to be idle.
 	IdleTimeout time.Duration
+
+	// Auth selects the authenticator of a namespace, nil disables
+	// authentication.
+	Auth IAuthProvider
 }
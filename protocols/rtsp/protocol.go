@@ -8,4 +8,8 @@ type WriteHandler func(date []byte) error
 type IRtspListener interface {
 	OnTrackRemote(track *TrackRemote) error
 	OnTransport(t *Transport) error
+	OnTracksReady(tracks []*TrackRemote) error
+	// OnPlay is called once the server accepted the PLAY of a client
+	// session, after OnTracksReady
+	OnPlay()
 }
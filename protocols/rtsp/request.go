@@ -24,6 +24,44 @@ const (
 	RecordMethod
 )
 
+func (m MethodEnum) String() string {
+	switch m {
+	case OptionsMethod:
+		return "OPTIONS"
+	case DescribeMethod:
+		return "DESCRIBE"
+	case AnnounceMethod:
+		return "ANNOUNCE"
+	case SetupMethod:
+		return "SETUP"
+	case PlayMethod:
+		return "PLAY"
+	case PauseMethod:
+		return "PAUSE"
+	case TeardownMethod:
+		return "TEARDOWN"
+	case GetParameterMethod:
+		return "GET_PARAMETER"
+	case SetParameterMethod:
+		return "SET_PARAMETER"
+	case RecordMethod:
+		return "RECORD"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ParseMethod is the reverse of MethodEnum.String, case insensitive.
+func ParseMethod(s string) MethodEnum {
+	for m := OptionsMethod; m <= RecordMethod; m++ {
+		if strings.EqualFold(m.String(), s) {
+			return m
+		}
+	}
+
+	return UnknownMethod
+}
+
 type Request struct {
 	method  string
 	url     string
@@ -34,6 +72,7 @@ type Request struct {
 
 type IRequest interface {
 	Url() string
+	SetUrl(url string)
 	MethodStr() string
 	GetLine(key string) string
 	SetLine(key, value string)
@@ -72,7 +111,7 @@ func UnmarshalRequest(buf []byte) (*Request, int, error) {
 	}
 
 	req.method = strings.ToLower(string(methodLineParts[0]))
-	req.url = strings.ToLower(string(methodLineParts[1]))
+	req.url = string(methodLineParts[1])
 	req.version = strings.ToLower(string(methodLineParts[2]))
 
 	// parse other lines
@@ -123,36 +162,17 @@ func (lines HeaderLines) String() string {
 }
 
 func (req *Request) Method() MethodEnum {
-	switch req.method {
-	case "options":
-		return OptionsMethod
-	case "describe":
-		return DescribeMethod
-	case "announce":
-		return AnnounceMethod
-	case "setup":
-		return SetupMethod
-	case "play":
-		return PlayMethod
-	case "pause":
-		return PauseMethod
-	case "teardown":
-		return TeardownMethod
-	case "getparameter":
-		return GetParameterMethod
-	case "setparameter":
-		return SetParameterMethod
-	case "record":
-		return RecordMethod
-	default:
-		return UnknownMethod
-	}
+	return ParseMethod(req.method)
 }
 
 func (req *Request) Url() string {
 	return req.url
 }
 
+func (req *Request) SetUrl(url string) {
+	req.url = url
+}
+
 func (req *Request) MethodStr() string {
 	return req.method
 }
@@ -195,6 +215,10 @@ func (req *Request) Session() string {
 	return req.lines["session"]
 }
 
+func (req *Request) Authorization() string {
+	return req.lines["authorization"]
+}
+
 func (req *Request) ContentType() string {
 	return req.lines["content-type"]
 }
@@ -12,6 +12,7 @@ type IResponse interface {
 	String() string
 	CSeq() int
 	Session() string
+	SetSession(session string)
 	//	Transport() (*Transport, error)
 	ContentLength() int
 	Expires() string
@@ -22,6 +23,7 @@ type IResponse interface {
 	Line(key string) string
 	SetLine(key, value string)
 	Option() *OptionsResponse
+	Status() Status
 }
 
 type Response struct {
@@ -58,7 +60,7 @@ func (resp *Response) String() string {
 func UnmarshalResponse(buf []byte) (*Response, int, error) {
 	headerEndOffset := bytes.Index(buf, []byte("\r\n\r\n"))
 	if headerEndOffset == -1 {
-		return nil, -1, errors.New("incomplete packet")
+		return nil, 0, nil
 	}
 
 	endOffset := headerEndOffset + 4
@@ -76,7 +78,7 @@ func UnmarshalResponse(buf []byte) (*Response, int, error) {
 
 	// parse first line
 	statusLine := lines[0]
-	statusLineParts := bytes.Split(statusLine, []byte(" "))
+	statusLineParts := bytes.SplitN(statusLine, []byte(" "), 3)
 	if len(statusLineParts) != 3 {
 		return nil, endOffset, errors.New("invalid packet")
 	}
@@ -87,7 +89,7 @@ func UnmarshalResponse(buf []byte) (*Response, int, error) {
 	resp.statusStr = string(statusLineParts[2])
 
 	// parse other lines
-	for _, line := range lines {
+	for _, line := range lines[1:] {
 		if len(line) == 0 {
 			continue
 		}
@@ -98,7 +100,7 @@ func UnmarshalResponse(buf []byte) (*Response, int, error) {
 		}
 
 		key := strings.ToLower(string(line[:idx]))
-		value := string(line[idx+1:])
+		value := strings.TrimSpace(string(line[idx+1:]))
 		resp.lines[key] = value
 
 		if key == "content-length" {
@@ -110,13 +112,22 @@ func UnmarshalResponse(buf []byte) (*Response, int, error) {
 		}
 	}
 
-	resp.content = buf[headerEndOffset+4 : headerEndOffset+4+contentLength]
+	if contentLength > len(buf[endOffset:]) {
+		return nil, 0, nil
+	}
+
+	resp.content = make([]byte, contentLength)
+	copy(resp.content, buf[endOffset:endOffset+contentLength])
 
 	endOffset += contentLength
 
 	return resp, endOffset, nil
 }
 
+func (resp *Response) Status() Status {
+	return resp.status
+}
+
 func (resp *Response) CSeq() int {
 	cseqLine := resp.lines["cseq"]
 	if cseqLine == "" {
@@ -143,6 +154,18 @@ func (resp *Response) Session() string {
 	return resp.lines["session"]
 }
 
+func (resp *Response) SetSession(session string) {
+	if session == "" {
+		return
+	}
+
+	resp.lines["Session"] = session
+}
+
+func (resp *Response) WWWAuthenticate() string {
+	return resp.lines["www-authenticate"]
+}
+
 func (resp *Response) Expires() string {
 	return resp.lines["expires"]
 }
@@ -187,6 +210,12 @@ func (resp *Response) Describe() *DescribeResponse {
 	}
 }
 
+func (resp *Response) Setup() *SetupResponse {
+	return &SetupResponse{
+		IResponse: resp,
+	}
+}
+
 // OptionsResponse is a RTSP OPTIONS request
 type OptionsResponse struct {
 	IResponse
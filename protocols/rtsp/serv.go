@@ -1,6 +1,14 @@
 package rtsp
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	goPool "github.com/panjf2000/gnet/pkg/pool/goroutine"
@@ -15,12 +23,30 @@ const (
 	PlayState
 	PauseState
 	TeardownState
+	RecordState
+	AnnounceState
+)
+
+const (
+	defaultDescribeTimeout = 10 * time.Second
+	defaultSessionTimeout  = 60 * time.Second
+	maxPendingRequests     = 32
+)
+
+var (
+	ErrTooManyRequests = errors.New("rtsp too many pending requests")
+	ErrTrackNotFound   = errors.New("rtsp track not found")
+	ErrNotPlaying      = errors.New("rtsp session not playing")
+	ErrParameterNotSet = errors.New("rtsp parameter not understood")
 )
 
 type ServOptions struct {
 	IdleTimeout time.Duration `json:"idleTimeout,omitempty" p:"idleTimeout"` // idle timeout
 	Logger      Logger
 	Write       WriteHandler
+	Auth        IAuthProvider
+	RemoteAddr  net.Addr
+	LocalAddr   net.Addr
 }
 
 type Serv struct {
@@ -32,9 +58,25 @@ type Serv struct {
 	url         string
 	options     ServOptions
 	desc        []byte
+	authLock    sync.Mutex
+	nonce       string
+	user        string
+	lock        sync.RWMutex
+	tracks      []*TrackRemote
+	sessionID   string
+	requests    chan *Request
+	onceWorker  sync.Once
+	onceClose   sync.Once
+	closed      chan struct{}
+	recording   bool
+	lastActive  int64
+	shutdown    int32
 }
 
 func NewServ(ss IServSession, options ServOptions) *Serv {
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = defaultSessionTimeout
+	}
 
 	return &Serv{
 		ss:          ss,
@@ -44,15 +86,152 @@ func NewServ(ss IServSession, options ServOptions) *Serv {
 		descChan:    make(chan string, 1),
 		url:         "",
 		options:     options,
+		requests:    make(chan *Request, maxPendingRequests),
+		closed:      make(chan struct{}),
+		lastActive:  time.Now().UnixNano(),
 	}
 }
 
 func (serv *Serv) State() State {
+	serv.lock.RLock()
+	defer serv.lock.RUnlock()
 	return serv.state
 }
 
+func (serv *Serv) setState(state State) {
+	serv.lock.Lock()
+	defer serv.lock.Unlock()
+	serv.state = state
+}
+
+// Session returns the session this connection belongs to.
+func (serv *Serv) Session() IServSession {
+	return serv.ss
+}
+
+// Url returns the url of the first request, it selects the stream.
+func (serv *Serv) Url() string {
+	serv.lock.RLock()
+	defer serv.lock.RUnlock()
+	return serv.url
+}
+
+func (serv *Serv) RemoteAddr() net.Addr {
+	return serv.options.RemoteAddr
+}
+
+func (serv *Serv) LocalAddr() net.Addr {
+	return serv.options.LocalAddr
+}
+
+// Tracks returns the medias of the DESCRIBE or ANNOUNCE description.
+func (serv *Serv) Tracks() []*TrackRemote {
+	serv.lock.RLock()
+	defer serv.lock.RUnlock()
+
+	tracks := make([]*TrackRemote, len(serv.tracks))
+	copy(tracks, serv.tracks)
+	return tracks
+}
+
+// IdleTimeout is the timeout announced in the Session header, the
+// connection is reaped when nothing is received for that long.
+func (serv *Serv) IdleTimeout() time.Duration {
+	return serv.options.IdleTimeout
+}
+
+// LastActive returns when the last request or interleaved packet was
+// received, RTCP receiver reports count as keepalive as well.
+func (serv *Serv) LastActive() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&serv.lastActive))
+}
+
+// Expired reports whether the connection has been idle for longer than
+// the session timeout or was shut down.
+func (serv *Serv) Expired(now time.Time) bool {
+	return atomic.LoadInt32(&serv.shutdown) != 0 || now.Sub(serv.LastActive()) > serv.options.IdleTimeout
+}
+
+// Shutdown asks the server to close the connection, e.g. once the session
+// behind it has ended.
+func (serv *Serv) Shutdown() {
+	atomic.StoreInt32(&serv.shutdown, 1)
+}
+
+// Close stops processing the pending requests, the connection is gone.
+func (serv *Serv) Close() {
+	serv.onceClose.Do(func() {
+		close(serv.closed)
+	})
+}
+
 func (serv *Serv) decodeRtpRtcp(buf []byte) (int, error) {
-	return 0, nil
+	channel, payload, endOffset := UnmarshalInterleaved(buf)
+	if endOffset == 0 {
+		return 0, nil
+	}
+
+	var target *TrackRemote
+	rtcp := false
+
+	serv.lock.RLock()
+	if serv.state == RecordState {
+		for _, track := range serv.tracks {
+			if track.Transport == nil {
+				continue
+			}
+
+			if track.Transport.RtpInterleaved() == channel {
+				target = track
+				break
+			}
+
+			if track.Transport.RtcpInterleaved() == channel {
+				target, rtcp = track, true
+				break
+			}
+		}
+	}
+	serv.lock.RUnlock()
+
+	if target == nil {
+		return endOffset, nil
+	}
+
+	pkt := make([]byte, len(payload))
+	copy(pkt, payload)
+
+	if rtcp {
+		target.handleRtcp(pkt)
+	} else if err := target.handleRtp(pkt); err != nil {
+		serv.Logger().Debugf("rtsp invalid rtp packet on channel %d: %s", channel, err.Error())
+	}
+
+	return endOffset, nil
+}
+
+// WriteRTP sends a packet of the track of kind to a playing client.
+func (serv *Serv) WriteRTP(kind TrackKind, pkt []byte) error {
+	serv.lock.RLock()
+	playing := serv.state == PlayState
+	var track *TrackRemote
+	for _, t := range serv.tracks {
+		if t.Kind == kind && t.Transport != nil {
+			track = t
+			break
+		}
+	}
+	serv.lock.RUnlock()
+
+	if !playing {
+		return ErrNotPlaying
+	}
+
+	if track == nil {
+		return ErrTrackNotFound
+	}
+
+	return serv.options.Write(MarshalInterleaved(track.Transport.RtpInterleaved(), pkt))
 }
 
 func (serv *Serv) Feed(buf []byte) (int, error) {
@@ -63,6 +242,12 @@ func (serv *Serv) Feed(buf []byte) (int, error) {
 
 	var err error
 	var endOffset int
+	defer func() {
+		if endOffset > 0 {
+			atomic.StoreInt64(&serv.lastActive, time.Now().UnixNano())
+		}
+	}()
+
 	if buf[0] != '$' {
 		var req *Request
 		req, endOffset, err = UnmarshalRequest(buf)
@@ -90,56 +275,188 @@ func (serv *Serv) SetDescribe(desc string) {
 	serv.descChan <- desc
 }
 
+// handleRequest queues the request, they are processed one by one in
+// arrival order since a request may block, DESCRIBE waits for the stream.
 func (serv *Serv) handleRequest(req *Request) error {
+	serv.onceWorker.Do(func() {
+		serv.pool.Submit(serv.processRequests)
+	})
+
+	select {
+	case serv.requests <- req:
+		return nil
+	default:
+		return ErrTooManyRequests
+	}
+}
+
+func (serv *Serv) processRequests() {
+	for {
+		select {
+		case <-serv.closed:
+			return
+		case req := <-serv.requests:
+			serv.processRequest(req)
+		}
+	}
+}
+
+func (serv *Serv) processRequest(req *Request) {
 	defer func() {
 		if err := recover(); err != nil {
-			serv.Logger().Errorf("handleRequest panic: %v", err)
+			serv.Logger().Errorf("handleRequest process panic => req: %v, err: %v", req, err)
 		}
 	}()
 
-	serv.pool.Submit(func() {
-		defer func() {
-			if err := recover(); err != nil {
-				serv.Logger().Errorf("handleRequest process panic => req: %v, err: %v", req, err)
-			}
-		}()
+	serv.Logger().Debugf("rtsp request: %s", req.String())
+
+	serv.lock.Lock()
+	if serv.url == "" {
+		serv.url = req.Url()
+	}
+	serv.lock.Unlock()
 
-		serv.Logger().Debugf("rtsp request: %s", req.String())
+	if !serv.authenticate(req) {
+		return
+	}
 
-		if serv.url == "" {
-			serv.url = req.Url()
+	if status := serv.validate(req); status != StatusOK {
+		serv.Logger().Warnf("rtsp %s rejected in state %d: %d", req.Method().String(), serv.State(), status)
+		if err := serv.WriteResponseStatus(req.CSeq(), status); err != nil {
+			serv.Logger().Errorf("rtsp request error: %s", err.Error())
 		}
+		return
+	}
 
-		var err error
-		switch req.Method() {
-		case OptionsMethod:
-			err = serv.OptionsProcess(req)
-		case DescribeMethod:
-			err = serv.DescribeProcess(req)
-		case AnnounceMethod:
-			err = serv.AnnounceProcess(req)
-		case SetupMethod:
-			err = serv.SetupProcess(req)
-		case PlayMethod:
-			err = serv.PlayProcess(req)
-		case PauseMethod:
-			err = serv.PauseProcess(req)
-		case TeardownMethod:
-			err = serv.TeardownProcess(req)
-		case GetParameterMethod:
-			err = serv.GetParameterProcess(req)
-		case SetParameterMethod:
-			err = serv.SetParameterProcess(req)
-		default:
-			err = serv.WriteResponseStatus(req.CSeq(), StatusMethodNotAllowed)
-		}
+	var err error
+	switch req.Method() {
+	case OptionsMethod:
+		err = serv.OptionsProcess(req)
+	case DescribeMethod:
+		err = serv.DescribeProcess(req)
+	case AnnounceMethod:
+		err = serv.AnnounceProcess(req)
+	case SetupMethod:
+		err = serv.SetupProcess(req)
+	case PlayMethod:
+		err = serv.PlayProcess(req)
+	case RecordMethod:
+		err = serv.RecordProcess(req)
+	case PauseMethod:
+		err = serv.PauseProcess(req)
+	case TeardownMethod:
+		err = serv.TeardownProcess(req)
+	case GetParameterMethod:
+		err = serv.GetParameterProcess(req)
+	case SetParameterMethod:
+		err = serv.SetParameterProcess(req)
+	default:
+		err = serv.WriteResponseStatus(req.CSeq(), StatusMethodNotAllowed)
+	}
 
-		if err != nil {
-			serv.Logger().Errorf("rtsp request error: %s", err.Error())
-			return
+	if err != nil {
+		serv.Logger().Errorf("rtsp request error: %s", err.Error())
+	}
+}
+
+// validate checks the Session header of the request and whether its
+// method is valid in the current state of the session.
+func (serv *Serv) validate(req *Request) Status {
+	serv.lock.RLock()
+	state, sessionID, recording := serv.state, serv.sessionID, serv.recording
+	serv.lock.RUnlock()
+
+	if session := req.Session(); session != "" && sessionID != "" {
+		if id, _ := parseSessionHeader(session); id != sessionID {
+			return StatusSessionNotFound
 		}
-	})
-	return nil
+	}
+
+	valid := true
+	switch req.Method() {
+	case DescribeMethod:
+		valid = state != PlayState && state != RecordState && !recording
+	case AnnounceMethod:
+		valid = state == EmptyState || state == OptionsState || state == AnnounceState
+	case SetupMethod:
+		valid = state == DescribeState || state == AnnounceState || state == SetupState ||
+			state == PlayState || state == RecordState || state == PauseState
+	case PlayMethod:
+		valid = !recording && (state == SetupState || state == PauseState || state == PlayState)
+	case RecordMethod:
+		valid = recording && (state == SetupState || state == PauseState || state == RecordState)
+	case PauseMethod:
+		valid = state == PlayState || state == RecordState || state == PauseState
+	}
+
+	if !valid {
+		return StatusMethodNotValid
+	}
+
+	return StatusOK
+}
+
+func (serv *Serv) authenticate(req *Request) bool {
+	if serv.options.Auth == nil {
+		return true
+	}
+
+	namespace := namespaceOf(req.Url())
+	auth := serv.options.Auth.Authenticator(namespace)
+	if auth == nil || !auth.Protects(req.Method()) {
+		return true
+	}
+
+	serv.authLock.Lock()
+	if serv.nonce == "" {
+		serv.nonce = newNonce()
+	}
+	nonce := serv.nonce
+	serv.authLock.Unlock()
+
+	user, err := auth.Verify(namespace, strings.ToUpper(req.MethodStr()), req.Url(), req.Authorization(), nonce)
+	if errors.Is(err, ErrAuthRequired) {
+		serv.writeChallenge(req.CSeq(), auth, nonce, false)
+		return false
+	}
+
+	var listenerErr error
+	if serv.ss.GetEventListener() != nil {
+		listenerErr = serv.ss.GetEventListener().OnAuthenticate(serv, req, user, err)
+	}
+
+	if err != nil {
+		serv.Logger().Warnf("rtsp authenticate %s failed, user: %s, err: %s", req.Method().String(), user, err.Error())
+		serv.writeChallenge(req.CSeq(), auth, nonce, errors.Is(err, ErrAuthStaleNonce))
+		return false
+	}
+
+	if listenerErr != nil {
+		serv.Logger().Warnf("rtsp %s forbidden, user: %s, err: %s", req.Method().String(), user, listenerErr.Error())
+		serv.WriteResponseStatus(req.CSeq(), StatusForbidden)
+		return false
+	}
+
+	serv.authLock.Lock()
+	serv.user = user
+	serv.authLock.Unlock()
+
+	return true
+}
+
+func (serv *Serv) writeChallenge(cseq int, auth *Authenticator, nonce string, stale bool) {
+	resp := NewResponse(cseq, StatusUnauthorized)
+	resp.SetLine("WWW-Authenticate", auth.Challenge(nonce, stale).String())
+	if err := serv.WriteResponse(resp); err != nil {
+		serv.Logger().Errorf("rtsp write challenge error: %s", err.Error())
+	}
+}
+
+// User returns the authenticated user, empty if none.
+func (serv *Serv) User() string {
+	serv.authLock.Lock()
+	defer serv.authLock.Unlock()
+	return serv.user
 }
 
 func (serv *Serv) OptionsProcess(req *Request) error {
@@ -152,10 +469,15 @@ func (serv *Serv) OptionsProcess(req *Request) error {
 		"TEARDOWN",
 		"PLAY",
 		"PAUSE",
+		"RECORD",
 		"GET_PARAMETER",
 		"SET_PARAMETER",
 	})
 
+	if serv.State() == EmptyState {
+		serv.setState(OptionsState)
+	}
+
 	return serv.WriteResponse(resp)
 }
 
@@ -170,13 +492,27 @@ func (serv *Serv) DescribeProcess(req *Request) error {
 	select {
 	case desc := <-serv.descChan:
 		serv.Logger().Debugf("rtsp describe get desc: %s", desc)
+
+		base := strings.TrimSuffix(req.Url(), "/") + "/"
+		tracks, err := ParseTracks([]byte(desc), base)
+		if err != nil {
+			serv.Logger().Errorf("rtsp describe invalid desc: %s", err.Error())
+			return serv.WriteResponseStatus(req.CSeq(), StatusInternalServerError)
+		}
+
+		serv.lock.Lock()
+		serv.desc = []byte(desc)
+		serv.tracks = tracks
+		serv.state = DescribeState
+		serv.lock.Unlock()
+
 		resp := NewResponse(req.CSeq(), StatusOK).Describe()
 		resp.SetContentType("application/sdp")
-		resp.SetContentBase(serv.url)
+		resp.SetContentBase(base)
 		resp.SetContent(desc)
 		return serv.WriteResponse(resp)
 
-	case <-time.After(serv.options.IdleTimeout * time.Second):
+	case <-time.After(defaultDescribeTimeout):
 		serv.Logger().Debugf("rtsp describe timeout")
 		return serv.WriteResponseStatus(req.CSeq(), StatusNotFound)
 	}
@@ -188,14 +524,24 @@ func (serv *Serv) AnnounceProcess(req *Request) error {
 		return serv.WriteResponseStatus(req.CSeq(), StatusUnsupportedMediaType)
 	}
 
-	serv.desc = req.GetContent()
-
 	var sd sdp.SessionDescription
-	if err := sd.Unmarshal([]byte(serv.desc)); err != nil {
+	if err := sd.Unmarshal(req.GetContent()); err != nil {
 		serv.Logger().Errorf("rtsp announce error: %s", err.Error())
 		return serv.WriteResponseStatus(req.CSeq(), StatusBadRequest)
 	}
 
+	tracks, err := ParseTracks(req.GetContent(), strings.TrimSuffix(req.Url(), "/")+"/")
+	if err != nil || len(tracks) == 0 {
+		serv.Logger().Errorf("rtsp announce without track")
+		return serv.WriteResponseStatus(req.CSeq(), StatusBadRequest)
+	}
+
+	serv.lock.Lock()
+	serv.desc = req.GetContent()
+	serv.tracks = tracks
+	serv.recording = true
+	serv.lock.Unlock()
+
 	if serv.ss.GetEventListener() != nil {
 		if err := serv.ss.GetEventListener().OnAnnounce(serv); err != nil {
 			serv.Logger().Errorf("rtsp announce error: %s", err.Error())
@@ -203,9 +549,33 @@ func (serv *Serv) AnnounceProcess(req *Request) error {
 		}
 	}
 
+	serv.setState(AnnounceState)
+
 	return serv.WriteResponse(NewResponse(req.CSeq(), StatusOK))
 }
 
+// findTrack matches the url of a SETUP against the track controls, some
+// clients send the control alone instead of the resolved url.
+func (serv *Serv) findTrack(url string) (int, *TrackRemote) {
+	for i, track := range serv.tracks {
+		if track.Control == url {
+			return i, track
+		}
+	}
+
+	for i, track := range serv.tracks {
+		if strings.HasSuffix(url, "/"+path.Base(track.Control)) {
+			return i, track
+		}
+	}
+
+	if len(serv.tracks) == 1 {
+		return 0, serv.tracks[0]
+	}
+
+	return -1, nil
+}
+
 func (serv *Serv) SetupProcess(req *Request) error {
 	serv.Logger().Debugf("rtsp setup")
 	trans, err := req.Setup().Transport()
@@ -216,27 +586,222 @@ func (serv *Serv) SetupProcess(req *Request) error {
 
 	serv.Logger().Debugf("rtsp setup transport: %v", *trans)
 
-	return serv.WriteResponse(NewSetupResponse(req.CSeq(), StatusOK, trans))
+	if trans.Type() != TransportTypeTcp {
+		return serv.WriteResponseStatus(req.CSeq(), StatusUnsupportedTransport)
+	}
+
+	serv.lock.Lock()
+	index, track := serv.findTrack(req.Url())
+	if track == nil {
+		serv.lock.Unlock()
+		return serv.WriteResponseStatus(req.CSeq(), StatusNotFound)
+	}
+
+	if !trans.HasInterleaved() {
+		trans.SetInterleaveds([]int{index * 2, index*2 + 1})
+	}
+
+	track.Transport = trans
+	if serv.sessionID == "" {
+		serv.sessionID = newNonce()[:16]
+	}
+	if serv.state != RecordState && serv.state != PlayState && serv.state != PauseState {
+		serv.state = SetupState
+	}
+	serv.lock.Unlock()
+
+	resp := NewSetupResponse(req.CSeq(), StatusOK, trans)
+	resp.SetSession(serv.sessionHeader())
+
+	return serv.WriteResponse(resp)
+}
+
+// stream starts the media of a PLAY or RECORD, or resumes it after a
+// PAUSE.
+func (serv *Serv) stream() error {
+	listener := serv.ss.GetEventListener()
+	if listener == nil {
+		return nil
+	}
+
+	if serv.State() == PauseState {
+		return listener.OnResume(serv)
+	}
+
+	return listener.OnStream(serv)
 }
 
 func (serv *Serv) PlayProcess(req *Request) error {
+	if serv.State() != PlayState {
+		if err := serv.stream(); err != nil {
+			serv.Logger().Errorf("rtsp play error: %s", err.Error())
+			return serv.WriteResponseStatus(req.CSeq(), StatusForbidden)
+		}
+	}
+
+	resp := NewResponse(req.CSeq(), StatusOK)
+	resp.SetSession(serv.sessionHeader())
+	resp.SetLine("Range", "npt=0.000-")
+	if err := serv.WriteResponse(resp); err != nil {
+		return err
+	}
+
+	serv.setState(PlayState)
+
 	return nil
 }
 
+func (serv *Serv) RecordProcess(req *Request) error {
+	if serv.State() != RecordState {
+		if err := serv.stream(); err != nil {
+			serv.Logger().Errorf("rtsp record error: %s", err.Error())
+			return serv.WriteResponseStatus(req.CSeq(), StatusForbidden)
+		}
+	}
+
+	serv.setState(RecordState)
+
+	resp := NewResponse(req.CSeq(), StatusOK)
+	resp.SetSession(serv.sessionHeader())
+
+	return serv.WriteResponse(resp)
+}
+
 func (serv *Serv) PauseProcess(req *Request) error {
-	return nil
+	if serv.State() != PauseState && serv.ss.GetEventListener() != nil {
+		if err := serv.ss.GetEventListener().OnPause(serv); err != nil {
+			serv.Logger().Errorf("rtsp pause error: %s", err.Error())
+			return serv.WriteResponseStatus(req.CSeq(), StatusForbidden)
+		}
+	}
+
+	serv.setState(PauseState)
+
+	resp := NewResponse(req.CSeq(), StatusOK)
+	resp.SetSession(serv.sessionHeader())
+
+	return serv.WriteResponse(resp)
 }
 
 func (serv *Serv) TeardownProcess(req *Request) error {
-	return nil
+	serv.setState(TeardownState)
+
+	if serv.ss.GetEventListener() != nil {
+		serv.ss.GetEventListener().OnTeardown(serv)
+	}
+
+	resp := NewResponse(req.CSeq(), StatusOK)
+	resp.SetSession(serv.sessionHeader())
+
+	return serv.WriteResponse(resp)
 }
 
+// GetParameterProcess answers the parameters asked by the body, an empty
+// GET_PARAMETER is a keepalive.
 func (serv *Serv) GetParameterProcess(req *Request) error {
-	return nil
+	names, _ := parseParameters(req.GetContent())
+	if len(names) == 0 {
+		resp := NewResponse(req.CSeq(), StatusOK)
+		resp.SetSession(serv.sessionHeader())
+		return serv.WriteResponse(resp)
+	}
+
+	listener, ok := serv.ss.GetEventListener().(IServParameterListener)
+	if !ok {
+		return serv.WriteResponseStatus(req.CSeq(), StatusParameterNotUnderstood)
+	}
+
+	values, err := listener.OnGetParameter(serv, names)
+	if err != nil {
+		serv.Logger().Warnf("rtsp get parameter %v error: %s", names, err.Error())
+		return serv.WriteResponseStatus(req.CSeq(), StatusParameterNotUnderstood)
+	}
+
+	resp := NewResponse(req.CSeq(), StatusOK)
+	resp.SetSession(serv.sessionHeader())
+	if len(values) > 0 {
+		resp.SetLine("Content-Type", "text/parameters")
+		resp.SetContent(marshalParameters(values))
+	}
+
+	return serv.WriteResponse(resp)
 }
 
+// SetParameterProcess hands the parameters of the body to the listener,
+// they are the in-band commands of the client.
 func (serv *Serv) SetParameterProcess(req *Request) error {
-	return nil
+	_, params := parseParameters(req.GetContent())
+	if len(params) > 0 {
+		listener, ok := serv.ss.GetEventListener().(IServParameterListener)
+		if !ok {
+			return serv.WriteResponseStatus(req.CSeq(), StatusParameterNotUnderstood)
+		}
+
+		if err := listener.OnSetParameter(serv, params); err != nil {
+			serv.Logger().Warnf("rtsp set parameter %v error: %s", params, err.Error())
+			return serv.WriteResponseStatus(req.CSeq(), StatusParameterNotUnderstood)
+		}
+	}
+
+	resp := NewResponse(req.CSeq(), StatusOK)
+	resp.SetSession(serv.sessionHeader())
+
+	return serv.WriteResponse(resp)
+}
+
+// parseParameters parses a text/parameters body, one parameter per line,
+// the value is empty for a line without colon.
+func parseParameters(content []byte) ([]string, map[string]string) {
+	var names []string
+	params := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			name, value = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		}
+
+		names = append(names, name)
+		params[name] = value
+	}
+
+	return names, params
+}
+
+func marshalParameters(params map[string]string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("%s: %s\r\n", name, params[name]))
+	}
+
+	return sb.String()
+}
+
+// sessionHeader is the Session header of the responses, the session id
+// followed by the idle timeout in seconds.
+func (serv *Serv) sessionHeader() string {
+	sessionID := serv.SessionID()
+	if sessionID == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s;timeout=%d", sessionID, int(serv.options.IdleTimeout/time.Second))
+}
+
+func (serv *Serv) SessionID() string {
+	serv.lock.RLock()
+	defer serv.lock.RUnlock()
+	return serv.sessionID
 }
 
 func (serv *Serv) WriteResponse(resp IResponse) error {
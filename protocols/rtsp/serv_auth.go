@@ -0,0 +1,286 @@
+package rtsp
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrAuthRequired     = errors.New("authorization required")
+	ErrAuthUserNotFound = errors.New("auth user not found")
+	ErrAuthInvalid      = errors.New("auth invalid credentials")
+	ErrAuthStaleNonce   = errors.New("auth stale nonce")
+)
+
+const defaultAuthCallbackTimeout = 3 * time.Second
+
+// CredentialStore resolves the password of a user. The plain password is
+// needed since Digest can only be verified by recomputing the response.
+type CredentialStore interface {
+	Password(namespace, user string) (string, error)
+}
+
+// StaticCredentials maps users to their password.
+type StaticCredentials map[string]string
+
+func (sc StaticCredentials) Password(namespace, user string) (string, error) {
+	password, found := sc[user]
+	if !found {
+		return "", ErrAuthUserNotFound
+	}
+
+	return password, nil
+}
+
+// HTTPCredentials asks an HTTP service for the password of a user, it
+// posts {"namespace": "...", "user": "..."} and expects {"password": "..."}
+// back, any of 401, 403 or 404 means the user is unknown.
+type HTTPCredentials struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPCredentials(url string, timeout time.Duration) *HTTPCredentials {
+	if timeout <= 0 {
+		timeout = defaultAuthCallbackTimeout
+	}
+
+	return &HTTPCredentials{
+		url: url,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+func (hc *HTTPCredentials) Password(namespace, user string) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"namespace": namespace,
+		"user":      user,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, hc.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return "", ErrAuthUserNotFound
+	default:
+		return "", fmt.Errorf("auth callback %s status %d", hc.url, resp.StatusCode)
+	}
+
+	var result struct {
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	return result.Password, nil
+}
+
+// Authenticator challenges and verifies the requests of one namespace.
+type Authenticator struct {
+	Scheme AuthScheme
+	// Algorithm is the Digest algorithm, MD5 by default.
+	Algorithm string
+	Realm     string
+	// Methods lists the protected methods, all but OPTIONS when empty.
+	Methods     []MethodEnum
+	Credentials CredentialStore
+}
+
+func (a *Authenticator) Protects(method MethodEnum) bool {
+	if len(a.Methods) == 0 {
+		return method != OptionsMethod
+	}
+
+	for _, m := range a.Methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *Authenticator) Challenge(nonce string, stale bool) *AuthChallenge {
+	c := &AuthChallenge{
+		Scheme: a.Scheme,
+		Realm:  a.Realm,
+	}
+
+	if a.Scheme == AuthSchemeDigest {
+		c.Nonce = nonce
+		c.Algorithm = a.Algorithm
+		if c.Algorithm == "" {
+			c.Algorithm = DigestAlgorithmMD5
+		}
+		c.Stale = stale
+	}
+
+	return c
+}
+
+// Verify checks the Authorization header of a request to uri and returns
+// the authenticated user.
+func (a *Authenticator) Verify(namespace, method, uri, header, nonce string) (string, error) {
+	if header == "" {
+		return "", ErrAuthRequired
+	}
+
+	scheme, rest := splitAuthScheme(header)
+	switch {
+	case a.Scheme == AuthSchemeBasic && strings.EqualFold(scheme, "basic"):
+		return a.verifyBasic(namespace, rest)
+	case a.Scheme == AuthSchemeDigest && strings.EqualFold(scheme, "digest"):
+		return a.verifyDigest(namespace, method, uri, rest, nonce)
+	}
+
+	return "", ErrAuthSchemeNotSupported
+}
+
+func (a *Authenticator) verifyBasic(namespace, token string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return "", ErrAuthInvalid
+	}
+
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", ErrAuthInvalid
+	}
+
+	password, err := a.Credentials.Password(namespace, parts[0])
+	if err != nil {
+		return parts[0], err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(password), []byte(parts[1])) != 1 {
+		return parts[0], ErrAuthInvalid
+	}
+
+	return parts[0], nil
+}
+
+func (a *Authenticator) verifyDigest(namespace, method, uri, rest, nonce string) (string, error) {
+	params := parseAuthParams(rest)
+	user := params["username"]
+
+	if params["realm"] != a.Realm {
+		return user, ErrAuthInvalid
+	}
+
+	// the response of another request must not authorize this one
+	if !digestURIMatches(params["uri"], uri) {
+		return user, ErrAuthInvalid
+	}
+
+	algorithm := a.Algorithm
+	if algorithm == "" {
+		algorithm = DigestAlgorithmMD5
+	}
+
+	if alg, ok := params["algorithm"]; ok && !strings.EqualFold(alg, algorithm) {
+		return user, ErrAuthAlgorithmInvalid
+	}
+
+	h, err := digestHash(algorithm)
+	if err != nil {
+		return user, err
+	}
+
+	if params["nonce"] != nonce {
+		return user, ErrAuthStaleNonce
+	}
+
+	password, err := a.Credentials.Password(namespace, user)
+	if err != nil {
+		return user, err
+	}
+
+	ha1 := hashHex(h, user+":"+a.Realm+":"+password)
+	ha2 := hashHex(h, method+":"+params["uri"])
+
+	var expected string
+	if qop := params["qop"]; qop != "" {
+		expected = hashHex(h, ha1+":"+nonce+":"+params["nc"]+":"+params["cnonce"]+":"+qop+":"+ha2)
+	} else {
+		expected = hashHex(h, ha1+":"+nonce+":"+ha2)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(params["response"]))) != 1 {
+		return user, ErrAuthInvalid
+	}
+
+	return user, nil
+}
+
+// digestURIMatches reports whether the uri of a digest response is the
+// request uri, absolute or as its path.
+func digestURIMatches(digestURI, requestURI string) bool {
+	if digestURI == requestURI {
+		return true
+	}
+
+	if !strings.HasPrefix(digestURI, "/") {
+		return false
+	}
+
+	u, err := url.Parse(requestURI)
+	if err != nil {
+		return false
+	}
+
+	return digestURI == u.RequestURI()
+}
+
+type IAuthProvider interface {
+	Authenticator(namespace string) *Authenticator
+}
+
+// AuthProviders maps namespaces to their authenticator, "*" matches any
+// namespace without its own entry.
+type AuthProviders map[string]*Authenticator
+
+func (ap AuthProviders) Authenticator(namespace string) *Authenticator {
+	if a, found := ap[namespace]; found {
+		return a
+	}
+
+	return ap["*"]
+}
+
+// namespaceOf returns the host of a request url which selects the
+// namespace, like the domain of the other protocols.
+func namespaceOf(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
@@ -0,0 +1,150 @@
+package rtsp
+
+import (
+	"errors"
+	"testing"
+)
+
+const (
+	testRealm = "neon"
+	testNonce = "6d1c3f0b2a"
+	testURI   = "rtsp://127.0.0.1:554/live/a"
+)
+
+func testAuthenticator(scheme AuthScheme, algorithm string) *Authenticator {
+	return &Authenticator{
+		Scheme:      scheme,
+		Algorithm:   algorithm,
+		Realm:       testRealm,
+		Credentials: StaticCredentials{"alice": "secret"},
+	}
+}
+
+// TestDigestVerifyRFC2617 checks the response of the example of RFC 2617,
+// computed elsewhere than by AuthChallenge.Authorization.
+func TestDigestVerifyRFC2617(t *testing.T) {
+	a := &Authenticator{
+		Scheme:      AuthSchemeDigest,
+		Realm:       "testrealm@host.com",
+		Credentials: StaticCredentials{"Mufasa": "Circle Of Life"},
+	}
+
+	header := `Digest username="Mufasa", realm="testrealm@host.com", ` +
+		`nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", uri="/dir/index.html", qop=auth, ` +
+		`nc=00000001, cnonce="0a4f113b", response="6629fae49393a05397450978507c4ef1", ` +
+		`opaque="5ccc069c403ebaf9f0171e9517f40e41"`
+
+	user, err := a.Verify("", "GET", "/dir/index.html", header, "dcd98b7102dd2f0e8b11d0f600bfb0c093")
+	if err != nil || user != "Mufasa" {
+		t.Fatalf("Verify = %q, %v", user, err)
+	}
+}
+
+func TestDigestVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		qop       string
+		uri       string
+		user      string
+		password  string
+		realm     string
+		nonce     string
+		method    string
+		err       error
+	}{
+		{name: "md5", algorithm: DigestAlgorithmMD5},
+		{name: "sha-256", algorithm: DigestAlgorithmSHA256},
+		{name: "qop", algorithm: DigestAlgorithmMD5, qop: "auth"},
+		{name: "path uri", algorithm: DigestAlgorithmMD5, uri: "/live/a"},
+		{name: "wrong password", algorithm: DigestAlgorithmMD5, password: "guess", err: ErrAuthInvalid},
+		{name: "unknown user", algorithm: DigestAlgorithmMD5, user: "bob", err: ErrAuthUserNotFound},
+		{name: "other realm", algorithm: DigestAlgorithmMD5, realm: "other", err: ErrAuthInvalid},
+		{name: "stale nonce", algorithm: DigestAlgorithmMD5, nonce: "expired", err: ErrAuthStaleNonce},
+		{name: "other uri", algorithm: DigestAlgorithmMD5, uri: "rtsp://127.0.0.1:554/live/b", err: ErrAuthInvalid},
+		{name: "other path", algorithm: DigestAlgorithmMD5, uri: "/live/b", err: ErrAuthInvalid},
+		{name: "other method", algorithm: DigestAlgorithmMD5, method: "SETUP", err: ErrAuthInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthenticator(AuthSchemeDigest, tt.algorithm)
+
+			c := a.Challenge(testNonce, false)
+			c.Qop = tt.qop
+			if tt.realm != "" {
+				c.Realm = tt.realm
+			}
+			if tt.nonce != "" {
+				c.Nonce = tt.nonce
+			}
+
+			uri, user, password, method := testURI, "alice", "secret", "DESCRIBE"
+			if tt.uri != "" {
+				uri = tt.uri
+			}
+			if tt.user != "" {
+				user = tt.user
+			}
+			if tt.password != "" {
+				password = tt.password
+			}
+			if tt.method != "" {
+				method = tt.method
+			}
+
+			header, err := c.Authorization(method, uri, user, password)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := a.Verify("", "DESCRIBE", testURI, header, testNonce)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.err)
+			}
+
+			if got != user {
+				t.Errorf("Verify user = %q, want %q", got, user)
+			}
+		})
+	}
+}
+
+func TestDigestVerifyAlgorithmMismatch(t *testing.T) {
+	c := testAuthenticator(AuthSchemeDigest, DigestAlgorithmMD5).Challenge(testNonce, false)
+	header, err := c.Authorization("DESCRIBE", testURI, "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := testAuthenticator(AuthSchemeDigest, DigestAlgorithmSHA256)
+	if _, err := a.Verify("", "DESCRIBE", testURI, header, testNonce); !errors.Is(err, ErrAuthAlgorithmInvalid) {
+		t.Errorf("Verify error = %v, want %v", err, ErrAuthAlgorithmInvalid)
+	}
+}
+
+func TestBasicVerify(t *testing.T) {
+	a := testAuthenticator(AuthSchemeBasic, "")
+	c := a.Challenge("", false)
+
+	for _, tt := range []struct {
+		password string
+		err      error
+	}{
+		{password: "secret"},
+		{password: "guess", err: ErrAuthInvalid},
+	} {
+		header, _ := c.Authorization("DESCRIBE", testURI, "alice", tt.password)
+		if _, err := a.Verify("", "DESCRIBE", testURI, header, ""); !errors.Is(err, tt.err) {
+			t.Errorf("password %q: Verify error = %v, want %v", tt.password, err, tt.err)
+		}
+	}
+
+	if _, err := a.Verify("", "DESCRIBE", testURI, "", ""); !errors.Is(err, ErrAuthRequired) {
+		t.Errorf("no header: Verify error = %v, want %v", err, ErrAuthRequired)
+	}
+
+	if _, err := a.Verify("", "DESCRIBE", testURI, `Digest username="alice"`, ""); !errors.Is(err, ErrAuthSchemeNotSupported) {
+		t.Errorf("digest header: Verify error = %v, want %v", err, ErrAuthSchemeNotSupported)
+	}
+}
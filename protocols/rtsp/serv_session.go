@@ -8,6 +8,19 @@ type IServSessionEventListener interface {
 	OnPause(serv *Serv) error
 	OnResume(serv *Serv) error
 	OnStream(serv *Serv) error
+	OnTeardown(serv *Serv)
+	// OnAuthenticate is called for every request carrying credentials to
+	// a protected method, authErr is nil if they are valid. Returning an
+	// error rejects the request with 403.
+	OnAuthenticate(serv *Serv, req *Request, user string, authErr error) error
+}
+
+// IServParameterListener may be implemented by the session event listener
+// to answer GET_PARAMETER and to accept custom commands by SET_PARAMETER,
+// the parameters are the "name: value" lines of a text/parameters body.
+type IServParameterListener interface {
+	OnGetParameter(serv *Serv, names []string) (map[string]string, error)
+	OnSetParameter(serv *Serv, params map[string]string) error
 }
 
 type IServSession interface {
@@ -1,4 +1,203 @@
 package rtsp
 
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+)
+
+type TrackKind string
+
+const (
+	TrackKindAudio TrackKind = "audio"
+	TrackKindVideo TrackKind = "video"
+)
+
+type RtpHandler func(pkt *rtp.Packet)
+type RtcpHandler func(buf []byte)
+
+// TrackRemote is a media described by the remote SDP, one per SETUP.
 type TrackRemote struct {
+	Kind        TrackKind
+	Control     string
+	PayloadType uint8
+	Codec       string
+	ClockRate   uint32
+	Channels    uint8
+	Fmtp        string
+	Transport   *Transport
+	lock        sync.RWMutex
+	onRtp       RtpHandler
+	onRtcp      RtcpHandler
+}
+
+func (t *TrackRemote) IsAudio() bool {
+	return t.Kind == TrackKindAudio
+}
+
+func (t *TrackRemote) IsVideo() bool {
+	return t.Kind == TrackKindVideo
+}
+
+func (t *TrackRemote) OnRTP(f RtpHandler) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.onRtp = f
+}
+
+func (t *TrackRemote) OnRTCP(f RtcpHandler) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.onRtcp = f
+}
+
+func (t *TrackRemote) handleRtp(buf []byte) error {
+	t.lock.RLock()
+	f := t.onRtp
+	t.lock.RUnlock()
+
+	if f == nil {
+		return nil
+	}
+
+	pkt := &rtp.Packet{}
+	if err := pkt.Unmarshal(buf); err != nil {
+		return err
+	}
+
+	f(pkt)
+
+	return nil
+}
+
+func (t *TrackRemote) handleRtcp(buf []byte) {
+	t.lock.RLock()
+	f := t.onRtcp
+	t.lock.RUnlock()
+
+	if f != nil {
+		f(buf)
+	}
+}
+
+// ParseTracks extracts the audio and video medias of a DESCRIBE answer,
+// resolving every control attribute against baseUrl.
+func ParseTracks(desc []byte, baseUrl string) ([]*TrackRemote, error) {
+	var sd sdp.SessionDescription
+	if err := sd.Unmarshal(desc); err != nil {
+		return nil, err
+	}
+
+	tracks := make([]*TrackRemote, 0, len(sd.MediaDescriptions))
+	for _, md := range sd.MediaDescriptions {
+		kind := TrackKind(md.MediaName.Media)
+		if kind != TrackKindAudio && kind != TrackKindVideo {
+			continue
+		}
+
+		if len(md.MediaName.Formats) == 0 {
+			continue
+		}
+
+		pt, err := strconv.Atoi(md.MediaName.Formats[0])
+		if err != nil {
+			continue
+		}
+
+		track := &TrackRemote{
+			Kind:        kind,
+			PayloadType: uint8(pt),
+		}
+
+		for _, attr := range md.Attributes {
+			switch attr.Key {
+			case "control":
+				track.Control = resolveControl(baseUrl, attr.Value)
+			case "rtpmap":
+				parseRtpmap(track, attr.Value)
+			case "fmtp":
+				if strings.HasPrefix(attr.Value, md.MediaName.Formats[0]+" ") {
+					track.Fmtp = strings.TrimPrefix(attr.Value, md.MediaName.Formats[0]+" ")
+				}
+			}
+		}
+
+		if track.Control == "" {
+			track.Control = baseUrl
+		}
+
+		if track.Codec == "" {
+			staticPayload(track)
+		}
+
+		tracks = append(tracks, track)
+	}
+
+	return tracks, nil
+}
+
+func parseRtpmap(track *TrackRemote, value string) {
+	parts := strings.SplitN(value, " ", 2)
+	if len(parts) != 2 || parts[0] != strconv.Itoa(int(track.PayloadType)) {
+		return
+	}
+
+	enc := strings.Split(parts[1], "/")
+	track.Codec = enc[0]
+	if len(enc) > 1 {
+		clockRate, _ := strconv.Atoi(enc[1])
+		track.ClockRate = uint32(clockRate)
+	}
+
+	if len(enc) > 2 {
+		channels, _ := strconv.Atoi(enc[2])
+		track.Channels = uint8(channels)
+	}
+}
+
+// staticPayload fills in the codec of the RFC 3551 static payload types
+// that cameras commonly send without rtpmap.
+func staticPayload(track *TrackRemote) {
+	switch track.PayloadType {
+	case 0:
+		track.Codec, track.ClockRate, track.Channels = "PCMU", 8000, 1
+	case 8:
+		track.Codec, track.ClockRate, track.Channels = "PCMA", 8000, 1
+	case 9:
+		track.Codec, track.ClockRate, track.Channels = "G722", 8000, 1
+	case 26:
+		track.Codec, track.ClockRate = "JPEG", 90000
+	case 33:
+		track.Codec, track.ClockRate = "MP2T", 90000
+	}
+}
+
+func resolveControl(baseUrl, control string) string {
+	if control == "" || control == "*" {
+		return baseUrl
+	}
+
+	if strings.HasPrefix(strings.ToLower(control), "rtsp://") {
+		return control
+	}
+
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return control
+	}
+
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	ref, err := url.Parse(control)
+	if err != nil {
+		return control
+	}
+
+	return base.ResolveReference(ref).String()
 }
@@ -96,12 +96,13 @@ func (t *Transport) SetSSRC(s int32) {
 }
 
 func (t *Transport) String() string {
-	s := "Transport: "
-
-	s += t.profile.String()
+	s := strings.ToUpper(t.profile.String())
 
 	if t.ty == TransportTypeTcp {
-		s += "TCP;"
+		s += "/TCP;"
+		if t.unicast {
+			s += "unicast;"
+		}
 
 		s += "interleaved="
 		for i, v := range t.interleaveds {
@@ -111,13 +112,13 @@ func (t *Transport) String() string {
 			}
 		}
 	} else {
-		s += "UDP;"
+		s += "/UDP;"
 		if t.unicast {
-			s += "unicast;"
+			s += "unicast"
 		}
 
-		if len(t.clientPorts) > 0 {
-			s += "client_port="
+		if len(t.clientPorts) > 0 && t.clientPorts[0] > 0 {
+			s += ";client_port="
 			for i, v := range t.clientPorts {
 				s += strconv.Itoa(v)
 				if i < len(t.clientPorts)-1 {
@@ -126,8 +127,8 @@ func (t *Transport) String() string {
 			}
 		}
 
-		if len(t.serverPorts) > 0 {
-			s += "server_port="
+		if len(t.serverPorts) > 0 && t.serverPorts[0] > 0 {
+			s += ";server_port="
 			for i, v := range t.serverPorts {
 				s += strconv.Itoa(v)
 				if i < len(t.serverPorts)-1 {
@@ -138,7 +139,11 @@ func (t *Transport) String() string {
 	}
 
 	if t.ssrc != 0 {
-		s += fmt.Sprintf(";ssrc=%x", t.ssrc)
+		s += fmt.Sprintf(";ssrc=%08X", uint32(t.ssrc))
+	}
+
+	if t.mode != "" {
+		s += ";mode=" + t.mode
 	}
 
 	return s
@@ -159,6 +164,7 @@ func UnmarshalTransport(s string) (*Transport, error) {
 
 	for _, p := range kvs {
 		var key, val string
+		p = strings.TrimSpace(p)
 		kv := strings.Split(p, "=")
 		if len(kv) == 2 {
 			key = strings.ToLower(kv[0])
@@ -187,17 +193,17 @@ func UnmarshalTransport(s string) (*Transport, error) {
 			case "server_port":
 				iv := strings.Split(val, "-")
 				if len(iv) == 2 {
-					t.clientPorts[0], _ = strconv.Atoi(iv[0])
-					t.clientPorts[1], _ = strconv.Atoi(iv[1])
+					t.serverPorts[0], _ = strconv.Atoi(iv[0])
+					t.serverPorts[1], _ = strconv.Atoi(iv[1])
 
 					t.ty = TransportTypeUdp
 				}
 
 			case "ssrc":
-				t.ssrc, _ = strconv.ParseInt(val, 16, 32)
+				t.ssrc, _ = strconv.ParseInt(strings.TrimSpace(val), 16, 64)
 
 			case "mode":
-				t.mode = val
+				t.mode = strings.Trim(val, "\"")
 			}
 
 		} else {
@@ -208,6 +214,10 @@ func UnmarshalTransport(s string) (*Transport, error) {
 				if err != nil {
 					return nil, err
 				}
+
+				if strings.HasSuffix(key, "/tcp") {
+					t.ty = TransportTypeTcp
+				}
 			} else if strings.Contains(key, "unicast") {
 				t.unicast = true
 			}
@@ -233,6 +243,51 @@ func UnmarshalTransport(s string) (*Transport, error) {
 	return t, nil
 }
 
+func (t *Transport) Type() TransportType {
+	return t.ty
+}
+
+func (t *Transport) Profile() RtpProfile {
+	return t.profile
+}
+
+func (t *Transport) SSRC() uint32 {
+	return uint32(t.ssrc)
+}
+
+func (t *Transport) Mode() string {
+	return t.mode
+}
+
+func (t *Transport) SetMode(mode string) {
+	t.mode = mode
+}
+
+func (t *Transport) SetInterleaveds(interleaveds []int) {
+	t.ty = TransportTypeTcp
+	t.interleaveds = interleaveds
+}
+
+func (t *Transport) SetServerPorts(serverPorts []int) {
+	t.serverPorts = serverPorts
+}
+
+func (t *Transport) ServerRtpPort() int {
+	if len(t.serverPorts) == 0 {
+		return -1
+	}
+
+	return t.serverPorts[0]
+}
+
+func (t *Transport) ServerRtcpPort() int {
+	if len(t.serverPorts) < 2 {
+		return -1
+	}
+
+	return t.serverPorts[1]
+}
+
 func (t *Transport) RtpPort() int {
 	if len(t.clientPorts) == 0 {
 		return -1
@@ -249,6 +304,10 @@ func (t *Transport) RtcpPort() int {
 	return t.clientPorts[1]
 }
 
+func (t *Transport) HasInterleaved() bool {
+	return len(t.interleaveds) == 2
+}
+
 func (t *Transport) RtpInterleaved() int {
 	if len(t.interleaveds) == 0 {
 		return -1